@@ -2,10 +2,27 @@
 
 package config
 
-import "github.com/spf13/viper"
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
 
 type (
-	DB  struct{ User, Password, Host, Port, Name string }
+	// Pool sizes a *sql.DB; zero values fall back to the provider defaults
+	Pool struct {
+		MaxOpen     int           `mapstructure:"max_open"`
+		MaxIdle     int           `mapstructure:"max_idle"`
+		MaxLifetime time.Duration `mapstructure:"max_lifetime"`
+	}
+	DB struct {
+		User, Password, Host, Port, Name string
+
+		// analytics and ingestion get separate pools so bulk loads can
+		// neither starve nor leak session settings into analytics queries
+		Analytics Pool
+		Ingestion Pool
+	}
 	App struct {
 		Port int
 		Mode string
@@ -13,11 +30,101 @@ type (
 	CSV  struct{ Path string }
 	Cron struct{ Spec string }
 
+	// S3 holds the credentials used for s3://bucket/key sources. Endpoint
+	// and PathStyle point it at S3-compatible servers such as MinIO.
+	S3 struct {
+		Endpoint     string
+		Region       string
+		AccessKey    string `mapstructure:"access_key"`
+		SecretKey    string `mapstructure:"secret_key"`
+		SessionToken string `mapstructure:"session_token"`
+		PathStyle    bool   `mapstructure:"path_style"`
+		// Buckets limits what the on-demand endpoint may read, empty allows any
+		Buckets []string
+	}
+
+	// Upload configures resumable chunked uploads, assembled under Dir, and
+	// the size limit of uploads streamed straight into the parser. Open
+	// sessions untouched for SessionTTL are removed with their parts.
+	Upload struct {
+		Dir           string
+		MaxChunkSize  int64         `mapstructure:"max_chunk_size"`
+		MaxFileSize   int64         `mapstructure:"max_file_size"`
+		MaxStreamSize int64         `mapstructure:"max_stream_size"`
+		SessionTTL    time.Duration `mapstructure:"session_ttl"`
+	}
+
+	// Webhook is the callback notified of every finished job in addition
+	// to the per-job callback URL
+	Webhook struct {
+		URL         string
+		Secret      string
+		MaxAttempts int           `mapstructure:"max_attempts"`
+		Backoff     time.Duration // delay before the first retry, doubled after each attempt
+		Timeout     time.Duration
+	}
+
+	// FX sets the currency amounts are converted to at ingestion, rates
+	// to it are loaded through /fx/rates
+	FX struct{ Base string }
+
+	// DateSource overrides the date formats and time zone for sources whose
+	// path or URL starts with Match
+	DateSource struct {
+		Match    string
+		Formats  []string
+		Timezone string
+	}
+
+	// Dates configures how order dates are read. Formats use YYYY, MM, DD,
+	// HH, mm and ss, or ISO8601 for timestamps with an offset; without
+	// formats each file's format is detected from its first DetectRows rows.
+	// Times without an offset are in Timezone, and dates are reported in
+	// ReportingTimezone.
+	Dates struct {
+		Formats           []string
+		Timezone          string
+		ReportingTimezone string `mapstructure:"reporting_timezone"`
+		DetectRows        int    `mapstructure:"detect_rows"`
+		Sources           []DateSource
+	}
+
+	// PII holds the keys customer emails and addresses are encrypted with.
+	// Keys maps key ids to base64 encoded 32 byte AES keys, new values use
+	// ActiveKey; retired keys stay listed until /privacy/keys/rotate has
+	// re-encrypted everything. IndexKey keys the blind indexes used to
+	// match encrypted emails and must never change.
+	PII struct {
+		ActiveKey string `mapstructure:"active_key"`
+		Keys      map[string]string
+		IndexKey  string `mapstructure:"index_key"`
+	}
+
+	// CLV configures customer lifetime value estimates. Model bgnbd fits a
+	// BG/NBD model to predict purchases in the next HorizonMonths; simple
+	// projects each customer's historical purchase rate over LifetimeYears.
+	// Both multiply by the customer's average purchase value and Margin.
+	CLV struct {
+		Model         string
+		HorizonMonths int     `mapstructure:"horizon_months"`
+		LifetimeYears float64 `mapstructure:"lifetime_years"`
+		Margin        float64
+	}
+
+	Analytics struct{ CLV CLV }
+
 	Config struct {
-		App  App
-		DB   DB
-		CSV  CSV
-		Cron Cron
+		App       App
+		Analytics Analytics
+		DB        DB
+		CSV       CSV
+		Cron      Cron
+		Dates     Dates
+		FX        FX
+		PII       PII
+		S3        S3
+		Upload    Upload
+		Webhook   Webhook
 	}
 )
 
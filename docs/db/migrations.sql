@@ -3,20 +3,34 @@ create table `products` (
   `name` varchar(100) not null,
   `category` varchar(50) default null,
   `unit_price` decimal(12,2) not null,
-  primary key (`id`)
+  `job_id` varchar(36) default null,
+  `source_line` int default null,
+  primary key (`id`),
+  key `job_idx` (`job_id`)
 ) engine=innodb default charset=utf8mb4 collate=utf8mb4_0900_ai_ci;
 
 create table `orders` (
   `id` varchar(50) not null,
   `customer_id` varchar(50) not null,
+  -- day of the order in the reporting time zone
   `order_date` date not null,
+  -- UTC time of the order, null when the source only gives a date
+  `ordered_at` datetime default null,
   `total_amount` decimal(14,2) not null,
+  `currency` char(3) default null,
+  `fx_rate` decimal(18,8) default null,
+  -- null until a rate for the currency and order date is loaded
+  `total_amount_base` decimal(14,2) generated always as (round(`total_amount` * `fx_rate`, 2)) stored,
   `marketing_source` varchar(100) default null,
   `created_at` timestamp null default current_timestamp,
   `updated_at` timestamp null default current_timestamp on update current_timestamp,
+  `job_id` varchar(36) default null,
+  `source_line` int default null,
   primary key (`id`),
   key `order_date_idx` (`order_date`),
-  key `customer_idx` (`customer_id`)
+  key `customer_idx` (`customer_id`),
+  key `currency_date_idx` (`currency`, `order_date`),
+  key `job_idx` (`job_id`)
 ) engine=innodb default charset=utf8mb4 collate=utf8mb4_0900_ai_ci;
 
 create table `order_items` (
@@ -26,18 +40,233 @@ create table `order_items` (
   `unit_price` decimal(12,2) default null,
   `discount` decimal(6,4) default null,
   `shipping_cost` decimal(12,2) default null,
+  `currency` char(3) default null,
+  `fx_rate` decimal(18,8) default null,
+  `unit_price_base` decimal(12,2) generated always as (round(`unit_price` * `fx_rate`, 2)) stored,
+  `shipping_cost_base` decimal(12,2) generated always as (round(`shipping_cost` * `fx_rate`, 2)) stored,
+  `job_id` varchar(36) default null,
+  `source_line` int default null,
   primary key (`order_id`,`product_id`),
   key `product_idx` (`product_id`),
-  key `order_idx` (`order_id`)
+  key `order_idx` (`order_id`),
+  key `job_idx` (`job_id`)
 ) engine=innodb default charset=utf8mb4 collate=utf8mb4_0900_ai_ci;
 
+-- returns and refunds of order items, booked on return_date. A return
+-- gives back goods and money, a refund money only; quantity counts against
+-- the units sold either way. Several returns of an item on one day are
+-- told apart by their source line.
+create table `returns` (
+  `id` bigint not null auto_increment,
+  `order_id` varchar(50) not null,
+  `product_id` varchar(50) not null,
+  `kind` varchar(10) not null,
+  `return_date` date not null,
+  `quantity` int not null,
+  `amount` decimal(14,2) not null,
+  `currency` char(3) default null,
+  `fx_rate` decimal(18,8) default null,
+  `amount_base` decimal(14,2) generated always as (round(`amount` * `fx_rate`, 2)) stored,
+  `job_id` varchar(36) default null,
+  `source_line` int default null,
+  `created_at` timestamp null default current_timestamp,
+  primary key (`id`),
+  unique key `return_uq` (`order_id`, `product_id`, `kind`, `return_date`, `source_line`),
+  key `return_date_idx` (`return_date`),
+  key `job_idx` (`job_id`)
+) engine=innodb default charset=utf8mb4 collate=utf8mb4_0900_ai_ci;
+
+-- email and address hold "enc:<key id>:<base64>" ciphertext, the _index
+-- columns their HMAC blind indexes for lookups and change detection
 create table `customers` (
   `id` varchar(50) not null,
   `name` varchar(100) default null,
-  `email` varchar(150) default null,
+  `email` varchar(320) default null,
+  `region` varchar(50) default null,
+  `address` text,
+  `email_index` char(64) default null,
+  `address_index` char(64) default null,
+  `job_id` varchar(36) default null,
+  `source_line` int default null,
+  `person_id` bigint default null,
+  -- set on the replacements of erased customers
+  `erased_at` timestamp null default null,
+  primary key (`id`),
+  key `job_idx` (`job_id`),
+  key `person_idx` (`person_id`),
+  key `email_index_idx` (`email_index`)
+) engine=innodb default charset=utf8mb4 collate=utf8mb4_0900_ai_ci;
+
+-- golden record of a real person behind one or more customer ids; email_index
+-- is the blind index of the lower-cased email without +tag, name_key the
+-- soundex of the name
+create table `persons` (
+  `id` bigint not null auto_increment,
+  `name` varchar(100) not null,
+  `email` varchar(320) default null,
+  `email_index` char(64) default null,
   `region` varchar(50) default null,
   `address` text,
-  primary key (`id`)
+  `name_key` varchar(20) generated always as (soundex(`name`)) stored,
+  `created_at` timestamp null default current_timestamp,
+  primary key (`id`),
+  unique key `email_index_uq` (`email_index`),
+  key `name_key_idx` (`name_key`)
+) engine=innodb default charset=utf8mb4 collate=utf8mb4_0900_ai_ci;
+
+-- proposed merges of person_id into match_person_id awaiting review
+create table `merge_candidates` (
+  `id` bigint not null auto_increment,
+  `person_id` bigint not null,
+  `match_person_id` bigint not null,
+  `customer_id` varchar(50) not null,
+  `rule` varchar(20) not null,
+  `score` decimal(5,4) not null,
+  `status` varchar(20) not null,
+  `created_at` timestamp null default current_timestamp,
+  `decided_at` timestamp null default null,
+  primary key (`id`),
+  unique key `candidate_pair_uq` (`person_id`, `match_person_id`),
+  key `status_idx` (`status`)
+) engine=innodb default charset=utf8mb4 collate=utf8mb4_0900_ai_ci;
+
+-- customers erased on request, by the blind index of their id; rows of
+-- them in later loads go to replacement_id without their personal data.
+-- Kept through overwrite loads.
+create table `erased_subjects` (
+  `subject_hash` char(64) not null,
+  `replacement_id` varchar(50) not null,
+  `region` varchar(50) default null,
+  `mode` varchar(10) not null,
+  `erased_at` timestamp null default current_timestamp,
+  primary key (`subject_hash`)
+) engine=innodb default charset=utf8mb4 collate=utf8mb4_0900_ai_ci;
+
+create table `erasure_audit` (
+  `id` bigint not null auto_increment,
+  `subject_hash` char(64) not null,
+  `mode` varchar(10) not null,
+  `reason` varchar(255) default null,
+  `replacement_id` varchar(50) not null,
+  `orders` int not null,
+  `history_rows` int not null,
+  `erased_at` timestamp not null,
+  primary key (`id`),
+  key `subject_idx` (`subject_hash`)
+) engine=innodb default charset=utf8mb4 collate=utf8mb4_0900_ai_ci;
+
+-- value of one unit of currency in the base currency, in effect from
+-- rate_date until the next rate
+create table `fx_rates` (
+  `currency` char(3) not null,
+  `rate_date` date not null,
+  `rate` decimal(18,8) not null,
+  `created_at` timestamp null default current_timestamp,
+  `updated_at` timestamp null default current_timestamp on update current_timestamp,
+  primary key (`currency`, `rate_date`)
+) engine=innodb default charset=utf8mb4 collate=utf8mb4_0900_ai_ci;
+
+-- type-2 history of customer and product attributes, one open version
+-- (valid_to null) per entity enforced through is_current. seen_from is the
+-- order date a version was read on; versions are sequenced by it and span
+-- until the next one, the first from 1000-01-01.
+create table `customer_history` (
+  `id` bigint not null auto_increment,
+  `customer_id` varchar(50) not null,
+  `name` varchar(100) default null,
+  `email` varchar(320) default null,
+  `region` varchar(50) default null,
+  `address` text,
+  `email_index` char(64) default null,
+  `address_index` char(64) default null,
+  `seen_from` date not null,
+  `valid_from` date not null,
+  `valid_to` date default null,
+  `is_current` tinyint generated always as (if(`valid_to` is null, 1, null)) stored,
+  `source_job_id` varchar(36) default null,
+  `created_at` timestamp null default current_timestamp,
+  primary key (`id`),
+  unique key `customer_current_uq` (`customer_id`, `is_current`),
+  key `customer_valid_idx` (`customer_id`, `valid_from`),
+  key `customer_seen_idx` (`customer_id`, `seen_from`)
+) engine=innodb default charset=utf8mb4 collate=utf8mb4_0900_ai_ci;
+
+create table `product_history` (
+  `id` bigint not null auto_increment,
+  `product_id` varchar(50) not null,
+  `name` varchar(100) not null,
+  `category` varchar(50) default null,
+  `unit_price` decimal(12,2) not null,
+  `seen_from` date not null,
+  `valid_from` date not null,
+  `valid_to` date default null,
+  `is_current` tinyint generated always as (if(`valid_to` is null, 1, null)) stored,
+  `source_job_id` varchar(36) default null,
+  `created_at` timestamp null default current_timestamp,
+  primary key (`id`),
+  unique key `product_current_uq` (`product_id`, `is_current`),
+  key `product_valid_idx` (`product_id`, `valid_from`),
+  key `product_seen_idx` (`product_id`, `seen_from`)
+) engine=innodb default charset=utf8mb4 collate=utf8mb4_0900_ai_ci;
+
+-- prior images of rows an append job updated, keyed by the job that
+-- updated them; used to roll the job back
+create table `customer_undo` (
+  `job_id` varchar(36) not null,
+  `id` varchar(50) not null,
+  `name` varchar(100) default null,
+  `email` varchar(320) default null,
+  `region` varchar(50) default null,
+  `address` text,
+  `email_index` char(64) default null,
+  `address_index` char(64) default null,
+  `prev_job_id` varchar(36) default null,
+  `prev_source_line` int default null,
+  primary key (`job_id`, `id`),
+  key `prev_job_idx` (`prev_job_id`)
+) engine=innodb default charset=utf8mb4 collate=utf8mb4_0900_ai_ci;
+
+create table `product_undo` (
+  `job_id` varchar(36) not null,
+  `id` varchar(50) not null,
+  `name` varchar(100) not null,
+  `category` varchar(50) default null,
+  `unit_price` decimal(12,2) not null,
+  `prev_job_id` varchar(36) default null,
+  `prev_source_line` int default null,
+  primary key (`job_id`, `id`),
+  key `prev_job_idx` (`prev_job_id`)
+) engine=innodb default charset=utf8mb4 collate=utf8mb4_0900_ai_ci;
+
+create table `order_undo` (
+  `job_id` varchar(36) not null,
+  `id` varchar(50) not null,
+  `customer_id` varchar(50) not null,
+  `order_date` date not null,
+  `ordered_at` datetime default null,
+  `total_amount` decimal(14,2) not null,
+  `currency` char(3) default null,
+  `fx_rate` decimal(18,8) default null,
+  `prev_job_id` varchar(36) default null,
+  `prev_source_line` int default null,
+  primary key (`job_id`, `id`),
+  key `prev_job_idx` (`prev_job_id`)
+) engine=innodb default charset=utf8mb4 collate=utf8mb4_0900_ai_ci;
+
+create table `order_item_undo` (
+  `job_id` varchar(36) not null,
+  `order_id` varchar(50) not null,
+  `product_id` varchar(50) not null,
+  `quantity` int default null,
+  `unit_price` decimal(12,2) default null,
+  `discount` decimal(6,4) default null,
+  `shipping_cost` decimal(12,2) default null,
+  `currency` char(3) default null,
+  `fx_rate` decimal(18,8) default null,
+  `prev_job_id` varchar(36) default null,
+  `prev_source_line` int default null,
+  primary key (`job_id`, `order_id`, `product_id`),
+  key `prev_job_idx` (`prev_job_id`)
 ) engine=innodb default charset=utf8mb4 collate=utf8mb4_0900_ai_ci;
 
 create table `ingestion_jobs` (
@@ -46,7 +275,54 @@ create table `ingestion_jobs` (
   `total_rows` int default '0',
   `processed_rows` int default '0',
   `error_message` text,
+  `mode` varchar(20) default null,
+  `callback_url` varchar(2048) default null,
   `created_at` timestamp null default current_timestamp,
   `updated_at` timestamp null default current_timestamp on update current_timestamp,
   primary key (`job_id`)
 ) engine=innodb default charset=utf8mb4 collate=utf8mb4_0900_ai_ci;
+
+create table `webhook_deliveries` (
+  `id` bigint not null auto_increment,
+  `job_id` varchar(36) not null,
+  `url` varchar(2048) not null,
+  `event` varchar(30) not null,
+  `attempt` int not null,
+  `status_code` int default null,
+  `error_message` text,
+  `delivered` tinyint(1) not null default '0',
+  `duration_ms` int not null default '0',
+  `created_at` timestamp null default current_timestamp,
+  primary key (`id`),
+  key `job_idx` (`job_id`)
+) engine=innodb default charset=utf8mb4 collate=utf8mb4_0900_ai_ci;
+
+create table `upload_sessions` (
+  `id` varchar(36) not null,
+  `file_name` varchar(255) not null,
+  `total_size` bigint not null,
+  `received_bytes` bigint not null default '0',
+  `sha256` char(64) default null,
+  `mode` varchar(20) not null,
+  `callback_url` varchar(2048) default null,
+  `status` varchar(20) not null,
+  `job_id` varchar(36) default null,
+  `created_at` timestamp null default current_timestamp,
+  `updated_at` timestamp null default current_timestamp on update current_timestamp,
+  primary key (`id`),
+  key `idx_upload_sessions_status_updated` (`status`, `updated_at`)
+) engine=innodb default charset=utf8mb4 collate=utf8mb4_0900_ai_ci;
+
+-- upgrading a database loaded before amounts were converted to the base
+-- currency: those rows are in the base currency, set @base_currency to
+-- fx.base before running. Rows still without a rate afterwards are
+-- reported as unconverted by the revenue totals.
+set @base_currency = 'USD';
+update `orders` set `currency` = @base_currency, `fx_rate` = 1
+  where `currency` is null and `fx_rate` is null;
+update `order_items` set `currency` = @base_currency, `fx_rate` = 1
+  where `currency` is null and `fx_rate` is null;
+update `order_undo` set `currency` = @base_currency, `fx_rate` = 1
+  where `currency` is null and `fx_rate` is null;
+update `order_item_undo` set `currency` = @base_currency, `fx_rate` = 1
+  where `currency` is null and `fx_rate` is null;
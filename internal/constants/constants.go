@@ -1,9 +1,30 @@
 package constants
 
 const (
-	StatusRunning   = "running"
-	StatusCompleted = "completed"
-	StatusFailed    = "failed"
+	StatusRunning    = "running"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+	StatusCancelled  = "cancelled"
+	StatusRolledBack = "rolled_back"
+
+	ReturnKindReturn = "return"
+	ReturnKindRefund = "refund"
+
+	CandidatePending    = "pending"
+	CandidateApproved   = "approved"
+	CandidateRejected   = "rejected"
+	CandidateSuperseded = "superseded"
+
+	ErasureAnonymize = "anonymize"
+	ErasurePurge     = "purge"
+	// ErasedCustomerID holds the orders of purged customers
+	ErasedCustomerID = "erased"
+
+	ModeAppend    = "append"
+	ModeOverwrite = "overwrite"
+
+	UploadOpen      = "open"
+	UploadFinalized = "finalized"
 
 	LogRequest       = "request"
 	LogIngestStart   = "ingest_start"
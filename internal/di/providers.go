@@ -6,6 +6,7 @@ import (
 	"database/sql"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -15,8 +16,16 @@ import (
 	"sales-analytics/internal/handler"
 	"sales-analytics/internal/repository"
 	"sales-analytics/internal/service/analytics"
+	"sales-analytics/internal/service/export"
+	"sales-analytics/internal/service/fx"
+	"sales-analytics/internal/service/identity"
 	"sales-analytics/internal/service/ingestion"
+	"sales-analytics/internal/service/privacy"
+	"sales-analytics/internal/service/upload"
+	"sales-analytics/internal/service/webhook"
 	"sales-analytics/pkg/orm"
+	"sales-analytics/pkg/pii"
+	"sales-analytics/pkg/s3"
 )
 
 func ProvideLogger(
@@ -35,22 +44,64 @@ func ProvideDB(
 	config config.Config,
 	logger *zap.Logger,
 ) (*sql.DB, error) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s",
+	return openDB(config, config.DB.Analytics, defaultAnalyticsConns, "analytics", logger)
+}
+
+// ProvideIngestionDB opens the pool used exclusively by ingestion workers
+func ProvideIngestionDB(
+	config config.Config,
+	logger *zap.Logger,
+) (ingestion.DB, error) {
+	db, err := openDB(config, config.DB.Ingestion, defaultIngestionConns, "ingestion", logger)
+	if err != nil {
+		return ingestion.DB{}, err
+	}
+	return ingestion.DB{DB: db}, nil
+}
+
+const (
+	defaultAnalyticsConns = 10
+	defaultIngestionConns = 30
+)
+
+func openDB(
+	config config.Config,
+	pool config.Pool,
+	defaultConns int,
+	name string,
+	logger *zap.Logger,
+) (*sql.DB, error) {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
 		config.DB.User, config.DB.Password, config.DB.Host, config.DB.Port, config.DB.Name)
 
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database connection: %w", err)
+		return nil, fmt.Errorf("failed to open %s database connection: %w", name, err)
+	}
+
+	if pool.MaxOpen <= 0 {
+		pool.MaxOpen = defaultConns
+	}
+	if pool.MaxIdle <= 0 {
+		pool.MaxIdle = pool.MaxOpen / 2
+	}
+	if pool.MaxLifetime <= 0 {
+		pool.MaxLifetime = 5 * time.Minute
 	}
+	db.SetMaxOpenConns(pool.MaxOpen)
+	db.SetMaxIdleConns(pool.MaxIdle)
+	db.SetConnMaxLifetime(pool.MaxLifetime)
 
 	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+		return nil, fmt.Errorf("failed to ping %s database: %w", name, err)
 	}
 
 	logger.Info("Connected to MySQL database",
+		zap.String("pool", name),
 		zap.String("host", config.DB.Host),
 		zap.String("port", config.DB.Port),
-		zap.String("name", config.DB.Name))
+		zap.String("name", config.DB.Name),
+		zap.Int("max_open_conns", pool.MaxOpen))
 
 	return db, nil
 }
@@ -67,20 +118,109 @@ func ProvideJobRepository(
 	return repository.NewJobRepo(store)
 }
 
+func ProvideWebhookRepository(
+	store *orm.Store,
+) repository.WebhookRepository {
+	return repository.NewWebhookRepo(store)
+}
+
+func ProvideWebhookService(
+	config config.Config,
+	jobRepo repository.JobRepository,
+	webhookRepo repository.WebhookRepository,
+	logger *zap.Logger,
+) (webhook.Service, error) {
+	return webhook.New(config.Webhook, jobRepo, webhookRepo, logger)
+}
+
+func ProvideUploadRepository(
+	store *orm.Store,
+) repository.UploadRepository {
+	return repository.NewUploadRepo(store)
+}
+
+func ProvideUploadService(
+	config config.Config,
+	uploadRepo repository.UploadRepository,
+	jobRepo repository.JobRepository,
+	ingestionSvc ingestion.Service,
+	logger *zap.Logger,
+) (upload.Service, error) {
+	return upload.New(config.Upload, uploadRepo, jobRepo, ingestionSvc, logger)
+}
+
+func ProvideFXService(
+	config config.Config,
+	db *sql.DB,
+	logger *zap.Logger,
+) (fx.Service, error) {
+	return fx.New(db, config.FX.Base, logger)
+}
+
+func ProvideKeyring(
+	config config.Config,
+	logger *zap.Logger,
+) (*pii.Keyring, error) {
+	keys, err := pii.New(pii.Config{
+		ActiveKey: config.PII.ActiveKey,
+		Keys:      config.PII.Keys,
+		IndexKey:  config.PII.IndexKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !keys.Enabled() {
+		logger.Warn("pii encryption keys not configured, customer emails and addresses are stored in plaintext")
+	}
+	return keys, nil
+}
+
+func ProvidePrivacyService(
+	db *sql.DB,
+	keys *pii.Keyring,
+	logger *zap.Logger,
+) privacy.Service {
+	return privacy.New(db, keys, logger)
+}
+
+func ProvideExportService(
+	db *sql.DB,
+	keys *pii.Keyring,
+	logger *zap.Logger,
+) export.Service {
+	return export.New(db, keys, logger)
+}
+
+func ProvideIdentityService(
+	db *sql.DB,
+	keys *pii.Keyring,
+	logger *zap.Logger,
+) identity.Service {
+	return identity.New(db, keys, logger)
+}
+
 func ProvideAnalyticsService(
+	config config.Config,
 	db *sql.DB,
+	fxSvc fx.Service,
 	logger *zap.Logger,
 ) analytics.Service {
-	return analytics.New(db, logger)
+	return analytics.New(db, fxSvc, config.Analytics.CLV, logger)
 }
 
 func ProvideIngestionService(
-	db *sql.DB,
+	config config.Config,
+	db ingestion.DB,
 	jobRepo repository.JobRepository,
+	webhookSvc webhook.Service,
+	identitySvc identity.Service,
+	fxSvc fx.Service,
+	keys *pii.Keyring,
+	s3Client *s3.Client,
 	logger *zap.Logger,
 	csvPath string,
-) ingestion.Service {
-	return ingestion.New(db, jobRepo, logger, csvPath)
+) (ingestion.Service, error) {
+	return ingestion.New(db, jobRepo, webhookSvc, identitySvc, fxSvc, keys, s3Client, logger, csvPath, config.Dates)
 }
 
 func ProvideGin(
@@ -89,14 +229,34 @@ func ProvideGin(
 	jobRepo repository.JobRepository,
 	ingestionSvc ingestion.Service,
 	analyticsSvc analytics.Service,
+	webhookSvc webhook.Service,
+	uploadSvc upload.Service,
+	fxSvc fx.Service,
+	identitySvc identity.Service,
+	privacySvc privacy.Service,
+	exportSvc export.Service,
 ) *gin.Engine {
 	r := gin.New()
 
-	ingHandler := handler.Ingestion{Service: ingestionSvc, Jobs: jobRepo, Log: logger}
+	ingHandler := handler.Ingestion{
+		Service:       ingestionSvc,
+		Jobs:          jobRepo,
+		Log:           logger,
+		MaxStreamSize: config.Upload.MaxStreamSize,
+		S3Buckets:     config.S3.Buckets,
+		Callbacks:     config.Webhook.Secret != "",
+	}
 	statusHandler := handler.Status{Jobs: jobRepo, Log: logger}
-	analyticsHandler := handler.Analytics{Service: analyticsSvc, Log: logger}
+	analyticsHandler := handler.Analytics{Service: analyticsSvc, Log: logger, BaseCurrency: fxSvc.Base()}
+	webhookHandler := handler.Webhook{Service: webhookSvc, Log: logger}
+	uploadHandler := handler.Uploads{Service: uploadSvc, Log: logger, Callbacks: config.Webhook.Secret != ""}
+	fxHandler := handler.FX{Service: fxSvc, Log: logger}
+	identityHandler := handler.Identity{Service: identitySvc, Log: logger}
+	privacyHandler := handler.Privacy{Service: privacySvc, Log: logger}
+	exportHandler := handler.Export{Service: exportSvc, Log: logger}
 
-	internal.RegisterRoutes(r, ingHandler, statusHandler, analyticsHandler)
+	internal.RegisterRoutes(r, ingHandler, statusHandler, analyticsHandler, webhookHandler, uploadHandler, fxHandler,
+		identityHandler, privacyHandler, exportHandler)
 
 	return r
 }
@@ -115,6 +275,19 @@ func ProvideHTTP(
 	}
 }
 
+func ProvideS3Client(
+	config config.Config,
+) *s3.Client {
+	return s3.New(s3.Config{
+		Endpoint:     config.S3.Endpoint,
+		Region:       config.S3.Region,
+		AccessKey:    config.S3.AccessKey,
+		SecretKey:    config.S3.SecretKey,
+		SessionToken: config.S3.SessionToken,
+		PathStyle:    config.S3.PathStyle,
+	})
+}
+
 func ProvideCsvPath(
 	config config.Config,
 ) string {
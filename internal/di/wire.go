@@ -16,10 +16,21 @@ func Init() (*http.Server, error) {
 		config.Load,
 		ProvideLogger,
 		ProvideDB,
+		ProvideIngestionDB,
 		ProvideStore,
 		ProvideJobRepository,
+		ProvideWebhookRepository,
+		ProvideWebhookService,
+		ProvideS3Client,
+		ProvideFXService,
+		ProvideKeyring,
+		ProvidePrivacyService,
+		ProvideIdentityService,
+		ProvideExportService,
 		ProvideCsvPath,
 		ProvideIngestionService,
+		ProvideUploadRepository,
+		ProvideUploadService,
 		ProvideAnalyticsService,
 		ProvideGin,
 		ProvideHTTP,
@@ -1,11 +1,15 @@
 package handler
 
 import (
+	"errors"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
 
+	"sales-analytics/internal/models"
 	"sales-analytics/internal/service/analytics"
+	"sales-analytics/internal/service/fx"
 	"sales-analytics/internal/utils"
 
 	"github.com/gin-gonic/gin"
@@ -15,61 +19,109 @@ import (
 type Analytics struct {
 	Service analytics.Service
 	Log     *zap.Logger
+
+	// BaseCurrency is reported when no currency is requested
+	BaseCurrency string
 }
 
 // Revenue is a unified endpoint for all revenue-related analytics
 // Query parameters:
 // - start_date: start of the date range (default: 1 year ago)
 // - end_date: end of the date range (default: today)
-// - type: revenue calculation type (total, product, category, region, trend)
-// - interval: for trend analysis (monthly, quarterly, yearly)
+// - type: revenue calculation type (total, product, category, region, top_products, customers, trend)
+// - interval: for trend analysis (daily, weekly, monthly, quarterly, yearly; default: monthly)
+// - split: for trend analysis, one series per category or region
 // - limit: number of items to return (default: 10)
+// - attribution: current or order_date attributes for region/category/product (default: current)
+// - currency: ISO currency code to report amounts in (default: base currency)
+// - compare: previous, yoy or custom, adds the change against that period to
+// every row (not for trend)
+// - compare_start, compare_end: the period of compare=custom
 func (
 	h *Analytics,
 ) Revenue(
 	c *gin.Context,
 ) {
-	start, end := h.getDateRange(c)
+	f, err := h.getFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	start, end := f.Start, f.End
 	calculationType := c.DefaultQuery("type", "total")
 
+	prev, err := h.getComparison(c, f)
+	if err == nil && prev != nil && calculationType == "trend" {
+		err = errors.New("compare is not supported for trend")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	logFields := []zap.Field{
 		zap.String("calculation", calculationType),
 		zap.String("start_date", start),
 		zap.String("end_date", end),
+		zap.String("attribution", string(f.Attribution)),
+		zap.String("currency", f.Currency),
 	}
 
-	var result interface{}
+	var result gin.H
 
 	switch calculationType {
 	case "total":
-		revenue, err := h.Service.Total(c.Request.Context(), start, end)
+		revenue, err := h.Service.Total(c.Request.Context(), f)
 		if err != nil {
-			h.Log.Error("Failed to calculate total revenue", append(logFields, zap.Error(err))...)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate total revenue"})
+			h.fail(c, "Failed to calculate total revenue", "Failed to calculate total revenue", err, logFields)
 			return
 		}
+		var change map[string]*models.Change
+		if prev != nil {
+			before, err := h.Service.Total(c.Request.Context(), *prev)
+			if err != nil {
+				h.fail(c, "Failed to calculate total revenue", "Failed to calculate total revenue", err, logFields)
+				return
+			}
+			change = analytics.CompareTotals(revenue, before)
+		}
 
 		result = gin.H{
 			"calculation": "total_revenue",
-			"result":      revenue,
+			"result":      revenue.Gross,
+			"returns":     revenue.Returns,
+			"net":         revenue.Net,
+			"unconverted": revenue.Unconverted,
+			"currency":    f.Currency,
 			"period": gin.H{
 				"start_date": start,
 				"end_date":   end,
 			},
 		}
+		if change != nil {
+			result["change"] = change
+		}
 
 	case "product":
-		products, err := h.Service.ByProduct(c.Request.Context(), start, end)
+		products, err := h.Service.ByProduct(c.Request.Context(), f)
 		if err != nil {
-			h.Log.Error("Failed to calculate revenue by product", append(logFields, zap.Error(err))...)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate revenue by product"})
+			h.fail(c, "Failed to calculate revenue by product", "Failed to calculate revenue by product", err, logFields)
 			return
 		}
+		if prev != nil {
+			before, err := h.Service.ByProduct(c.Request.Context(), *prev)
+			if err != nil {
+				h.fail(c, "Failed to calculate revenue by product", "Failed to calculate revenue by product", err, logFields)
+				return
+			}
+			products = analytics.CompareProducts(products, before)
+		}
 
 		result = gin.H{
 			"calculation": "revenue_by_product",
 			"count":       len(products),
 			"products":    products,
+			"currency":    f.Currency,
 			"period": gin.H{
 				"start_date": start,
 				"end_date":   end,
@@ -77,17 +129,25 @@ func (
 		}
 
 	case "category":
-		categories, err := h.Service.ByCategory(c.Request.Context(), start, end)
+		categories, err := h.Service.ByCategory(c.Request.Context(), f)
 		if err != nil {
-			h.Log.Error("Failed to calculate revenue by category", append(logFields, zap.Error(err))...)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate revenue by category"})
+			h.fail(c, "Failed to calculate revenue by category", "Failed to calculate revenue by category", err, logFields)
 			return
 		}
+		if prev != nil {
+			before, err := h.Service.ByCategory(c.Request.Context(), *prev)
+			if err != nil {
+				h.fail(c, "Failed to calculate revenue by category", "Failed to calculate revenue by category", err, logFields)
+				return
+			}
+			categories = analytics.CompareCategories(categories, before)
+		}
 
 		result = gin.H{
 			"calculation": "revenue_by_category",
 			"count":       len(categories),
 			"categories":  categories,
+			"currency":    f.Currency,
 			"period": gin.H{
 				"start_date": start,
 				"end_date":   end,
@@ -95,17 +155,25 @@ func (
 		}
 
 	case "region":
-		regions, err := h.Service.ByRegion(c.Request.Context(), start, end)
+		regions, err := h.Service.ByRegion(c.Request.Context(), f)
 		if err != nil {
-			h.Log.Error("Failed to calculate revenue by region", append(logFields, zap.Error(err))...)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate revenue by region"})
+			h.fail(c, "Failed to calculate revenue by region", "Failed to calculate revenue by region", err, logFields)
 			return
 		}
+		if prev != nil {
+			before, err := h.Service.ByRegion(c.Request.Context(), *prev)
+			if err != nil {
+				h.fail(c, "Failed to calculate revenue by region", "Failed to calculate revenue by region", err, logFields)
+				return
+			}
+			regions = analytics.CompareRegions(regions, before)
+		}
 
 		result = gin.H{
 			"calculation": "revenue_by_region",
 			"count":       len(regions),
 			"regions":     regions,
+			"currency":    f.Currency,
 			"period": gin.H{
 				"start_date": start,
 				"end_date":   end,
@@ -116,18 +184,79 @@ func (
 		limit := h.getLimit(c)
 		logFields = append(logFields, zap.Int("limit", limit))
 
-		products, err := h.Service.TopProducts(c.Request.Context(), start, end, limit)
+		products, err := h.Service.TopProducts(c.Request.Context(), f, limit)
 		if err != nil {
-			h.Log.Error("Failed to get top products", append(logFields, zap.Error(err))...)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate top products"})
+			h.fail(c, "Failed to get top products", "Failed to calculate top products", err, logFields)
 			return
 		}
+		if prev != nil {
+			// every product of the comparison period, a product may have
+			// been outside the top there
+			before, err := h.Service.TopProducts(c.Request.Context(), *prev, math.MaxInt32)
+			if err != nil {
+				h.fail(c, "Failed to get top products", "Failed to calculate top products", err, logFields)
+				return
+			}
+			analytics.CompareTopProducts(products, before)
+		}
 
 		result = gin.H{
 			"calculation": "top_products",
 			"count":       len(products),
 			"limit":       limit,
 			"products":    products,
+			"currency":    f.Currency,
+			"period": gin.H{
+				"start_date": start,
+				"end_date":   end,
+			},
+		}
+
+	case "customers":
+		count, err := h.Service.CustomerCount(c.Request.Context(), f)
+		if err != nil {
+			h.fail(c, "Failed to count customers", "Failed to count customers", err, logFields)
+			return
+		}
+		var change *models.Change
+		if prev != nil {
+			before, err := h.Service.CustomerCount(c.Request.Context(), *prev)
+			if err != nil {
+				h.fail(c, "Failed to count customers", "Failed to count customers", err, logFields)
+				return
+			}
+			change = models.NewChange(float64(count), float64(before))
+		}
+
+		result = gin.H{
+			"calculation": "unique_customers",
+			"result":      count,
+			"period": gin.H{
+				"start_date": start,
+				"end_date":   end,
+			},
+		}
+		if change != nil {
+			result["change"] = change
+		}
+
+	case "trend":
+		interval := c.DefaultQuery("interval", models.IntervalMonthly)
+		split := c.Query("split")
+		logFields = append(logFields, zap.String("interval", interval), zap.String("split", split))
+
+		series, err := h.Service.Trend(c.Request.Context(), f, interval, split)
+		if err != nil {
+			h.fail(c, "Failed to calculate revenue trend", "Failed to calculate revenue trend", err, logFields)
+			return
+		}
+
+		result = gin.H{
+			"calculation": "revenue_trend",
+			"interval":    interval,
+			"split":       split,
+			"series":      series,
+			"currency":    f.Currency,
 			"period": gin.H{
 				"start_date": start,
 				"end_date":   end,
@@ -139,10 +268,631 @@ func (
 		return
 	}
 
+	if prev != nil {
+		result["comparison_period"] = gin.H{
+			"start_date": prev.Start,
+			"end_date":   prev.End,
+		}
+	}
+
 	h.Log.Info("Revenue calculation completed", logFields...)
 	c.JSON(http.StatusOK, utils.SuccessResponse("data", result))
 }
 
+// Cohorts returns the retention triangle of the customers whose first order
+// falls in the period
+// Query parameters:
+// - start_date, end_date, currency: as for Revenue
+// - granularity: monthly or quarterly (default: monthly)
+func (
+	h *Analytics,
+) Cohorts(
+	c *gin.Context,
+) {
+	f, err := h.getFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	granularity := c.DefaultQuery("granularity", models.CohortMonthly)
+
+	logFields := []zap.Field{
+		zap.String("start_date", f.Start),
+		zap.String("end_date", f.End),
+		zap.String("granularity", granularity),
+	}
+
+	cohorts, err := h.Service.Cohorts(c.Request.Context(), f, granularity)
+	if err != nil {
+		h.fail(c, "Failed to calculate cohorts", "Failed to calculate cohorts", err, logFields)
+		return
+	}
+
+	h.Log.Info("Cohort calculation completed", logFields...)
+	c.JSON(http.StatusOK, utils.SuccessResponse("data", gin.H{
+		"granularity": granularity,
+		"count":       len(cohorts),
+		"cohorts":     cohorts,
+		"currency":    f.Currency,
+		"period": gin.H{
+			"start_date": f.Start,
+			"end_date":   f.End,
+		},
+	}))
+}
+
+// RFM returns the recency, frequency and monetary segments of the customers
+// Query parameters:
+// - as_of: reference date recency is measured from, later orders are
+// ignored (default: today)
+// - currency: as for Revenue
+func (
+	h *Analytics,
+) RFM(
+	c *gin.Context,
+) {
+	f, err := h.getAsOf(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	logFields := []zap.Field{zap.String("as_of", f.End)}
+
+	segments, err := h.Service.RFMSegments(c.Request.Context(), f)
+	if err != nil {
+		h.fail(c, "Failed to calculate rfm segments", "Failed to calculate rfm segments", err, logFields)
+		return
+	}
+
+	h.Log.Info("RFM segmentation completed", logFields...)
+	c.JSON(http.StatusOK, utils.SuccessResponse("data", gin.H{
+		"as_of":    f.End,
+		"segments": segments,
+		"currency": f.Currency,
+	}))
+}
+
+// RFMCustomers lists the scored customers, best first
+// Query parameters:
+// - as_of, currency: as for RFM
+// - segment: only customers of the segment
+// - limit: page size (default: 50, max: 1000)
+// - offset: customers to skip (default: 0)
+func (
+	h *Analytics,
+) RFMCustomers(
+	c *gin.Context,
+) {
+	f, err := h.getAsOf(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit, expected 1 to 1000"})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+		return
+	}
+	segment := c.Query("segment")
+
+	logFields := []zap.Field{
+		zap.String("as_of", f.End),
+		zap.String("segment", segment),
+		zap.Int("limit", limit),
+		zap.Int("offset", offset),
+	}
+
+	page, err := h.Service.RFMCustomers(c.Request.Context(), f, segment, limit, offset)
+	if err != nil {
+		h.fail(c, "Failed to list rfm customers", "Failed to list rfm customers", err, logFields)
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.SuccessResponse("data", gin.H{
+		"as_of":    f.End,
+		"segment":  segment,
+		"page":     page,
+		"currency": f.Currency,
+	}))
+}
+
+// CLV returns the customers with the highest predicted lifetime value
+// Query parameters:
+// - as_of, currency: as for RFM
+// - limit: number of customers to return (default: 10)
+func (
+	h *Analytics,
+) CLV(
+	c *gin.Context,
+) {
+	f, err := h.getAsOf(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit := h.getLimit(c)
+	logFields := []zap.Field{zap.String("as_of", f.End), zap.Int("limit", limit)}
+
+	model, customers, err := h.Service.TopCLV(c.Request.Context(), f, limit)
+	if err != nil {
+		h.fail(c, "Failed to estimate clv", "Failed to estimate customer lifetime value", err, logFields)
+		return
+	}
+
+	h.Log.Info("CLV estimation completed", logFields...)
+	c.JSON(http.StatusOK, utils.SuccessResponse("data", gin.H{
+		"as_of":     f.End,
+		"model":     model,
+		"customers": customers,
+		"currency":  f.Currency,
+	}))
+}
+
+// CLVByRegion returns the average predicted lifetime value per region
+// Query parameters:
+// - as_of, currency: as for RFM
+func (
+	h *Analytics,
+) CLVByRegion(
+	c *gin.Context,
+) {
+	f, err := h.getAsOf(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	logFields := []zap.Field{zap.String("as_of", f.End)}
+
+	model, regions, err := h.Service.CLVByRegion(c.Request.Context(), f)
+	if err != nil {
+		h.fail(c, "Failed to estimate clv by region", "Failed to estimate customer lifetime value", err, logFields)
+		return
+	}
+
+	c.JSON(http.StatusOK, utils.SuccessResponse("data", gin.H{
+		"as_of":    f.End,
+		"model":    model,
+		"regions":  regions,
+		"currency": f.Currency,
+	}))
+}
+
+// Basket returns the product pairs most often bought in the same order
+// Query parameters:
+// - start_date, end_date: as for Revenue
+// - min_support: minimum share of orders with both products, above 0 and
+// at most 1 (default: 0.01)
+// - min_confidence: minimum share of orders with one product that also
+// have the other (default: 0)
+// - min_lift: minimum lift (default: 0)
+// - limit: number of pairs to return (default: 10)
+func (
+	h *Analytics,
+) Basket(
+	c *gin.Context,
+) {
+	h.basket(c, "")
+}
+
+// BasketProduct returns the products frequently bought with the product,
+// with the same parameters as Basket
+func (
+	h *Analytics,
+) BasketProduct(
+	c *gin.Context,
+) {
+	id := c.Param("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Product ID is required"})
+		return
+	}
+	h.basket(c, id)
+}
+
+func (
+	h *Analytics,
+) basket(
+	c *gin.Context,
+	productID string,
+) {
+	f, err := h.getFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	start, end := f.Start, f.End
+
+	opts := models.BasketOptions{Limit: h.getLimit(c), ProductID: productID}
+	for _, p := range []struct {
+		name string
+		def  string
+		dest *float64
+	}{
+		{"min_support", "0.01", &opts.MinSupport},
+		{"min_confidence", "0", &opts.MinConfidence},
+		{"min_lift", "0", &opts.MinLift},
+	} {
+		v, err := strconv.ParseFloat(c.DefaultQuery(p.name, p.def), 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + p.name})
+			return
+		}
+		*p.dest = v
+	}
+
+	logFields := []zap.Field{
+		zap.String("start_date", start),
+		zap.String("end_date", end),
+		zap.String("product_id", productID),
+		zap.Float64("min_support", opts.MinSupport),
+	}
+
+	result, err := h.Service.Basket(c.Request.Context(), f, opts)
+	if err != nil {
+		h.fail(c, "Failed to analyze baskets", "Failed to analyze baskets", err, logFields)
+		return
+	}
+
+	h.Log.Info("Basket analysis completed", append(logFields, zap.Int("pairs", len(result.Pairs)))...)
+	c.JSON(http.StatusOK, utils.SuccessResponse("data", gin.H{
+		"product_id": productID,
+		"orders":     result.Orders,
+		"count":      len(result.Pairs),
+		"pairs":      result.Pairs,
+		"period": gin.H{
+			"start_date": start,
+			"end_date":   end,
+		},
+	}))
+}
+
+// ABC classes products or customers by their share of revenue
+// Query parameters:
+// - start_date, end_date, attribution, currency: as for Revenue
+// - entity: products or customers (default: products)
+// - a: cumulative revenue share of class A (default: 0.8)
+// - b: cumulative revenue share of classes A and B (default: 0.95)
+func (
+	h *Analytics,
+) ABC(
+	c *gin.Context,
+) {
+	f, err := h.getFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	a, errA := strconv.ParseFloat(c.DefaultQuery("a", "0.8"), 64)
+	b, errB := strconv.ParseFloat(c.DefaultQuery("b", "0.95"), 64)
+	if errA != nil || errB != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": analytics.ErrInvalidThresholds.Error()})
+		return
+	}
+	entity := c.DefaultQuery("entity", models.ABCProducts)
+
+	logFields := []zap.Field{
+		zap.String("entity", entity),
+		zap.String("start_date", f.Start),
+		zap.String("end_date", f.End),
+	}
+
+	result, err := h.Service.ABC(c.Request.Context(), f, entity, a, b)
+	if err != nil {
+		h.fail(c, "Failed to run abc analysis", "Failed to run ABC analysis", err, logFields)
+		return
+	}
+
+	h.Log.Info("ABC analysis completed", logFields...)
+	c.JSON(http.StatusOK, utils.SuccessResponse("data", gin.H{
+		"abc":      result,
+		"currency": f.Currency,
+		"period": gin.H{
+			"start_date": f.Start,
+			"end_date":   f.End,
+		},
+	}))
+}
+
+// Forecast predicts revenue for the intervals after the period
+// Query parameters:
+// - start_date: start of the history (default: 3 years before end_date)
+// - end_date, attribution, currency: as for Revenue
+// - interval, split: as for the trend of Revenue (default: monthly)
+// - periods: number of intervals to forecast (default: 6, max: 366)
+// - level: prediction interval in percent, 80, 90, 95 or 99 (default: 95)
+func (
+	h *Analytics,
+) Forecast(
+	c *gin.Context,
+) {
+	f, err := h.getFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if c.Query("start_date") == "" {
+		end, err := time.Parse("2006-01-02", f.End)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date, expected YYYY-MM-DD"})
+			return
+		}
+		f.Start = end.AddDate(-3, 0, 0).Format("2006-01-02")
+	}
+	periods, err := strconv.Atoi(c.DefaultQuery("periods", "6"))
+	if err != nil || periods <= 0 || periods > 366 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid periods, expected 1 to 366"})
+		return
+	}
+	level, err := strconv.Atoi(c.DefaultQuery("level", "95"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": analytics.ErrInvalidLevel.Error()})
+		return
+	}
+	interval := c.DefaultQuery("interval", models.IntervalMonthly)
+	split := c.Query("split")
+
+	logFields := []zap.Field{
+		zap.String("start_date", f.Start),
+		zap.String("end_date", f.End),
+		zap.String("interval", interval),
+		zap.String("split", split),
+		zap.Int("periods", periods),
+	}
+
+	series, err := h.Service.Forecast(c.Request.Context(), f, interval, split, periods, level)
+	if err != nil {
+		h.fail(c, "Failed to forecast revenue", "Failed to forecast revenue", err, logFields)
+		return
+	}
+
+	h.Log.Info("Revenue forecast completed", logFields...)
+	c.JSON(http.StatusOK, utils.SuccessResponse("data", gin.H{
+		"interval": interval,
+		"split":    split,
+		"periods":  periods,
+		"level":    level,
+		"series":   series,
+		"currency": f.Currency,
+		"period": gin.H{
+			"start_date": f.Start,
+			"end_date":   f.End,
+		},
+	}))
+}
+
+// getAsOf returns a filter ending on the as_of date
+func (
+	h *Analytics,
+) getAsOf(
+	c *gin.Context,
+) (models.Filter, error) {
+	asOf := c.DefaultQuery("as_of", time.Now().Format("2006-01-02"))
+	if _, err := time.Parse("2006-01-02", asOf); err != nil {
+		return models.Filter{}, errors.New("Invalid as_of, expected YYYY-MM-DD")
+	}
+	return h.newFilter(asOf, asOf, string(models.AttributionCurrent), c.Query("currency"))
+}
+
+type queryRequest struct {
+	StartDate   string `json:"start_date"`
+	EndDate     string `json:"end_date"`
+	Attribution string `json:"attribution"`
+	Currency    string `json:"currency"`
+	models.AnalyticsQuery
+}
+
+// Query runs an ad hoc analytics query of metrics grouped by dimensions
+// Body: start_date, end_date, attribution and currency as for Revenue, plus
+// metrics, dimensions, filters, sort and limit
+func (
+	h *Analytics,
+) Query(
+	c *gin.Context,
+) {
+	var req queryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	start, end := h.getDateRange(c)
+	if req.StartDate != "" {
+		start = req.StartDate
+	}
+	if req.EndDate != "" {
+		end = req.EndDate
+	}
+	if req.Attribution == "" {
+		req.Attribution = string(models.AttributionCurrent)
+	}
+	f, err := h.newFilter(start, end, req.Attribution, req.Currency)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	q := req.AnalyticsQuery
+	q.Filter = f
+
+	logFields := []zap.Field{
+		zap.String("start_date", f.Start),
+		zap.String("end_date", f.End),
+		zap.Strings("metrics", q.Metrics),
+		zap.Strings("dimensions", q.Dimensions),
+	}
+
+	result, err := h.Service.Query(c.Request.Context(), q)
+	if err != nil {
+		h.fail(c, "Failed to run analytics query", "Failed to run analytics query", err, logFields)
+		return
+	}
+
+	h.Log.Info("Analytics query completed", append(logFields, zap.Int("rows", len(result.Rows)))...)
+	c.JSON(http.StatusOK, utils.SuccessResponse("data", gin.H{
+		"columns":  result.Columns,
+		"rows":     result.Rows,
+		"currency": f.Currency,
+		"period": gin.H{
+			"start_date": f.Start,
+			"end_date":   f.End,
+		},
+	}))
+}
+
+// KPIs returns the headline metrics of a period in one response
+// Query parameters:
+// - start_date, end_date, attribution, currency: as for Revenue
+// - region: only sales to customers in the region
+// - category: only sales of products in the category
+// - compare, compare_start, compare_end: as for Revenue
+func (
+	h *Analytics,
+) KPIs(
+	c *gin.Context,
+) {
+	f, err := h.getFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	f.Region = c.Query("region")
+	f.Category = c.Query("category")
+
+	prev, err := h.getComparison(c, f)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	logFields := []zap.Field{
+		zap.String("start_date", f.Start),
+		zap.String("end_date", f.End),
+		zap.String("region", f.Region),
+		zap.String("category", f.Category),
+		zap.String("currency", f.Currency),
+	}
+
+	kpis, err := h.Service.KPIs(c.Request.Context(), f)
+	if err != nil {
+		h.fail(c, "Failed to calculate KPIs", "Failed to calculate KPIs", err, logFields)
+		return
+	}
+
+	result := gin.H{
+		"kpis":     kpis,
+		"region":   f.Region,
+		"category": f.Category,
+		"currency": f.Currency,
+		"period": gin.H{
+			"start_date": f.Start,
+			"end_date":   f.End,
+		},
+	}
+
+	if prev != nil {
+		before, err := h.Service.KPIs(c.Request.Context(), *prev)
+		if err != nil {
+			h.fail(c, "Failed to calculate KPIs", "Failed to calculate KPIs", err, logFields)
+			return
+		}
+		result["change"] = gin.H{
+			"revenue":             analytics.CompareTotals(kpis.Revenue, before.Revenue),
+			"customers":           models.NewChange(float64(kpis.Customers), float64(before.Customers)),
+			"orders":              models.NewChange(float64(kpis.Orders), float64(before.Orders)),
+			"average_order_value": models.NewChange(kpis.AverageOrderValue, before.AverageOrderValue),
+		}
+		result["comparison_period"] = gin.H{
+			"start_date": prev.Start,
+			"end_date":   prev.End,
+		}
+	}
+
+	h.Log.Info("KPI calculation completed", logFields...)
+	c.JSON(http.StatusOK, utils.SuccessResponse("data", result))
+}
+
+func (
+	h *Analytics,
+) getFilter(
+	c *gin.Context,
+) (models.Filter, error) {
+	start, end := h.getDateRange(c)
+	return h.newFilter(start, end, c.DefaultQuery("attribution", string(models.AttributionCurrent)), c.Query("currency"))
+}
+
+// getComparison returns the filter of the comparison period, nil when no
+// comparison is requested
+func (
+	h *Analytics,
+) getComparison(
+	c *gin.Context,
+	f models.Filter,
+) (*models.Filter, error) {
+	mode := c.Query("compare")
+	if mode == "" {
+		return nil, nil
+	}
+	prev, err := analytics.ComparisonPeriod(f, mode, c.Query("compare_start"), c.Query("compare_end"))
+	if err != nil {
+		return nil, err
+	}
+	return &prev, nil
+}
+
+func (
+	h *Analytics,
+) newFilter(
+	start, end, attribution, currency string,
+) (models.Filter, error) {
+	f := models.Filter{
+		Start:       start,
+		End:         end,
+		Attribution: models.Attribution(attribution),
+		Currency:    h.BaseCurrency,
+	}
+	switch f.Attribution {
+	case models.AttributionCurrent, models.AttributionOrderDate:
+	default:
+		return f, errors.New("Invalid attribution, expected current or order_date")
+	}
+
+	if currency != "" {
+		code, ok := fx.NormalizeCurrency(currency)
+		if !ok {
+			return f, errors.New("Invalid currency, expected a 3 letter code")
+		}
+		f.Currency = code
+	}
+	return f, nil
+}
+
+// fail responds 400 when the requested currency has no rate or a parameter
+// is invalid, 500 otherwise
+func (
+	h *Analytics,
+) fail(
+	c *gin.Context,
+	logMsg, msg string,
+	err error,
+	logFields []zap.Field,
+) {
+	h.Log.Error(logMsg, append(logFields, zap.Error(err))...)
+	if errors.Is(err, fx.ErrNoRate) || errors.Is(err, analytics.ErrInvalidInterval) ||
+		errors.Is(err, analytics.ErrInvalidSplit) || errors.Is(err, analytics.ErrInvalidQuery) ||
+		errors.Is(err, analytics.ErrInvalidGranularity) || errors.Is(err, analytics.ErrInvalidSegment) ||
+		errors.Is(err, analytics.ErrInvalidThreshold) || errors.Is(err, analytics.ErrInvalidEntity) ||
+		errors.Is(err, analytics.ErrInvalidThresholds) || errors.Is(err, analytics.ErrShortHistory) ||
+		errors.Is(err, analytics.ErrInvalidLevel) || errors.Is(err, analytics.ErrTooManyPeriods) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+}
+
 func (
 	h *Analytics,
 ) getDateRange(
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sales-analytics/internal/models"
+	"sales-analytics/internal/service/export"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type Export struct {
+	Service export.Service
+	Log     *zap.Logger
+}
+
+// Sales streams the order items of a date range, one row per item with the
+// columns of the ingestion CSV
+// Query parameters:
+// - start_date: start of the date range (default: 1 year ago)
+// - end_date: end of the date range (default: today)
+// - format: csv or ndjson (default: csv)
+// - region, category, customer_id, product_id: restrict the rows
+// - include_pii: export customer email and address (default: false)
+// - gzip: compress the response even if the client did not ask for it
+func (
+	h Export,
+) Sales(
+	c *gin.Context,
+) {
+	now := time.Now()
+	f := models.ExportFilter{
+		Start:      c.DefaultQuery("start_date", now.AddDate(-1, 0, 0).Format("2006-01-02")),
+		End:        c.DefaultQuery("end_date", now.Format("2006-01-02")),
+		Region:     c.Query("region"),
+		Category:   c.Query("category"),
+		CustomerID: c.Query("customer_id"),
+		ProductID:  c.Query("product_id"),
+	}
+	for _, d := range []string{f.Start, f.End} {
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date, expected YYYY-MM-DD"})
+			return
+		}
+	}
+	f.IncludePII, _ = strconv.ParseBool(c.Query("include_pii"))
+
+	format := c.DefaultQuery("format", export.FormatCSV)
+	contentType := "text/csv; charset=utf-8"
+	switch format {
+	case export.FormatCSV:
+	case export.FormatNDJSON:
+		contentType = "application/x-ndjson"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": export.ErrInvalidFormat.Error()})
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", "attachment; filename=sales_"+f.Start+"_"+f.End+"."+format)
+	c.Header("Vary", "Accept-Encoding")
+
+	var w io.Writer = c.Writer
+	flush := func() error {
+		c.Writer.Flush()
+		return nil
+	}
+	forced, _ := strconv.ParseBool(c.Query("gzip"))
+	if forced || strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+		c.Header("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(c.Writer)
+		defer gz.Close()
+		w = gz
+		flush = func() error {
+			if err := gz.Flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+			return nil
+		}
+	}
+	c.Status(http.StatusOK)
+
+	rows, err := h.Service.Sales(c.Request.Context(), f, format, w, flush)
+	if err != nil {
+		// the status is already sent, the client sees a truncated body
+		h.Log.Error("sales export failed",
+			zap.String("start_date", f.Start),
+			zap.String("end_date", f.End),
+			zap.Int("rows", rows),
+			zap.Error(err))
+		return
+	}
+
+	h.Log.Info("sales export completed",
+		zap.String("start_date", f.Start),
+		zap.String("end_date", f.End),
+		zap.String("format", format),
+		zap.Int("rows", rows))
+}
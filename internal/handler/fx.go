@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	apierr "sales-analytics/internal/errors"
+	"sales-analytics/internal/service/fx"
+	"sales-analytics/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type FX struct {
+	Service fx.Service
+	Log     *zap.Logger
+}
+
+// LoadRates upserts the rates of an uploaded date,currency,rate CSV
+func (
+	h FX,
+) LoadRates(
+	c *gin.Context,
+) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		h.Log.Error("No fx rates file uploaded", zap.Error(err))
+		utils.JSON(c, apierr.FileRequired.Code, apierr.FileRequired)
+		return
+	}
+
+	f, err := fileHeader.Open()
+	if err != nil {
+		h.Log.Error("Failed to open fx rates file", zap.Error(err))
+		utils.JSON(c, apierr.Internal.Code, apierr.Internal)
+		return
+	}
+	defer f.Close()
+
+	load, err := h.Service.Load(c.Request.Context(), f)
+	if err != nil {
+		h.Log.Error("fx rates load failed", zap.Error(err))
+		if errors.Is(err, fx.ErrInvalidFile) {
+			utils.JSON(c, apierr.BadRequest.Code, gin.H{"error": err.Error()})
+			return
+		}
+		utils.JSON(c, apierr.Internal.Code, apierr.Internal)
+		return
+	}
+
+	utils.JSON(c, http.StatusOK, gin.H{"base": h.Service.Base(), "load": load})
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"sales-analytics/internal/constants"
+	apierr "sales-analytics/internal/errors"
+	"sales-analytics/internal/service/identity"
+	"sales-analytics/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type Identity struct {
+	Service identity.Service
+	Log     *zap.Logger
+}
+
+// Resolve links every customer not yet linked to a person
+func (
+	h Identity,
+) Resolve(
+	c *gin.Context,
+) {
+	result, err := h.Service.Resolve(c.Request.Context())
+	if errors.Is(err, identity.ErrResolveBusy) {
+		utils.JSON(c, http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.Log.Error("identity resolution failed", zap.Error(err))
+		utils.JSON(c, apierr.Internal.Code, apierr.Internal)
+		return
+	}
+
+	utils.JSON(c, http.StatusOK, result)
+}
+
+// Candidates lists merge candidates by status (default: pending)
+func (
+	h Identity,
+) Candidates(
+	c *gin.Context,
+) {
+	status := c.DefaultQuery("status", constants.CandidatePending)
+	switch status {
+	case constants.CandidatePending, constants.CandidateApproved,
+		constants.CandidateRejected, constants.CandidateSuperseded:
+	default:
+		utils.JSON(c, apierr.BadRequest.Code, gin.H{"error": "Invalid status"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+
+	candidates, err := h.Service.Candidates(c.Request.Context(), status, limit)
+	if err != nil {
+		h.Log.Error("merge candidate lookup failed", zap.Error(err))
+		utils.JSON(c, apierr.Internal.Code, apierr.Internal)
+		return
+	}
+
+	utils.JSON(c, http.StatusOK, utils.SuccessResponse("candidates", gin.H{
+		"status":     status,
+		"count":      len(candidates),
+		"candidates": candidates,
+	}))
+}
+
+// Approve merges the person of a candidate into its match
+func (
+	h Identity,
+) Approve(
+	c *gin.Context,
+) {
+	id, ok := h.candidateID(c)
+	if !ok {
+		return
+	}
+
+	person, err := h.Service.Approve(c.Request.Context(), id)
+	if err != nil {
+		h.decisionFailed(c, id, err)
+		return
+	}
+
+	utils.JSON(c, http.StatusOK, person)
+}
+
+// Reject keeps the persons of a candidate apart, the pair is not proposed
+// again
+func (
+	h Identity,
+) Reject(
+	c *gin.Context,
+) {
+	id, ok := h.candidateID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.Service.Reject(c.Request.Context(), id); err != nil {
+		h.decisionFailed(c, id, err)
+		return
+	}
+
+	utils.JSON(c, http.StatusOK, gin.H{"id": id, "status": constants.CandidateRejected})
+}
+
+// Person returns a person with its customer IDs
+func (
+	h Identity,
+) Person(
+	c *gin.Context,
+) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.JSON(c, apierr.BadRequest.Code, apierr.BadRequest)
+		return
+	}
+
+	person, err := h.Service.Person(c.Request.Context(), id)
+	switch {
+	case err == nil:
+		utils.JSON(c, http.StatusOK, person)
+	case errors.Is(err, identity.ErrPersonNotFound):
+		utils.JSON(c, apierr.NotFound.Code, gin.H{"error": err.Error(), "id": id})
+	default:
+		h.Log.Error("person lookup failed", zap.Int64("id", id), zap.Error(err))
+		utils.JSON(c, apierr.Internal.Code, apierr.Internal)
+	}
+}
+
+func (
+	h Identity,
+) candidateID(
+	c *gin.Context,
+) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.JSON(c, apierr.BadRequest.Code, apierr.BadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func (
+	h Identity,
+) decisionFailed(
+	c *gin.Context,
+	id int64,
+	err error,
+) {
+	switch {
+	case errors.Is(err, identity.ErrCandidateNotFound):
+		utils.JSON(c, apierr.NotFound.Code, gin.H{"error": err.Error(), "id": id})
+	case errors.Is(err, identity.ErrNotPending):
+		utils.JSON(c, http.StatusConflict, gin.H{"error": err.Error(), "id": id})
+	default:
+		h.Log.Error("merge decision failed", zap.Int64("id", id), zap.Error(err))
+		utils.JSON(c, apierr.Internal.Code, apierr.Internal)
+	}
+}
@@ -2,13 +2,23 @@ package handler
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"time"
 
+	"sales-analytics/internal/constants"
 	apierr "sales-analytics/internal/errors"
+	"sales-analytics/internal/models"
 	"sales-analytics/internal/repository"
 	"sales-analytics/internal/service/ingestion"
 	"sales-analytics/internal/utils"
+	"sales-analytics/pkg/s3"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -19,13 +29,28 @@ type Ingestion struct {
 	Service ingestion.Service
 	Jobs    repository.JobRepository
 	Log     *zap.Logger
+
+	// MaxStreamSize caps the request body of streamed uploads
+	MaxStreamSize int64
+	// S3Buckets limits the buckets ImportS3 may read, empty allows any
+	S3Buckets []string
+	// Callbacks is set when a webhook secret is configured, callback URLs
+	// are refused without one
+	Callbacks bool
 }
 
+const defaultMaxStreamSize = 5 << 30 // 5GB
+
 func (
 	h Ingestion,
 ) Upload(
 	c *gin.Context,
 ) {
+	callback, ok := h.callbackURL(c)
+	if !ok {
+		return
+	}
+
 	fileHeader, err := c.FormFile("file")
 	if err != nil {
 		h.Log.Error("No file uploaded", zap.Error(err))
@@ -44,7 +69,7 @@ func (
 	jobID := uuid.NewString()
 	mode := c.DefaultQuery("mode", "append")
 
-	h.Jobs.Insert(ctx, jobID)
+	h.Jobs.Insert(ctx, models.IngestionJob{JobID: jobID, Mode: mode, CallbackURL: callback})
 
 	go func() {
 		defer f.Close()
@@ -54,11 +79,124 @@ func (
 	utils.JSON(c, http.StatusAccepted, gin.H{"job_id": jobID})
 }
 
+// UploadStream ingests a multipart upload while the request is still being
+// received: the "file" part is piped straight into the CSV reader instead of
+// being spooled to disk first. The response is sent once the job finishes.
+func (
+	h Ingestion,
+) UploadStream(
+	c *gin.Context,
+) {
+	callback, ok := h.callbackURL(c)
+	if !ok {
+		return
+	}
+
+	limit := h.MaxStreamSize
+	if limit <= 0 {
+		limit = defaultMaxStreamSize
+	}
+	if c.Request.ContentLength > limit {
+		h.tooLarge(c, "", limit)
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+
+	mr, err := c.Request.MultipartReader()
+	if err != nil {
+		h.Log.Error("Invalid multipart upload", zap.Error(err))
+		utils.JSON(c, apierr.BadRequest.Code, gin.H{"error": "multipart/form-data body required"})
+		return
+	}
+
+	// skip any form fields sent ahead of the file
+	var part *multipart.Part
+	for {
+		part, err = mr.NextPart()
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				h.tooLarge(c, "", limit)
+				return
+			}
+			h.Log.Error("No file part in streamed upload", zap.Error(err))
+			utils.JSON(c, apierr.FileRequired.Code, apierr.FileRequired)
+			return
+		}
+		if part.FormName() == "file" {
+			break
+		}
+		part.Close()
+	}
+	defer part.Close()
+
+	jobID := uuid.NewString()
+	mode := c.DefaultQuery("mode", "append")
+	h.Jobs.Insert(c.Request.Context(), models.IngestionJob{JobID: jobID, Mode: mode, CallbackURL: callback})
+
+	h.Log.Info("streaming upload started",
+		zap.String("job_id", jobID),
+		zap.String("file_name", part.FileName()),
+		zap.Int64("max_size", limit))
+
+	// the request context cancels the job if the client goes away
+	err = h.Service.ImportFile(c.Request.Context(), part, jobID, mode)
+
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		h.tooLarge(c, jobID, limit)
+		return
+	}
+
+	job, jerr := h.Jobs.Get(context.WithoutCancel(c.Request.Context()), jobID)
+	if jerr != nil {
+		h.Log.Error("job status retrieval failed", zap.String("job_id", jobID), zap.Error(jerr))
+		utils.JSON(c, apierr.Internal.Code, apierr.Internal)
+		return
+	}
+
+	code := http.StatusOK
+	if err != nil {
+		code = http.StatusUnprocessableEntity
+	}
+	utils.JSON(c, code, job)
+}
+
+// tooLarge responds 413; rows read before the limit was hit stay loaded
+// and the job is recorded as failed
+func (
+	h Ingestion,
+) tooLarge(
+	c *gin.Context,
+	jobID string,
+	limit int64,
+) {
+	h.Log.Warn("streamed upload exceeds max size",
+		zap.String("job_id", jobID),
+		zap.Int64("max_size", limit))
+
+	body := gin.H{
+		"error":          "file too large",
+		"max_size_bytes": limit,
+	}
+	if jobID != "" {
+		body["job_id"] = jobID
+	}
+	// the client may still be sending, don't keep the connection around
+	c.Header("Connection", "close")
+	utils.JSON(c, http.StatusRequestEntityTooLarge, body)
+}
+
 func (
 	h Ingestion,
 ) ProcessLocal(
 	c *gin.Context,
 ) {
+	callback, ok := h.callbackURL(c)
+	if !ok {
+		return
+	}
+
 	filePath := c.Query("path")
 	if filePath == "" {
 		h.Log.Error("No file path provided")
@@ -76,7 +214,7 @@ func (
 	jobID := uuid.NewString()
 	mode := c.DefaultQuery("mode", "append")
 
-	h.Jobs.Insert(ctx, jobID)
+	h.Jobs.Insert(ctx, models.IngestionJob{JobID: jobID, Mode: mode, CallbackURL: callback})
 
 	go func() {
 		file, err := os.Open(filePath)
@@ -93,6 +231,53 @@ func (
 	utils.JSON(c, http.StatusAccepted, gin.H{"job_id": jobID})
 }
 
+// ImportS3 starts a job that streams an s3://bucket/key object into the
+// parser
+func (
+	h Ingestion,
+) ImportS3(
+	c *gin.Context,
+) {
+	source := c.Query("source")
+	bucket, _, err := s3.ParseURL(source)
+	if err != nil {
+		h.Log.Error("Invalid s3 source", zap.String("source", source), zap.Error(err))
+		utils.JSON(c, apierr.BadRequest.Code, gin.H{"error": "source must be s3://bucket/key"})
+		return
+	}
+	if len(h.S3Buckets) > 0 && !slices.Contains(h.S3Buckets, bucket) {
+		h.Log.Error("S3 bucket not allowed", zap.String("bucket", bucket))
+		utils.JSON(c, http.StatusForbidden, gin.H{"error": "bucket not allowed"})
+		return
+	}
+
+	callback, ok := h.callbackURL(c)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	jobID := uuid.NewString()
+	mode := c.DefaultQuery("mode", "append")
+
+	h.Jobs.Insert(ctx, models.IngestionJob{JobID: jobID, Mode: mode, CallbackURL: callback})
+
+	go func() {
+		if err := h.Service.ImportFromSource(ctx, source, jobID, mode); err != nil {
+			h.Log.Error("s3 import failed",
+				zap.String("job_id", jobID),
+				zap.String("source", source),
+				zap.Error(err))
+		}
+	}()
+
+	utils.JSON(c, http.StatusAccepted, gin.H{
+		"job_id": jobID,
+		"source": source,
+		"mode":   mode,
+	})
+}
+
 func (
 	h Ingestion,
 ) Refresh(
@@ -100,6 +285,11 @@ func (
 ) {
 	mode := c.DefaultQuery("mode", "append")
 
+	callback, ok := h.callbackURL(c)
+	if !ok {
+		return
+	}
+
 	jobID := uuid.NewString()
 	ctx := context.Background()
 
@@ -108,7 +298,7 @@ func (
 		zap.String("mode", mode))
 
 	// insert job record first for status tracking
-	h.Jobs.Insert(ctx, jobID)
+	h.Jobs.Insert(ctx, models.IngestionJob{JobID: jobID, Mode: mode, CallbackURL: callback})
 
 	// run import in background to avoid blocking api
 	go func() {
@@ -131,3 +321,154 @@ func (
 		"mode":    mode,
 	})
 }
+
+// callbackURL reads the optional callback_url parameter, responding with
+// 400 and returning false when it is not an absolute http(s) URL or no
+// webhook secret is configured to sign deliveries
+func (
+	h Ingestion,
+) callbackURL(
+	c *gin.Context,
+) (string, bool) {
+	raw := c.Query("callback_url")
+	callback, err := parseCallbackURL(raw, h.Callbacks)
+	if err != nil {
+		h.Log.Error("Invalid callback url", zap.String("callback_url", raw))
+		utils.JSON(c, apierr.BadRequest.Code, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return callback, true
+}
+
+func parseCallbackURL(
+	raw string,
+	signed bool,
+) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	if !signed {
+		return "", errors.New("callback_url is not accepted until a webhook secret is configured")
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("callback_url must be an absolute http(s) URL")
+	}
+	return u.String(), nil
+}
+
+// sseHeartbeat is how often an idle event stream re-checks the stored job
+// and sends a heartbeat to keep proxies from closing the connection
+const sseHeartbeat = 15 * time.Second
+
+// Events streams the progress of a job as Server-Sent Events until the
+// job finishes or the client disconnects
+func (
+	h Ingestion,
+) Events(
+	c *gin.Context,
+) {
+	id := c.Param("id")
+	if id == "" {
+		utils.JSON(c, apierr.BadRequest.Code, apierr.BadRequest)
+		return
+	}
+
+	// subscribe before reading the job so a result published in between
+	// is not missed
+	events, cancel := h.Service.Subscribe(id)
+	defer cancel()
+
+	job, err := h.Jobs.Get(c.Request.Context(), id)
+	if err != nil {
+		h.Log.Error("job event stream failed", zap.String("job_id", id), zap.Error(err))
+		if err == sql.ErrNoRows {
+			utils.JSON(c, apierr.NotFound.Code, gin.H{"error": "job not found", "job_id": id})
+			return
+		}
+		utils.JSON(c, apierr.Internal.Code, apierr.Internal)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	if job.Status != constants.StatusRunning {
+		c.SSEvent(ingestion.EventResult, job.Result())
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				// stream closed without a result, fall back to the stored job
+				return h.sendStoredResult(c, id)
+			}
+			c.SSEvent(e.Type, e.Data)
+			return e.Type != ingestion.EventResult
+
+		case <-heartbeat.C:
+			return h.sendStoredResult(c, id)
+
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// sendStoredResult sends the result of a job that is no longer running, or
+// a heartbeat otherwise. It reports whether the stream should stay open.
+func (
+	h Ingestion,
+) sendStoredResult(
+	c *gin.Context,
+	id string,
+) bool {
+	job, err := h.Jobs.Get(c.Request.Context(), id)
+	if err != nil {
+		h.Log.Warn("job lookup during event stream failed", zap.String("job_id", id), zap.Error(err))
+		return false
+	}
+	if job.Status != constants.StatusRunning {
+		c.SSEvent(ingestion.EventResult, job.Result())
+		return false
+	}
+	c.SSEvent("heartbeat", gin.H{"job_id": id, "processed_rows": job.ProcessedRows})
+	return true
+}
+
+// Rollback reverts the rows written by a finished append job
+func (
+	h Ingestion,
+) Rollback(
+	c *gin.Context,
+) {
+	id := c.Param("id")
+	if id == "" {
+		utils.JSON(c, apierr.BadRequest.Code, apierr.BadRequest)
+		return
+	}
+
+	result, err := h.Service.Rollback(c.Request.Context(), id)
+	switch {
+	case err == nil:
+		utils.JSON(c, http.StatusOK, utils.SuccessResponse("rollback", result))
+	case errors.Is(err, ingestion.ErrJobNotFound):
+		utils.JSON(c, apierr.NotFound.Code, gin.H{"error": err.Error(), "job_id": id})
+	case errors.Is(err, ingestion.ErrJobRunning),
+		errors.Is(err, ingestion.ErrAlreadyRolledBack),
+		errors.Is(err, ingestion.ErrNotReversible),
+		errors.Is(err, ingestion.ErrHistoryBusy):
+		utils.JSON(c, http.StatusConflict, gin.H{"error": err.Error(), "job_id": id})
+	default:
+		h.Log.Error("job rollback failed", zap.String("job_id", id), zap.Error(err))
+		utils.JSON(c, apierr.Internal.Code, apierr.Internal)
+	}
+}
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"sales-analytics/internal/constants"
+	apierr "sales-analytics/internal/errors"
+	"sales-analytics/internal/service/privacy"
+	"sales-analytics/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type Privacy struct {
+	Service privacy.Service
+	Log     *zap.Logger
+}
+
+// RotateKeys re-encrypts stored personal data with the active key
+func (
+	h Privacy,
+) RotateKeys(
+	c *gin.Context,
+) {
+	result, err := h.Service.RotateKeys(c.Request.Context())
+	switch {
+	case err == nil:
+		utils.JSON(c, http.StatusOK, result)
+	case errors.Is(err, privacy.ErrDisabled):
+		utils.JSON(c, http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		h.Log.Error("pii key rotation failed", zap.Error(err))
+		utils.JSON(c, apierr.Internal.Code, apierr.Internal)
+	}
+}
+
+// Erase removes the personal data of a customer on request
+// Query parameters:
+// - mode: anonymize keeps the orders under a pseudonymous customer in the
+// same region, purge moves them to the shared erased customer (default: anonymize)
+// - reason: free text kept in the audit record, e.g. a ticket reference
+func (
+	h Privacy,
+) Erase(
+	c *gin.Context,
+) {
+	id := c.Param("id")
+	if id == "" {
+		utils.JSON(c, apierr.BadRequest.Code, apierr.BadRequest)
+		return
+	}
+
+	mode := c.DefaultQuery("mode", constants.ErasureAnonymize)
+	erasure, err := h.Service.Erase(c.Request.Context(), id, mode, c.Query("reason"))
+	switch {
+	case err == nil:
+		utils.JSON(c, http.StatusOK, erasure)
+	case errors.Is(err, privacy.ErrInvalidMode):
+		utils.JSON(c, apierr.BadRequest.Code, gin.H{"error": err.Error()})
+	case errors.Is(err, privacy.ErrNoIndexKey):
+		utils.JSON(c, http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, privacy.ErrCustomerNotFound):
+		utils.JSON(c, apierr.NotFound.Code, gin.H{"error": err.Error()})
+	default:
+		// the customer ID is personal data, it is not logged
+		h.Log.Error("customer erasure failed", zap.String("mode", mode), zap.Error(err))
+		utils.JSON(c, apierr.Internal.Code, apierr.Internal)
+	}
+}
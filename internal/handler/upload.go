@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	apierr "sales-analytics/internal/errors"
+	"sales-analytics/internal/models"
+	"sales-analytics/internal/service/upload"
+	"sales-analytics/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// resumable upload protocol headers
+const (
+	headerUploadOffset = "Upload-Offset"
+	headerChunkSHA256  = "X-Chunk-SHA256"
+)
+
+type Uploads struct {
+	Service upload.Service
+	Log     *zap.Logger
+	// Callbacks is set when a webhook secret is configured
+	Callbacks bool
+}
+
+// Create opens a resumable upload session
+func (
+	h Uploads,
+) Create(
+	c *gin.Context,
+) {
+	var req upload.CreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.JSON(c, apierr.BadRequest.Code, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	callback, err := parseCallbackURL(req.CallbackURL, h.Callbacks)
+	if err != nil {
+		utils.JSON(c, apierr.BadRequest.Code, gin.H{"error": err.Error()})
+		return
+	}
+	req.CallbackURL = callback
+
+	session, err := h.Service.Create(c.Request.Context(), req)
+	if err != nil {
+		h.fail(c, "", err)
+		return
+	}
+
+	h.respond(c, http.StatusCreated, session)
+}
+
+// Get reports the session state; Upload-Offset tells a client where to
+// resume after a disconnect
+func (
+	h Uploads,
+) Get(
+	c *gin.Context,
+) {
+	id := c.Param("id")
+	session, err := h.Service.Get(c.Request.Context(), id)
+	if err != nil {
+		h.fail(c, id, err)
+		return
+	}
+
+	h.respond(c, http.StatusOK, session)
+}
+
+// Put writes one chunk. The offset comes from Content-Range
+// ("bytes <start>-<end>/<total>") or Upload-Offset, and X-Chunk-SHA256
+// carries the hex SHA-256 of the chunk body. A body shorter or longer than
+// the Content-Range is rejected.
+func (
+	h Uploads,
+) Put(
+	c *gin.Context,
+) {
+	id := c.Param("id")
+
+	offset, length, err := chunkRange(c.Request)
+	if err != nil {
+		utils.JSON(c, apierr.BadRequest.Code, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := h.Service.WriteChunk(c.Request.Context(), id, offset, length, c.Request.Body, c.GetHeader(headerChunkSHA256))
+	if err != nil {
+		h.fail(c, id, err)
+		return
+	}
+
+	h.respond(c, http.StatusOK, session)
+}
+
+// Complete finalizes the upload and starts the ingestion job
+func (
+	h Uploads,
+) Complete(
+	c *gin.Context,
+) {
+	id := c.Param("id")
+	session, err := h.Service.Finalize(c.Request.Context(), id)
+	if err != nil {
+		h.fail(c, id, err)
+		return
+	}
+
+	h.respond(c, http.StatusAccepted, session)
+}
+
+// Abort discards an unfinished upload
+func (
+	h Uploads,
+) Abort(
+	c *gin.Context,
+) {
+	id := c.Param("id")
+	if err := h.Service.Abort(c.Request.Context(), id); err != nil {
+		h.fail(c, id, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (
+	h Uploads,
+) respond(
+	c *gin.Context,
+	code int,
+	session models.UploadSession,
+) {
+	c.Header(headerUploadOffset, strconv.FormatInt(session.Received, 10))
+	utils.JSON(c, code, utils.SuccessResponse("upload", session))
+}
+
+// fail maps upload service errors to responses; offset mismatches include
+// the current offset so the client can resume from it
+func (
+	h Uploads,
+) fail(
+	c *gin.Context,
+	id string,
+	err error,
+) {
+	switch {
+	case errors.Is(err, upload.ErrNotFound):
+		utils.JSON(c, apierr.NotFound.Code, gin.H{"error": err.Error(), "upload_id": id})
+	case errors.Is(err, upload.ErrInvalidRequest), errors.Is(err, upload.ErrLengthMismatch):
+		utils.JSON(c, apierr.BadRequest.Code, gin.H{"error": err.Error()})
+	case errors.Is(err, upload.ErrChecksumMismatch):
+		utils.JSON(c, http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, upload.ErrChunkTooLarge):
+		utils.JSON(c, http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, upload.ErrOffsetMismatch), errors.Is(err, upload.ErrIncomplete):
+		if session, gerr := h.Service.Get(c.Request.Context(), id); gerr == nil {
+			c.Header(headerUploadOffset, strconv.FormatInt(session.Received, 10))
+			utils.JSON(c, http.StatusConflict, gin.H{"error": err.Error(), "offset": session.Received, "size": session.TotalSize})
+			return
+		}
+		utils.JSON(c, http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, upload.ErrFinalized), errors.Is(err, upload.ErrBusy):
+		utils.JSON(c, http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		h.Log.Error("upload request failed", zap.String("upload_id", id), zap.Error(err))
+		utils.JSON(c, apierr.Internal.Code, apierr.Internal)
+	}
+}
+
+// chunkRange reads the chunk start offset from Content-Range or
+// Upload-Offset. The length is the Content-Range size, or -1 when only
+// Upload-Offset is given.
+func chunkRange(
+	r *http.Request,
+) (int64, int64, error) {
+	if cr := r.Header.Get("Content-Range"); cr != "" {
+		var start, end int64
+		var total string
+		if _, err := fmt.Sscanf(strings.TrimSpace(cr), "bytes %d-%d/%s", &start, &end, &total); err != nil || start < 0 || end < start {
+			return 0, 0, errors.New("invalid Content-Range header")
+		}
+		length := end - start + 1
+		if r.ContentLength >= 0 && r.ContentLength != length {
+			return 0, 0, errors.New("Content-Length does not match Content-Range")
+		}
+		return start, length, nil
+	}
+
+	raw := r.Header.Get(headerUploadOffset)
+	if raw == "" {
+		return 0, 0, errors.New("Content-Range or Upload-Offset header required")
+	}
+	offset, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, 0, errors.New("invalid Upload-Offset header")
+	}
+	return offset, -1, nil
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"net/http"
+
+	apierr "sales-analytics/internal/errors"
+	"sales-analytics/internal/service/webhook"
+	"sales-analytics/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type Webhook struct {
+	Service webhook.Service
+	Log     *zap.Logger
+}
+
+// Deliveries lists every callback attempt made for a job
+func (
+	h Webhook,
+) Deliveries(
+	c *gin.Context,
+) {
+	id := c.Param("id")
+	if id == "" {
+		utils.JSON(c, apierr.BadRequest.Code, apierr.BadRequest)
+		return
+	}
+
+	deliveries, err := h.Service.Deliveries(c.Request.Context(), id)
+	if err != nil {
+		h.Log.Error("webhook delivery lookup failed",
+			zap.String("job_id", id),
+			zap.Error(err))
+		utils.JSON(c, apierr.Internal.Code, apierr.Internal)
+		return
+	}
+
+	utils.JSON(c, http.StatusOK, utils.SuccessResponse("deliveries", gin.H{
+		"job_id":   id,
+		"count":    len(deliveries),
+		"attempts": deliveries,
+	}))
+}
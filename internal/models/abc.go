@@ -0,0 +1,45 @@
+package models
+
+// ABC analysis entities
+const (
+	ABCProducts  = "products"
+	ABCCustomers = "customers"
+)
+
+type CustomerRevenue struct {
+	CustomerID   string  `json:"customer_id"`
+	CustomerName string  `json:"customer_name"`
+	Revenue      float64 `json:"revenue"`
+	Returns      float64 `json:"returns"`
+	Net          float64 `json:"net_revenue"`
+}
+
+// ABCItem is a product or customer ranked by revenue; CumulativeShare is
+// the share of revenue of it and every item ranked above it
+type ABCItem struct {
+	Rank            int     `json:"rank"`
+	ID              string  `json:"id"`
+	Name            string  `json:"name"`
+	Revenue         float64 `json:"revenue"`
+	Share           float64 `json:"share"`
+	CumulativeShare float64 `json:"cumulative_share"`
+	Class           string  `json:"class"`
+}
+
+// ABCClass summarizes the items of a class
+type ABCClass struct {
+	Class        string  `json:"class"`
+	Items        int     `json:"items"`
+	ItemShare    float64 `json:"item_share"`
+	Revenue      float64 `json:"revenue"`
+	RevenueShare float64 `json:"revenue_share"`
+}
+
+type ABCResult struct {
+	Entity  string     `json:"entity"`
+	A       float64    `json:"threshold_a"`
+	B       float64    `json:"threshold_b"`
+	Revenue float64    `json:"revenue"`
+	Classes []ABCClass `json:"classes"`
+	Items   []ABCItem  `json:"items"`
+}
@@ -1,19 +1,44 @@
 package models
 
+import "time"
+
+// RevenueTotals splits revenue into what was sold and what was given back
+// through returns and refunds; Revenue fields elsewhere are gross
+type RevenueTotals struct {
+	Gross   float64 `json:"gross"`
+	Returns float64 `json:"returns"`
+	Net     float64 `json:"net"`
+	// Unconverted counts the sale items and returns of the period left out
+	// of the amounts because no fx rate is loaded for them yet
+	Unconverted int `json:"unconverted"`
+}
+
 type ProductRevenue struct {
 	ProductID   string  `json:"product_id"`
 	ProductName string  `json:"product_name"`
 	Revenue     float64 `json:"revenue"`
+	Returns     float64 `json:"returns"`
+	Net         float64 `json:"net_revenue"`
+	// Change is set when a comparison period is requested
+	Change *RevenueChange `json:"change,omitempty"`
 }
 
 type CategoryRevenue struct {
 	Category string  `json:"category"`
 	Revenue  float64 `json:"revenue"`
+	Returns  float64 `json:"returns"`
+	Net      float64 `json:"net_revenue"`
+	// Change is set when a comparison period is requested
+	Change *RevenueChange `json:"change,omitempty"`
 }
 
 type RegionRevenue struct {
 	Region  string  `json:"region"`
 	Revenue float64 `json:"revenue"`
+	Returns float64 `json:"returns"`
+	Net     float64 `json:"net_revenue"`
+	// Change is set when a comparison period is requested
+	Change *RevenueChange `json:"change,omitempty"`
 }
 
 type TopProduct struct {
@@ -21,4 +46,87 @@ type TopProduct struct {
 	ProductName  string  `json:"product_name"`
 	QuantitySold int     `json:"quantity_sold"`
 	Revenue      float64 `json:"revenue"`
+	Returns      float64 `json:"returns"`
+	Net          float64 `json:"net_revenue"`
+	// Change is set when a comparison period is requested
+	Change *RevenueChange `json:"change,omitempty"`
+}
+
+// Attribution selects which customer and product attributes revenue is
+// reported under
+type Attribution string
+
+const (
+	// AttributionCurrent uses the latest known attributes
+	AttributionCurrent Attribution = "current"
+	// AttributionOrderDate uses the attributes that were valid on each
+	// order date, taken from the customer and product history
+	AttributionOrderDate Attribution = "order_date"
+)
+
+// Filter narrows an analytics query
+type Filter struct {
+	Start, End  string
+	Attribution Attribution
+	// Currency amounts are reported in, converted from the base currency
+	// at the rate in effect on RateOn, End when empty
+	Currency string
+	// RateOn is set on a comparison period to the date the compared period
+	// is converted on, so both convert at the same rate
+	RateOn string
+	// Region and Category, when set, restrict the KPI metrics to sales of
+	// customers in the region and products in the category, under the
+	// selected attribution
+	Region   string
+	Category string
+}
+
+// KPIs are the headline metrics of a period
+type KPIs struct {
+	Revenue           RevenueTotals `json:"revenue"`
+	Customers         int           `json:"customers"`
+	Orders            int           `json:"orders"`
+	AverageOrderValue float64       `json:"average_order_value"`
+}
+
+// Trend intervals
+const (
+	IntervalDaily     = "daily"
+	IntervalWeekly    = "weekly"
+	IntervalMonthly   = "monthly"
+	IntervalQuarterly = "quarterly"
+	IntervalYearly    = "yearly"
+)
+
+// DailyRevenue is the revenue booked on one day, for one group when the
+// trend is split
+type DailyRevenue struct {
+	Day      time.Time
+	Group    string
+	Revenue  float64
+	Returns  float64
+	Net      float64
+	Orders   int
+	Quantity int
+}
+
+// TrendBucket is one interval of a trend; Start and End are the calendar
+// bounds of the interval, the first and last bucket may extend beyond the
+// requested period
+type TrendBucket struct {
+	Period   string  `json:"period"`
+	Start    string  `json:"start"`
+	End      string  `json:"end"`
+	Revenue  float64 `json:"revenue"`
+	Returns  float64 `json:"returns"`
+	Net      float64 `json:"net_revenue"`
+	Orders   int     `json:"orders"`
+	Quantity int     `json:"quantity"`
+}
+
+// TrendSeries is the zero-filled trend of one group, or of all sales when
+// the trend is not split
+type TrendSeries struct {
+	Group   string        `json:"group,omitempty"`
+	Buckets []TrendBucket `json:"buckets"`
 }
@@ -0,0 +1,43 @@
+package models
+
+// BasketOptions are the thresholds of a market basket analysis; ProductID
+// limits the pairs to those with that product
+type BasketOptions struct {
+	MinSupport    float64
+	MinConfidence float64
+	MinLift       float64
+	Limit         int
+	ProductID     string
+}
+
+// PairCount is how often two products were bought in the same order, and
+// each of them at all, in orders of the period
+type PairCount struct {
+	ProductA, NameA string
+	ProductB, NameB string
+	Together        int
+	OrdersA         int
+	OrdersB         int
+}
+
+// ProductPair measures how strongly two products are bought together.
+// Support is the share of orders with both, ConfidenceAB the share of
+// orders with A that also have B, Lift how much more often they are bought
+// together than if they were independent.
+type ProductPair struct {
+	ProductA     string  `json:"product_a"`
+	NameA        string  `json:"product_a_name"`
+	ProductB     string  `json:"product_b"`
+	NameB        string  `json:"product_b_name"`
+	Orders       int     `json:"orders"`
+	Support      float64 `json:"support"`
+	ConfidenceAB float64 `json:"confidence_a_to_b"`
+	ConfidenceBA float64 `json:"confidence_b_to_a"`
+	Lift         float64 `json:"lift"`
+}
+
+type BasketResult struct {
+	// Orders is the number of orders in the period
+	Orders int           `json:"orders"`
+	Pairs  []ProductPair `json:"pairs"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// CLV models
+const (
+	CLVModelBGNBD  = "bgnbd"
+	CLVModelSimple = "simple"
+)
+
+// CustomerSummary is a customer's purchase history up to a reference date;
+// purchases are counted once per order date
+type CustomerSummary struct {
+	CustomerID   string
+	CustomerName string
+	Region       string
+	Purchases    int
+	First, Last  time.Time
+	Monetary     float64
+}
+
+// CLVEstimate is the predicted value of a customer
+type CLVEstimate struct {
+	CustomerID   string  `json:"customer_id"`
+	CustomerName string  `json:"customer_name"`
+	Region       string  `json:"region"`
+	Purchases    int     `json:"purchases"`
+	AvgValue     float64 `json:"avg_purchase_value"`
+	// ExpectedPurchases over the horizon (bgnbd) or lifetime (simple)
+	ExpectedPurchases float64 `json:"expected_purchases"`
+	// ProbAlive is the probability the customer is still active, bgnbd only
+	ProbAlive *float64 `json:"prob_alive,omitempty"`
+	CLV       float64  `json:"clv"`
+}
+
+// RegionCLV averages the estimates of the customers of a region
+type RegionCLV struct {
+	Region    string  `json:"region"`
+	Customers int     `json:"customers"`
+	AvgCLV    float64 `json:"avg_clv"`
+	TotalCLV  float64 `json:"total_clv"`
+}
+
+// CLVModel describes how estimates were made; Params are the fitted
+// BG/NBD parameters r, alpha, a and b, time measured in weeks
+type CLVModel struct {
+	Model         string             `json:"model"`
+	HorizonMonths int                `json:"horizon_months,omitempty"`
+	LifetimeYears float64            `json:"lifetime_years,omitempty"`
+	Margin        float64            `json:"margin"`
+	Params        map[string]float64 `json:"params,omitempty"`
+	Customers     int                `json:"customers"`
+}
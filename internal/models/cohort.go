@@ -0,0 +1,34 @@
+package models
+
+// Cohort granularities
+const (
+	CohortMonthly   = "monthly"
+	CohortQuarterly = "quarterly"
+)
+
+// CohortActivity is what a cohort did in one period after its first;
+// Cohort counts periods since year 0, Offset periods since the cohort
+type CohortActivity struct {
+	Cohort  int
+	Offset  int
+	Active  int
+	Revenue float64
+}
+
+// CohortPeriod is one cell of the retention triangle; Offset 0 is the
+// period of the first order
+type CohortPeriod struct {
+	Offset    int     `json:"offset"`
+	Period    string  `json:"period"`
+	Active    int     `json:"active_customers"`
+	Retention float64 `json:"retention"`
+	Revenue   float64 `json:"revenue"`
+}
+
+// Cohort is the customers whose first order fell in one period, with a
+// period for every period up to the end of the analysis
+type Cohort struct {
+	Cohort  string         `json:"cohort"`
+	Size    int            `json:"size"`
+	Periods []CohortPeriod `json:"periods"`
+}
@@ -0,0 +1,40 @@
+package models
+
+// Comparison periods
+const (
+	ComparePrevious = "previous"
+	CompareYoY      = "yoy"
+	CompareCustom   = "custom"
+)
+
+// Change compares a value with the same value in the comparison period;
+// Percent is nil when the previous value is zero
+type Change struct {
+	Previous float64  `json:"previous"`
+	Delta    float64  `json:"delta"`
+	Percent  *float64 `json:"percent"`
+}
+
+func NewChange(current, previous float64) *Change {
+	c := &Change{Previous: previous, Delta: current - previous}
+	if previous != 0 {
+		pct := c.Delta / previous * 100
+		c.Percent = &pct
+	}
+	return c
+}
+
+// RevenueChange is the change of a row of a revenue breakdown
+type RevenueChange struct {
+	Revenue *Change `json:"revenue"`
+	Net     *Change `json:"net_revenue"`
+	// Quantity is set for top products only
+	Quantity *Change `json:"quantity,omitempty"`
+}
+
+func NewRevenueChange(revenue, net, prevRevenue, prevNet float64) *RevenueChange {
+	return &RevenueChange{
+		Revenue: NewChange(revenue, prevRevenue),
+		Net:     NewChange(net, prevNet),
+	}
+}
@@ -1,3 +1,17 @@
 package models
 
-type Customer struct{ ID, Name, Email, Region, Address string }
+import "time"
+
+type Customer struct {
+	ID, Name, Email, Region, Address string
+
+	// EmailIndex and AddressIndex are the blind indexes of the normalized
+	// email and address, Email and Address hold their ciphertext once sealed
+	EmailIndex, AddressIndex string
+
+	// AsOf is the order date of the row these attributes were read from,
+	// history versions start from it
+	AsOf time.Time
+
+	Lineage
+}
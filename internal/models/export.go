@@ -0,0 +1,33 @@
+package models
+
+// ExportFilter selects the order items of an export. Empty fields match
+// everything.
+type ExportFilter struct {
+	Start, End string
+	Region     string
+	Category   string
+	CustomerID string
+	ProductID  string
+	// IncludePII exports the customer email and address, decrypted
+	IncludePII bool
+}
+
+// SaleRow is an order item joined with its order, product and customer,
+// laid out like a row of the ingestion CSV
+type SaleRow struct {
+	OrderID         string  `json:"order_id"`
+	ProductID       string  `json:"product_id"`
+	CustomerID      string  `json:"customer_id"`
+	ProductName     string  `json:"product_name"`
+	Category        string  `json:"category"`
+	Region          string  `json:"region"`
+	DateOfSale      string  `json:"date_of_sale"`
+	Quantity        int     `json:"quantity_sold"`
+	UnitPrice       float64 `json:"unit_price"`
+	Discount        float64 `json:"discount"`
+	ShippingCost    float64 `json:"shipping_cost"`
+	CustomerName    string  `json:"customer_name"`
+	CustomerEmail   string  `json:"customer_email,omitempty"`
+	CustomerAddress string  `json:"customer_address,omitempty"`
+	Currency        string  `json:"currency"`
+}
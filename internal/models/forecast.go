@@ -0,0 +1,32 @@
+package models
+
+// Forecast models
+const (
+	ForecastHoltWinters = "holt_winters"
+	ForecastHolt        = "holt"
+)
+
+// ForecastPoint is the forecast of one future interval with its prediction
+// interval
+type ForecastPoint struct {
+	Period   string  `json:"period"`
+	Start    string  `json:"start"`
+	End      string  `json:"end"`
+	Forecast float64 `json:"forecast"`
+	Lower    float64 `json:"lower"`
+	Upper    float64 `json:"upper"`
+}
+
+// ForecastSeries is the forecast of one trend series. Model is holt_winters
+// with additive seasonality when the history covers two seasons, else holt
+// with a trend only; Params are its smoothing parameters and RMSE the error
+// of its one step forecasts over the history.
+type ForecastSeries struct {
+	Group        string             `json:"group,omitempty"`
+	Model        string             `json:"model"`
+	SeasonLength int                `json:"season_length,omitempty"`
+	Params       map[string]float64 `json:"params"`
+	RMSE         float64            `json:"rmse"`
+	History      []TrendBucket      `json:"history"`
+	Points       []ForecastPoint    `json:"forecast"`
+}
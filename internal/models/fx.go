@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// FXRate is the value of one unit of Currency in the base currency,
+// effective from Date until the next rate of the same currency
+type FXRate struct {
+	Currency string    `json:"currency"`
+	Date     time.Time `json:"date"`
+	Rate     float64   `json:"rate"`
+}
+
+// FXLoad summarises a rates file load
+type FXLoad struct {
+	Rates      int      `json:"rates"`
+	Currencies []string `json:"currencies"`
+	From       string   `json:"from"`
+	To         string   `json:"to"`
+	// Orders, Items and Returns count the rows whose base amounts were
+	// recomputed
+	Orders  int64 `json:"orders"`
+	Items   int64 `json:"items"`
+	Returns int64 `json:"returns"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// Person is the golden record of one real person, every customer ID is
+// linked to exactly one
+type Person struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email,omitempty"`
+	Region    string    `json:"region,omitempty"`
+	Address   string    `json:"address,omitempty"`
+	Customers []string  `json:"customer_ids,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MergeCandidate proposes merging PersonID into MatchPersonID. CustomerID is
+// the customer whose resolution raised it.
+type MergeCandidate struct {
+	ID            int64      `json:"id"`
+	PersonID      int64      `json:"person_id"`
+	MatchPersonID int64      `json:"match_person_id"`
+	CustomerID    string     `json:"customer_id"`
+	Rule          string     `json:"rule"`
+	Score         float64    `json:"score"`
+	Status        string     `json:"status"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DecidedAt     *time.Time `json:"decided_at,omitempty"`
+}
+
+// ResolveResult summarises an identity resolution run
+type ResolveResult struct {
+	Customers int `json:"customers"`
+	// Merged customers were linked to an existing person by email
+	Merged   int `json:"merged"`
+	Created  int `json:"persons_created"`
+	Proposed int `json:"proposed"`
+}
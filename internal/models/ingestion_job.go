@@ -8,6 +8,39 @@ type IngestionJob struct {
 	TotalRows     int64     `json:"total_rows"`
 	ProcessedRows int64     `json:"processed_rows"`
 	ErrorMessage  string    `json:"error_message,omitempty"`
+	Mode          string    `json:"mode,omitempty"`
+	CallbackURL   string    `json:"callback_url,omitempty"`
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
 }
+
+// JobResult is the final state of a job as published to event subscribers
+// and webhook callbacks
+type JobResult struct {
+	JobID     string `json:"job_id"`
+	Status    string `json:"status"`
+	Rows      int64  `json:"rows"`
+	Failed    int64  `json:"failed_rows"`
+	Customers int64  `json:"customers"`
+	Products  int64  `json:"products"`
+	Orders    int64  `json:"orders"`
+	Items     int64  `json:"items"`
+	Returns   int64  `json:"returns"`
+	// Unconverted counts the sale items and returns stored without an fx
+	// rate; they are left out of revenue until a rate is loaded
+	Unconverted int64  `json:"unconverted"`
+	Error       string `json:"error,omitempty"`
+	DurationMs  int64  `json:"duration_ms"`
+}
+
+// Result builds a JobResult from a stored job, used when the live counters
+// are no longer available
+func (j IngestionJob) Result() JobResult {
+	return JobResult{
+		JobID:      j.JobID,
+		Status:     j.Status,
+		Rows:       j.ProcessedRows,
+		Error:      j.ErrorMessage,
+		DurationMs: j.UpdatedAt.Sub(j.CreatedAt).Milliseconds(),
+	}
+}
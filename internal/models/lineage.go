@@ -0,0 +1,24 @@
+package models
+
+// Lineage records the ingestion job and csv line a row was last written from
+type Lineage struct {
+	JobID      string
+	SourceLine int
+}
+
+// RollbackResult summarises the rollback of an ingestion job
+type RollbackResult struct {
+	JobID  string          `json:"job_id"`
+	Tables []TableRollback `json:"tables"`
+}
+
+// TableRollback is what a rollback did to one table. Deleted rows were
+// inserted by the job, restored rows were updated by it and got their prior
+// values back. Superseded rows were changed again by a later job and are
+// left as that job wrote them.
+type TableRollback struct {
+	Table      string `json:"table"`
+	Deleted    int64  `json:"deleted"`
+	Restored   int64  `json:"restored"`
+	Superseded int64  `json:"superseded"`
+}
@@ -6,4 +6,14 @@ type Order struct {
 	ID, CustomerID string
 	OrderDate      time.Time
 	TotalAmount    float64
+
+	// OrderedAt is the time of the order when the source has one
+	OrderedAt *time.Time
+
+	// Currency of TotalAmount, FXRate converts it to the base currency and
+	// is 0 while no rate is known
+	Currency string
+	FXRate   float64
+
+	Lineage
 }
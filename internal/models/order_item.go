@@ -4,4 +4,10 @@ type OrderItem struct {
 	OrderID, ProductID                string
 	Quantity                          int
 	UnitPrice, Discount, ShippingCost float64
+
+	// Currency and FXRate as on the order
+	Currency string
+	FXRate   float64
+
+	Lineage
 }
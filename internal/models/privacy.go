@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// SealedRow is a row holding encrypted personal data. Key are the values of
+// its primary key columns, in order.
+type SealedRow struct {
+	Key          []string
+	Email        string
+	Address      string
+	EmailIndex   string
+	AddressIndex string
+}
+
+// RotationResult reports a re-encryption of personal data with the active
+// key
+type RotationResult struct {
+	ActiveKey string          `json:"active_key"`
+	Tables    []TableRotation `json:"tables"`
+}
+
+type TableRotation struct {
+	Table     string `json:"table"`
+	Rewritten int64  `json:"rewritten"`
+	// Failed rows are encrypted with a key that is no longer configured
+	Failed int64 `json:"failed"`
+}
+
+// Erasure is the audit record of a customer erased on request. The
+// customer is only identified by SubjectHash, the blind index of its ID.
+type Erasure struct {
+	ID          int64     `json:"audit_id"`
+	SubjectHash string    `json:"subject_hash"`
+	Mode        string    `json:"mode"`
+	Reason      string    `json:"reason,omitempty"`
+	Replacement string    `json:"replacement_id"`
+	Orders      int64     `json:"orders"`
+	History     int64     `json:"history_rows"`
+	ErasedAt    time.Time `json:"erased_at"`
+}
@@ -1,6 +1,14 @@
 package models
 
+import "time"
+
 type Product struct {
 	ID, Name, Category string
 	UnitPrice          float64
+
+	// AsOf is the order date of the row these attributes were read from,
+	// history versions start from it
+	AsOf time.Time
+
+	Lineage
 }
@@ -0,0 +1,64 @@
+package models
+
+// Metrics of an analytics query
+const (
+	MetricRevenue   = "revenue"
+	MetricReturns   = "returns"
+	MetricNet       = "net_revenue"
+	MetricQuantity  = "quantity"
+	MetricOrders    = "orders"
+	MetricCustomers = "customers"
+	MetricAOV       = "aov"
+)
+
+// Dimensions of an analytics query; the time dimensions bucket the date a
+// line is booked on
+const (
+	DimProduct  = "product"
+	DimCategory = "category"
+	DimRegion   = "region"
+	DimCustomer = "customer"
+	DimDay      = "day"
+	DimMonth    = "month"
+	DimYear     = "year"
+)
+
+// Filter operators of an analytics query
+const (
+	OpEq    = "eq"
+	OpNe    = "ne"
+	OpIn    = "in"
+	OpNotIn = "not_in"
+)
+
+// QueryFilter restricts a query to the lines whose dimension matches
+type QueryFilter struct {
+	Field  string   `json:"field"`
+	Op     string   `json:"op"`
+	Value  string   `json:"value,omitempty"`
+	Values []string `json:"values,omitempty"`
+}
+
+// QuerySort orders the result by a selected metric or dimension
+type QuerySort struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc"`
+}
+
+// AnalyticsQuery selects metrics grouped by dimensions; fields are names
+// from the lists above, never SQL
+type AnalyticsQuery struct {
+	Filter     `json:"-"`
+	Metrics    []string      `json:"metrics"`
+	Dimensions []string      `json:"dimensions"`
+	Filters    []QueryFilter `json:"filters"`
+	Sort       []QuerySort   `json:"sort"`
+	Limit      int           `json:"limit"`
+}
+
+// QueryResult has one row per combination of dimension values, keyed by
+// dimension and metric names
+type QueryResult struct {
+	Columns []string         `json:"columns"`
+	Rows    []map[string]any `json:"rows"`
+}
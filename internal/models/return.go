@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Return gives back part of an order item, goods and money for a return
+// and money only for a refund. Amount is in Currency.
+type Return struct {
+	OrderID, ProductID string
+	Kind               string
+	Date               time.Time
+	Quantity           int
+	Amount             float64
+	Currency           string
+	FXRate             float64
+
+	Lineage
+}
@@ -0,0 +1,46 @@
+package models
+
+// RFM segments, from best to worst
+const (
+	SegmentChampions          = "champions"
+	SegmentLoyal              = "loyal"
+	SegmentPotentialLoyalists = "potential_loyalists"
+	SegmentNewCustomers       = "new_customers"
+	SegmentNeedAttention      = "need_attention"
+	SegmentAboutToSleep       = "about_to_sleep"
+	SegmentAtRisk             = "at_risk"
+	SegmentHibernating        = "hibernating"
+	SegmentLost               = "lost"
+)
+
+// RFMScore is a customer's recency, frequency and monetary value as of a
+// reference date, each also scored 1 to 5 by quintile, 5 being best
+type RFMScore struct {
+	CustomerID   string  `json:"customer_id"`
+	CustomerName string  `json:"customer_name"`
+	RecencyDays  int     `json:"recency_days"`
+	Frequency    int     `json:"frequency"`
+	Monetary     float64 `json:"monetary"`
+	R            int     `json:"r"`
+	F            int     `json:"f"`
+	M            int     `json:"m"`
+	Segment      string  `json:"segment"`
+}
+
+// RFMSegment summarizes the customers of a segment
+type RFMSegment struct {
+	Segment        string  `json:"segment"`
+	Customers      int     `json:"customers"`
+	AvgRecencyDays float64 `json:"avg_recency_days"`
+	AvgFrequency   float64 `json:"avg_frequency"`
+	AvgMonetary    float64 `json:"avg_monetary"`
+	Monetary       float64 `json:"monetary"`
+}
+
+// RFMPage is one page of the per-customer listing
+type RFMPage struct {
+	Total     int        `json:"total"`
+	Limit     int        `json:"limit"`
+	Offset    int        `json:"offset"`
+	Customers []RFMScore `json:"customers"`
+}
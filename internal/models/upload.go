@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// UploadSession tracks a resumable chunked upload
+type UploadSession struct {
+	ID          string    `json:"upload_id"`
+	FileName    string    `json:"file_name"`
+	TotalSize   int64     `json:"size"`
+	Received    int64     `json:"offset"`
+	SHA256      string    `json:"sha256,omitempty"`
+	Mode        string    `json:"mode"`
+	CallbackURL string    `json:"callback_url,omitempty"`
+	Status      string    `json:"status"`
+	JobID       string    `json:"job_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// WebhookDelivery is a single attempt to deliver a job callback
+type WebhookDelivery struct {
+	ID         int64     `json:"id"`
+	JobID      string    `json:"job_id"`
+	URL        string    `json:"url"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Delivered  bool      `json:"delivered"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
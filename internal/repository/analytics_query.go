@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"sales-analytics/internal/models"
+)
+
+// queryMetric is the aggregate of a metric over the salesLines l, whether
+// it is a count scanned as an integer and whether it is an amount in the
+// base currency
+type queryMetric struct {
+	expr   string
+	count  bool
+	amount bool
+}
+
+// queryMetrics are the metrics an analytics query may select
+var queryMetrics = map[string]queryMetric{
+	models.MetricRevenue:  {expr: `coalesce(sum(l.gross), 0)`, amount: true},
+	models.MetricReturns:  {expr: `coalesce(sum(l.returns), 0)`, amount: true},
+	models.MetricNet:      {expr: `coalesce(sum(l.gross), 0) - coalesce(sum(l.returns), 0)`, amount: true},
+	models.MetricQuantity: {expr: `coalesce(sum(l.quantity), 0)`, count: true},
+	models.MetricOrders:   {expr: `count(distinct l.order_id)`, count: true},
+	models.MetricCustomers: {expr: `count(distinct case when l.order_id is not null
+			then coalesce(concat('p:', c.person_id), concat('c:', l.customer_id)) end)`, count: true},
+	models.MetricAOV: {
+		expr:   `coalesce(sum(l.gross) / nullif(count(distinct case when l.gross is not null then l.order_id end), 0), 0)`,
+		amount: true,
+	},
+}
+
+// IsQueryMetric reports whether an analytics query may select the metric
+// name, and whether it is an amount to convert to the reporting currency
+func IsQueryMetric(name string) (ok, amount bool) {
+	m, ok := queryMetrics[name]
+	return ok, m.amount
+}
+
+// IsQueryDimension reports whether an analytics query may group, filter
+// and sort by the dimension name
+func IsQueryDimension(name string) bool {
+	_, ok := queryDimensions[name]
+	return ok
+}
+
+// queryDimension is the expression of a dimension and whether it needs the
+// customer or product joined
+type queryDimension struct {
+	expr     func(f models.Filter) string
+	customer bool
+	product  bool
+}
+
+var queryDimensions = map[string]queryDimension{
+	models.DimProduct:  {expr: func(models.Filter) string { return "l.product_id" }},
+	models.DimCategory: {expr: categoryExpr, product: true},
+	models.DimRegion:   {expr: regionExpr, customer: true},
+	models.DimCustomer: {expr: func(models.Filter) string { return "l.customer_id" }},
+	models.DimDay:      {expr: func(models.Filter) string { return "date_format(l.booked_on, '%Y-%m-%d')" }},
+	models.DimMonth:    {expr: func(models.Filter) string { return "date_format(l.booked_on, '%Y-%m')" }},
+	models.DimYear:     {expr: func(models.Filter) string { return "date_format(l.booked_on, '%Y')" }},
+}
+
+// compileQuery builds the SQL of an analytics query. Only names from the
+// metric and dimension tables reach the SQL, every value is a parameter.
+func compileQuery(q models.AnalyticsQuery) (string, []any, error) {
+	var cols []string
+	withCustomer, withProduct := false, false
+
+	for _, name := range q.Dimensions {
+		d, ok := queryDimensions[name]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown dimension %q", name)
+		}
+		cols = append(cols, d.expr(q.Filter)+" as `"+name+"`")
+		withCustomer = withCustomer || d.customer
+		withProduct = withProduct || d.product
+	}
+	for _, name := range q.Metrics {
+		m, ok := queryMetrics[name]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown metric %q", name)
+		}
+		cols = append(cols, m.expr+" as `"+name+"`")
+		withCustomer = withCustomer || name == models.MetricCustomers
+	}
+
+	var conds []string
+	var args []any
+	for _, qf := range q.Filters {
+		d, ok := queryDimensions[qf.Field]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown filter field %q", qf.Field)
+		}
+		withCustomer = withCustomer || d.customer
+		withProduct = withProduct || d.product
+
+		expr := d.expr(q.Filter)
+		switch qf.Op {
+		case models.OpEq:
+			conds = append(conds, expr+" = ?")
+			args = append(args, qf.Value)
+		case models.OpNe:
+			conds = append(conds, "not ("+expr+" <=> ?)")
+			args = append(args, qf.Value)
+		case models.OpIn, models.OpNotIn:
+			if len(qf.Values) == 0 {
+				return "", nil, fmt.Errorf("filter on %q has no values", qf.Field)
+			}
+			op := " in "
+			if qf.Op == models.OpNotIn {
+				op = " not in "
+			}
+			conds = append(conds, expr+op+"("+placeholders(len(qf.Values))+")")
+			for _, v := range qf.Values {
+				args = append(args, v)
+			}
+		default:
+			return "", nil, fmt.Errorf("unknown filter operator %q", qf.Op)
+		}
+	}
+
+	query := `
+		select ` + strings.Join(cols, ",\n\t\t\t") + `
+		from ` + salesLines
+	if withCustomer {
+		query += "\n\t\t" + customerJoin(q.Filter)
+	}
+	if withProduct {
+		query += "\n\t\t" + productJoin(q.Filter)
+	}
+	if len(conds) > 0 {
+		query += "\n\t\twhere " + strings.Join(conds, " and ")
+	}
+	if len(q.Dimensions) > 0 {
+		groups := make([]string, len(q.Dimensions))
+		for i, name := range q.Dimensions {
+			groups[i] = "`" + name + "`"
+		}
+		query += "\n\t\tgroup by " + strings.Join(groups, ", ")
+	}
+
+	var order []string
+	for _, s := range q.Sort {
+		if _, ok := queryMetrics[s.Field]; !ok {
+			if _, ok := queryDimensions[s.Field]; !ok {
+				return "", nil, fmt.Errorf("unknown sort field %q", s.Field)
+			}
+		}
+		dir := " asc"
+		if s.Desc {
+			dir = " desc"
+		}
+		order = append(order, "`"+s.Field+"`"+dir)
+	}
+	if len(order) > 0 {
+		query += "\n\t\torder by " + strings.Join(order, ", ")
+	}
+	query += "\n\t\tlimit ?"
+
+	return query, periodArgs(q.Filter, append(args, q.Limit)...), nil
+}
+
+// Query runs an analytics query. Amounts are in the base currency.
+func (r *analyticsRepository) Query(
+	ctx context.Context,
+	q models.AnalyticsQuery,
+) (models.QueryResult, error) {
+	result := models.QueryResult{
+		Columns: append(append([]string{}, q.Dimensions...), q.Metrics...),
+		Rows:    []map[string]any{},
+	}
+
+	query, args, err := compileQuery(q)
+	if err != nil {
+		return result, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return result, fmt.Errorf("failed to run analytics query: %w", err)
+	}
+	defer rows.Close()
+
+	dims := make([]sql.NullString, len(q.Dimensions))
+	metrics := make([]sql.NullFloat64, len(q.Metrics))
+	dest := make([]any, 0, len(dims)+len(metrics))
+	for i := range dims {
+		dest = append(dest, &dims[i])
+	}
+	for i := range metrics {
+		dest = append(dest, &metrics[i])
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return result, fmt.Errorf("failed to scan analytics query row: %w", err)
+		}
+		row := make(map[string]any, len(dest))
+		for i, name := range q.Dimensions {
+			row[name] = dims[i].String
+		}
+		for i, name := range q.Metrics {
+			if queryMetrics[name].count {
+				row[name] = int64(metrics[i].Float64)
+			} else {
+				row[name] = metrics[i].Float64
+			}
+		}
+		result.Rows = append(result.Rows, row)
+	}
+
+	if err = rows.Err(); err != nil {
+		return result, fmt.Errorf("error iterating analytics query rows: %w", err)
+	}
+
+	return result, nil
+}
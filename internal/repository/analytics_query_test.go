@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+
+	"sales-analytics/internal/models"
+)
+
+func TestCompileQueryRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		q    models.AnalyticsQuery
+		want string
+	}{
+		{
+			name: "unknown metric",
+			q:    models.AnalyticsQuery{Metrics: []string{"sum(1); drop table orders"}},
+			want: "unknown metric",
+		},
+		{
+			name: "unknown dimension",
+			q:    models.AnalyticsQuery{Metrics: []string{models.MetricRevenue}, Dimensions: []string{"o.id"}},
+			want: "unknown dimension",
+		},
+		{
+			name: "unknown filter field",
+			q: models.AnalyticsQuery{
+				Metrics: []string{models.MetricRevenue},
+				Filters: []models.QueryFilter{{Field: "1=1 or c.email", Op: models.OpEq, Value: "x"}},
+			},
+			want: "unknown filter field",
+		},
+		{
+			name: "unknown operator",
+			q: models.AnalyticsQuery{
+				Metrics: []string{models.MetricRevenue},
+				Filters: []models.QueryFilter{{Field: models.DimRegion, Op: "like", Value: "%"}},
+			},
+			want: "unknown filter operator",
+		},
+		{
+			name: "empty in",
+			q: models.AnalyticsQuery{
+				Metrics: []string{models.MetricRevenue},
+				Filters: []models.QueryFilter{{Field: models.DimRegion, Op: models.OpIn}},
+			},
+			want: "has no values",
+		},
+		{
+			name: "empty not_in",
+			q: models.AnalyticsQuery{
+				Metrics: []string{models.MetricRevenue},
+				Filters: []models.QueryFilter{{Field: models.DimRegion, Op: models.OpNotIn, Values: []string{}}},
+			},
+			want: "has no values",
+		},
+		{
+			name: "unknown sort field",
+			q: models.AnalyticsQuery{
+				Metrics: []string{models.MetricRevenue},
+				Sort:    []models.QuerySort{{Field: "revenue` desc, (select 1)"}},
+			},
+			want: "unknown sort field",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args, err := compileQuery(tt.q)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want %q", err, tt.want)
+			}
+			if query != "" || args != nil {
+				t.Errorf("compiled %q with %v despite the error", query, args)
+			}
+		})
+	}
+}
+
+func TestCompileQueryBindsValues(t *testing.T) {
+	hostile := "north' or '1'='1"
+	q := models.AnalyticsQuery{
+		Filter:     models.Filter{Start: "2024-01-01", End: "2024-01-31"},
+		Metrics:    []string{models.MetricRevenue, models.MetricOrders},
+		Dimensions: []string{models.DimMonth},
+		Filters: []models.QueryFilter{
+			{Field: models.DimRegion, Op: models.OpEq, Value: hostile},
+			{Field: models.DimCategory, Op: models.OpNe, Value: "Books"},
+			{Field: models.DimProduct, Op: models.OpIn, Values: []string{"P1", "P2); drop table orders; --"}},
+			{Field: models.DimCustomer, Op: models.OpNotIn, Values: []string{"C9"}},
+		},
+		Sort:  []models.QuerySort{{Field: models.MetricRevenue, Desc: true}, {Field: models.DimMonth}},
+		Limit: 25,
+	}
+
+	query, args, err := compileQuery(q)
+	if err != nil {
+		t.Fatalf("compileQuery: %v", err)
+	}
+
+	for _, v := range []string{hostile, "Books", "P1", "drop table", "C9", "2024-01-01"} {
+		if strings.Contains(query, v) {
+			t.Errorf("value %q is in the SQL:\n%s", v, query)
+		}
+	}
+
+	want := []any{"2024-01-01", "2024-01-31", "2024-01-01", "2024-01-31",
+		hostile, "Books", "P1", "P2); drop table orders; --", "C9", 25}
+	if len(args) != len(want) {
+		t.Fatalf("args = %v, want %v", args, want)
+	}
+	for i := range want {
+		if args[i] != want[i] {
+			t.Errorf("arg %d = %v, want %v", i, args[i], want[i])
+		}
+	}
+	if n := strings.Count(query, "?"); n != len(args) {
+		t.Errorf("%d placeholders for %d args", n, len(args))
+	}
+
+	for _, part := range []string{
+		"not (" + categoryExpr(q.Filter) + " <=> ?)",
+		"l.product_id in (?, ?)",
+		"l.customer_id not in (?)",
+		"group by `month`",
+		"order by `revenue` desc, `month` asc",
+		"limit ?",
+	} {
+		if !strings.Contains(query, part) {
+			t.Errorf("SQL lacks %q:\n%s", part, query)
+		}
+	}
+}
+
+func TestCompileQueryJoins(t *testing.T) {
+	const (
+		customers = "join customers c"
+		products  = "join products p"
+		history   = "customer_history"
+	)
+	tests := []struct {
+		name              string
+		q                 models.AnalyticsQuery
+		customer, product bool
+	}{
+		{
+			name: "lines only",
+			q:    models.AnalyticsQuery{Metrics: []string{models.MetricRevenue}, Dimensions: []string{models.DimProduct, models.DimDay}},
+		},
+		{
+			name:    "category dimension",
+			q:       models.AnalyticsQuery{Metrics: []string{models.MetricRevenue}, Dimensions: []string{models.DimCategory}},
+			product: true,
+		},
+		{
+			name:     "region dimension",
+			q:        models.AnalyticsQuery{Metrics: []string{models.MetricRevenue}, Dimensions: []string{models.DimRegion}},
+			customer: true,
+		},
+		{
+			name:     "customers metric",
+			q:        models.AnalyticsQuery{Metrics: []string{models.MetricCustomers}},
+			customer: true,
+		},
+		{
+			name: "region filter",
+			q: models.AnalyticsQuery{
+				Metrics: []string{models.MetricRevenue},
+				Filters: []models.QueryFilter{{Field: models.DimRegion, Op: models.OpEq, Value: "North"}},
+			},
+			customer: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _, err := compileQuery(tt.q)
+			if err != nil {
+				t.Fatalf("compileQuery: %v", err)
+			}
+			if got := strings.Contains(query, customers); got != tt.customer {
+				t.Errorf("customer joined = %v, want %v", got, tt.customer)
+			}
+			if got := strings.Contains(query, products); got != tt.product {
+				t.Errorf("product joined = %v, want %v", got, tt.product)
+			}
+			if strings.Contains(query, history) {
+				t.Error("history joined without order date attribution")
+			}
+		})
+	}
+
+	q := models.AnalyticsQuery{
+		Filter:     models.Filter{Attribution: models.AttributionOrderDate},
+		Metrics:    []string{models.MetricRevenue},
+		Dimensions: []string{models.DimRegion},
+	}
+	query, _, err := compileQuery(q)
+	if err != nil {
+		t.Fatalf("compileQuery: %v", err)
+	}
+	if !strings.Contains(query, "left join customer_history ch") || strings.Contains(query, products) {
+		t.Errorf("order date attribution joins:\n%s", query)
+	}
+}
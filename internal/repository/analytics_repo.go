@@ -4,7 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 
+	"sales-analytics/internal/constants"
 	"sales-analytics/internal/models"
 )
 
@@ -16,42 +19,140 @@ func NewAnalyticsRepo(db *sql.DB) AnalyticsRepo {
 	return &analyticsRepository{db: db}
 }
 
+// revenueExpr is the revenue of an order item in the base currency; items
+// still waiting for an fx rate have a null base amount and are left out,
+// GetTotalRevenue counts them
+const revenueExpr = `oi.quantity * (oi.unit_price_base * (1-oi.discount)) + oi.shipping_cost_base`
+
+// salesLines is every sale and return booked in the period as one row set,
+// sales on their order date and returns on their return date. attr_date is
+// the date of the original order, historical attributes are taken from it,
+// booked_on the date the line counts on. order_id is null for returns, so
+// counting it counts the orders sold. It takes the period twice.
+const salesLines = `(
+		select oi.product_id, o.customer_id, o.order_date as attr_date,
+			oi.quantity, ` + revenueExpr + ` as gross, 0 as returns,
+			o.id as order_id, o.order_date as booked_on
+		from order_items oi
+		join orders o on o.id = oi.order_id
+		where o.order_date between ? and ?
+		union all
+		select r.product_id, o.customer_id, o.order_date,
+			0, 0, r.amount_base,
+			null, r.return_date
+		from returns r
+		join orders o on o.id = r.order_id
+		where r.return_date between ? and ?
+	) l`
+
+// revenueCols are the gross, returns and net revenue of a group of lines
+const revenueCols = `coalesce(sum(l.gross), 0) as revenue, coalesce(sum(l.returns), 0) as returned,
+		coalesce(sum(l.gross), 0) - coalesce(sum(l.returns), 0) as net`
+
+// periodArgs are the arguments salesLines takes
+func periodArgs(f models.Filter, extra ...any) []any {
+	return append([]any{f.Start, f.End, f.Start, f.End}, extra...)
+}
+
+// customerJoin joins the customer of each of the salesLines l; with
+// AttributionOrderDate the version valid on the order date is joined as ch
+// and the current row as c is the fallback
+func customerJoin(f models.Filter) string {
+	if f.Attribution == models.AttributionOrderDate {
+		return `join customers c on c.id = l.customer_id
+		left join customer_history ch on ch.customer_id = l.customer_id
+			and l.attr_date >= ch.valid_from and (ch.valid_to is null or l.attr_date < ch.valid_to)`
+	}
+	return `join customers c on c.id = l.customer_id`
+}
+
+// productJoin is the product counterpart of customerJoin, joining p and ph
+func productJoin(f models.Filter) string {
+	if f.Attribution == models.AttributionOrderDate {
+		return `join products p on p.id = l.product_id
+		left join product_history ph on ph.product_id = l.product_id
+			and l.attr_date >= ph.valid_from and (ph.valid_to is null or l.attr_date < ph.valid_to)`
+	}
+	return `join products p on p.id = l.product_id`
+}
+
+func regionExpr(f models.Filter) string {
+	if f.Attribution == models.AttributionOrderDate {
+		return "coalesce(ch.region, c.region)"
+	}
+	return "c.region"
+}
+
+func categoryExpr(f models.Filter) string {
+	if f.Attribution == models.AttributionOrderDate {
+		return "coalesce(ph.category, p.category)"
+	}
+	return "p.category"
+}
+
+func productNameExpr(f models.Filter) string {
+	if f.Attribution == models.AttributionOrderDate {
+		return "coalesce(ph.name, p.name)"
+	}
+	return "p.name"
+}
+
+// scope joins and filters the salesLines l to the region and category of
+// the filter; withCustomer joins the customer as c even without a region
+func scope(f models.Filter, withCustomer bool) (string, []any) {
+	var joins, conds []string
+	var args []any
+	if f.Region != "" || withCustomer {
+		joins = append(joins, customerJoin(f))
+	}
+	if f.Region != "" {
+		conds = append(conds, regionExpr(f)+" = ?")
+		args = append(args, f.Region)
+	}
+	if f.Category != "" {
+		joins = append(joins, productJoin(f))
+		conds = append(conds, categoryExpr(f)+" = ?")
+		args = append(args, f.Category)
+	}
+
+	clause := strings.Join(joins, "\n\t\t")
+	if len(conds) > 0 {
+		clause += "\n\t\twhere " + strings.Join(conds, " and ")
+	}
+	return clause, args
+}
+
 func (r *analyticsRepository) GetTotalRevenue(
 	ctx context.Context,
-	start, end string,
-) (float64, error) {
+	f models.Filter,
+) (models.RevenueTotals, error) {
+	clause, args := scope(f, false)
 	query := `
-		select sum(oi.quantity * (oi.unit_price * (1-oi.discount)) + oi.shipping_cost)
-		from order_items oi 
-		join orders o on o.id = oi.order_id
-		where o.order_date between ? and ?`
+		select ` + revenueCols + `, coalesce(sum(l.gross is null or l.returns is null), 0)
+		from ` + salesLines + `
+		` + clause
 
-	var rev sql.NullFloat64
-	err := r.db.QueryRowContext(ctx, query, start, end).Scan(&rev)
+	var t models.RevenueTotals
+	err := r.db.QueryRowContext(ctx, query, periodArgs(f, args...)...).Scan(&t.Gross, &t.Returns, &t.Net, &t.Unconverted)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get total revenue: %w", err)
+		return t, fmt.Errorf("failed to get total revenue: %w", err)
 	}
 
-	if rev.Valid {
-		return rev.Float64, nil
-	}
-	return 0, nil
+	return t, nil
 }
 
 func (r *analyticsRepository) GetRevenueByProduct(
 	ctx context.Context,
-	start, end string,
+	f models.Filter,
 ) ([]models.ProductRevenue, error) {
-	query := `
-		select p.id, p.name, sum(oi.quantity * (oi.unit_price * (1-oi.discount)) + oi.shipping_cost) as revenue
-		from order_items oi 
-		join orders o on o.id = oi.order_id
-		join products p on p.id = oi.product_id
-		where o.order_date between ? and ?
-		group by p.id, p.name
-		order by revenue desc`
-
-	rows, err := r.db.QueryContext(ctx, query, start, end)
+	query := fmt.Sprintf(`
+		select p.id, %s as name, `+revenueCols+`
+		from `+salesLines+`
+		%s
+		group by p.id, name
+		order by revenue desc`, productNameExpr(f), productJoin(f))
+
+	rows, err := r.db.QueryContext(ctx, query, periodArgs(f)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get revenue by product: %w", err)
 	}
@@ -60,7 +161,7 @@ func (r *analyticsRepository) GetRevenueByProduct(
 	var result []models.ProductRevenue
 	for rows.Next() {
 		var rev models.ProductRevenue
-		if err := rows.Scan(&rev.ProductID, &rev.ProductName, &rev.Revenue); err != nil {
+		if err := rows.Scan(&rev.ProductID, &rev.ProductName, &rev.Revenue, &rev.Returns, &rev.Net); err != nil {
 			return nil, fmt.Errorf("failed to scan product revenue row: %w", err)
 		}
 		result = append(result, rev)
@@ -75,18 +176,16 @@ func (r *analyticsRepository) GetRevenueByProduct(
 
 func (r *analyticsRepository) GetRevenueByCategory(
 	ctx context.Context,
-	start, end string,
+	f models.Filter,
 ) ([]models.CategoryRevenue, error) {
-	query := `
-		select p.category, sum(oi.quantity * (oi.unit_price * (1-oi.discount)) + oi.shipping_cost) as revenue
-		from order_items oi 
-		join orders o on o.id = oi.order_id
-		join products p on p.id = oi.product_id
-		where o.order_date between ? and ?
-		group by p.category
-		order by revenue desc`
-
-	rows, err := r.db.QueryContext(ctx, query, start, end)
+	query := fmt.Sprintf(`
+		select %s as category, `+revenueCols+`
+		from `+salesLines+`
+		%s
+		group by category
+		order by revenue desc`, categoryExpr(f), productJoin(f))
+
+	rows, err := r.db.QueryContext(ctx, query, periodArgs(f)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get revenue by category: %w", err)
 	}
@@ -95,7 +194,7 @@ func (r *analyticsRepository) GetRevenueByCategory(
 	var result []models.CategoryRevenue
 	for rows.Next() {
 		var rev models.CategoryRevenue
-		if err := rows.Scan(&rev.Category, &rev.Revenue); err != nil {
+		if err := rows.Scan(&rev.Category, &rev.Revenue, &rev.Returns, &rev.Net); err != nil {
 			return nil, fmt.Errorf("failed to scan category revenue row: %w", err)
 		}
 		result = append(result, rev)
@@ -110,18 +209,16 @@ func (r *analyticsRepository) GetRevenueByCategory(
 
 func (r *analyticsRepository) GetRevenueByRegion(
 	ctx context.Context,
-	start, end string,
+	f models.Filter,
 ) ([]models.RegionRevenue, error) {
-	query := `
-		select c.region, sum(oi.quantity * (oi.unit_price * (1-oi.discount)) + oi.shipping_cost) as revenue
-		from order_items oi 
-		join orders o on o.id = oi.order_id
-		join customers c on c.id = o.customer_id
-		where o.order_date between ? and ?
-		group by c.region
-		order by revenue desc`
-
-	rows, err := r.db.QueryContext(ctx, query, start, end)
+	query := fmt.Sprintf(`
+		select %s as region, `+revenueCols+`
+		from `+salesLines+`
+		%s
+		group by region
+		order by revenue desc`, regionExpr(f), customerJoin(f))
+
+	rows, err := r.db.QueryContext(ctx, query, periodArgs(f)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get revenue by region: %w", err)
 	}
@@ -130,7 +227,7 @@ func (r *analyticsRepository) GetRevenueByRegion(
 	var result []models.RegionRevenue
 	for rows.Next() {
 		var rev models.RegionRevenue
-		if err := rows.Scan(&rev.Region, &rev.Revenue); err != nil {
+		if err := rows.Scan(&rev.Region, &rev.Revenue, &rev.Returns, &rev.Net); err != nil {
 			return nil, fmt.Errorf("failed to scan region revenue row: %w", err)
 		}
 		result = append(result, rev)
@@ -143,23 +240,54 @@ func (r *analyticsRepository) GetRevenueByRegion(
 	return result, nil
 }
 
+func (r *analyticsRepository) GetRevenueByCustomer(
+	ctx context.Context,
+	f models.Filter,
+) ([]models.CustomerRevenue, error) {
+	query := `
+		select l.customer_id, coalesce(c.name, ''), ` + revenueCols + `
+		from ` + salesLines + `
+		left join customers c on c.id = l.customer_id
+		group by l.customer_id, c.name
+		order by revenue desc`
+
+	rows, err := r.db.QueryContext(ctx, query, periodArgs(f)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revenue by customer: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.CustomerRevenue
+	for rows.Next() {
+		var rev models.CustomerRevenue
+		if err := rows.Scan(&rev.CustomerID, &rev.CustomerName, &rev.Revenue, &rev.Returns, &rev.Net); err != nil {
+			return nil, fmt.Errorf("failed to scan customer revenue row: %w", err)
+		}
+		result = append(result, rev)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating customer revenue rows: %w", err)
+	}
+
+	return result, nil
+}
+
 func (r *analyticsRepository) GetTopProducts(
 	ctx context.Context,
-	start, end string,
+	f models.Filter,
 	limit int,
 ) ([]models.TopProduct, error) {
-	query := `
-		select p.id, p.name, sum(oi.quantity) as qty_sold,
-		       sum(oi.quantity * (oi.unit_price * (1-oi.discount)) + oi.shipping_cost) as revenue
-		from order_items oi 
-		join orders o on o.id = oi.order_id
-		join products p on p.id = oi.product_id
-		where o.order_date between ? and ?
-		group by p.id, p.name
+	query := fmt.Sprintf(`
+		select p.id, %s as name, sum(l.quantity) as qty_sold,
+		       `+revenueCols+`
+		from `+salesLines+`
+		%s
+		group by p.id, name
 		order by qty_sold desc
-		limit ?`
+		limit ?`, productNameExpr(f), productJoin(f))
 
-	rows, err := r.db.QueryContext(ctx, query, start, end, limit)
+	rows, err := r.db.QueryContext(ctx, query, periodArgs(f, limit)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get top products: %w", err)
 	}
@@ -168,7 +296,7 @@ func (r *analyticsRepository) GetTopProducts(
 	var result []models.TopProduct
 	for rows.Next() {
 		var product models.TopProduct
-		if err := rows.Scan(&product.ProductID, &product.ProductName, &product.QuantitySold, &product.Revenue); err != nil {
+		if err := rows.Scan(&product.ProductID, &product.ProductName, &product.QuantitySold, &product.Revenue, &product.Returns, &product.Net); err != nil {
 			return nil, fmt.Errorf("failed to scan top product row: %w", err)
 		}
 		result = append(result, product)
@@ -183,15 +311,19 @@ func (r *analyticsRepository) GetTopProducts(
 
 func (r *analyticsRepository) GetCustomerCount(
 	ctx context.Context,
-	start, end string,
+	f models.Filter,
 ) (int, error) {
+	// customers linked to the same person count once, customers not yet
+	// resolved count on their own; returns alone do not make a customer
+	clause, args := scope(f, true)
 	query := `
-		select count(distinct o.customer_id)
-		from orders o
-		where o.order_date between ? and ?`
+		select count(distinct case when l.order_id is not null
+			then coalesce(concat('p:', c.person_id), concat('c:', l.customer_id)) end)
+		from ` + salesLines + `
+		` + clause
 
 	var count int
-	err := r.db.QueryRowContext(ctx, query, start, end).Scan(&count)
+	err := r.db.QueryRowContext(ctx, query, periodArgs(f, args...)...).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get customer count: %w", err)
 	}
@@ -201,15 +333,16 @@ func (r *analyticsRepository) GetCustomerCount(
 
 func (r *analyticsRepository) GetOrderCount(
 	ctx context.Context,
-	start, end string,
+	f models.Filter,
 ) (int, error) {
+	clause, args := scope(f, false)
 	query := `
-		select count(*)
-		from orders o
-		where o.order_date between ? and ?`
+		select count(distinct l.order_id)
+		from ` + salesLines + `
+		` + clause
 
 	var count int
-	err := r.db.QueryRowContext(ctx, query, start, end).Scan(&count)
+	err := r.db.QueryRowContext(ctx, query, periodArgs(f, args...)...).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get order count: %w", err)
 	}
@@ -217,17 +350,21 @@ func (r *analyticsRepository) GetOrderCount(
 	return count, nil
 }
 
+// GetAverageOrderValue is the gross revenue per order; with a region or
+// category only the matching items of each order count. Orders still
+// waiting for an fx rate are left out.
 func (r *analyticsRepository) GetAverageOrderValue(
 	ctx context.Context,
-	start, end string,
+	f models.Filter,
 ) (float64, error) {
+	clause, args := scope(f, false)
 	query := `
-		select avg(total_amount)
-		from orders o
-		where o.order_date between ? and ?`
+		select sum(l.gross) / count(distinct case when l.gross is not null then l.order_id end)
+		from ` + salesLines + `
+		` + clause
 
 	var avg sql.NullFloat64
-	err := r.db.QueryRowContext(ctx, query, start, end).Scan(&avg)
+	err := r.db.QueryRowContext(ctx, query, periodArgs(f, args...)...).Scan(&avg)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get average order value: %w", err)
 	}
@@ -237,3 +374,125 @@ func (r *analyticsRepository) GetAverageOrderValue(
 	}
 	return 0, nil
 }
+
+// GetDailyRevenue returns the revenue, orders and quantity booked per day,
+// per category or region when split is set. Days without sales are left
+// out.
+func (r *analyticsRepository) GetDailyRevenue(
+	ctx context.Context,
+	f models.Filter,
+	split string,
+) ([]models.DailyRevenue, error) {
+	group, join := "''", ""
+	switch split {
+	case "category":
+		group, join = "coalesce("+categoryExpr(f)+", '')", productJoin(f)
+	case "region":
+		group, join = "coalesce("+regionExpr(f)+", '')", customerJoin(f)
+	}
+
+	query := fmt.Sprintf(`
+		select l.booked_on, %s as grp, `+revenueCols+`,
+			count(distinct l.order_id), coalesce(sum(l.quantity), 0)
+		from `+salesLines+`
+		%s
+		group by l.booked_on, grp
+		order by l.booked_on, grp`, group, join)
+
+	rows, err := r.db.QueryContext(ctx, query, periodArgs(f)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily revenue: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.DailyRevenue
+	for rows.Next() {
+		var d models.DailyRevenue
+		if err := rows.Scan(&d.Day, &d.Group, &d.Revenue, &d.Returns, &d.Net, &d.Orders, &d.Quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan daily revenue row: %w", err)
+		}
+		result = append(result, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating daily revenue rows: %w", err)
+	}
+
+	return result, nil
+}
+
+// cohortIndex numbers the months or quarters since year 0 of the salesLines
+// l, so consecutive periods differ by one
+var cohortIndex = map[string]string{
+	models.CohortMonthly:   "year(l.booked_on) * 12 + month(l.booked_on) - 1",
+	models.CohortQuarterly: "year(l.booked_on) * 4 + quarter(l.booked_on) - 1",
+}
+
+// cohortEnd is the last day of the period numbered index
+func cohortEnd(granularity string, index int) string {
+	months := index + 1
+	if granularity == models.CohortQuarterly {
+		months = (index + 1) * 3
+	}
+	return time.Date(0, time.Month(months+1), 0, 0, 0, 0, 0, time.UTC).Format("2006-01-02")
+}
+
+// GetCohortActivity groups customers by the period of their first order
+// ever and returns, per cohort first to last, the customers ordering and
+// their net revenue in every period up to last, returns counting on their
+// return date like everywhere else. Customers linked to one person count
+// once; the shared erased customer is left out.
+func (r *analyticsRepository) GetCohortActivity(
+	ctx context.Context,
+	granularity string,
+	first, last int,
+) ([]models.CohortActivity, error) {
+	index, ok := cohortIndex[granularity]
+	if !ok {
+		return nil, fmt.Errorf("unknown cohort granularity %q", granularity)
+	}
+
+	query := `
+		with activity as (
+			select coalesce(concat('p:', c.person_id), concat('c:', l.customer_id)) as k,
+				` + index + ` as idx, l.order_id, l.gross, l.returns
+			from ` + salesLines + `
+			join customers c on c.id = l.customer_id
+			where l.customer_id <> ?
+		), cohorts as (
+			select k, min(idx) as cohort
+			from activity
+			where order_id is not null
+			group by k
+		)
+		select co.cohort, a.idx - co.cohort as period_offset,
+			count(distinct if(a.order_id is null, null, a.k)),
+			coalesce(sum(a.gross), 0) - coalesce(sum(a.returns), 0)
+		from cohorts co
+		join activity a on a.k = co.k
+		where co.cohort between ? and ? and a.idx <= ?
+		group by co.cohort, period_offset
+		order by co.cohort, period_offset`
+
+	all := models.Filter{Start: historyStart, End: cohortEnd(granularity, last)}
+	rows, err := r.db.QueryContext(ctx, query, periodArgs(all, constants.ErasedCustomerID, first, last, last)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cohort activity: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.CohortActivity
+	for rows.Next() {
+		var a models.CohortActivity
+		if err := rows.Scan(&a.Cohort, &a.Offset, &a.Active, &a.Revenue); err != nil {
+			return nil, fmt.Errorf("failed to scan cohort row: %w", err)
+		}
+		result = append(result, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating cohort rows: %w", err)
+	}
+
+	return result, nil
+}
@@ -2,8 +2,14 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
 )
 
+var ErrLockTimeout = errors.New("timed out waiting for lock")
+
 type Base struct{ DB Database }
 
 func (b Base) Exec(
@@ -14,3 +20,36 @@ func (b Base) Exec(
 	_, err := b.DB.ExecContext(ctx, q, args...)
 	return err
 }
+
+// Lock takes the named advisory lock of the db session, waiting up to
+// timeout. The lock is held until Unlock or the session ends, so db must
+// be a single connection or a transaction.
+func Lock(
+	ctx context.Context,
+	db Database,
+	name string,
+	timeout time.Duration,
+) error {
+	var got sql.NullInt64
+	err := db.QueryRowContext(ctx, "select get_lock(?, ?)", name, int(timeout.Seconds())).Scan(&got)
+	if err != nil {
+		return fmt.Errorf("failed to take lock %s: %w", name, err)
+	}
+	if got.Int64 != 1 {
+		return fmt.Errorf("%w: %s", ErrLockTimeout, name)
+	}
+	return nil
+}
+
+// Unlock releases a lock taken with Lock
+func Unlock(
+	ctx context.Context,
+	db Database,
+	name string,
+) error {
+	_, err := db.ExecContext(ctx, "select release_lock(?)", name)
+	if err != nil {
+		return fmt.Errorf("failed to release lock %s: %w", name, err)
+	}
+	return nil
+}
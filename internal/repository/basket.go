@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"sales-analytics/internal/models"
+)
+
+// GetProductPairs counts the product pairs bought in the same order in the
+// period, keeping pairs in at least minSupport of the orders. With
+// productID only pairs with that product are counted, it always being A.
+// It also returns the number of orders in the period.
+func (r *analyticsRepository) GetProductPairs(
+	ctx context.Context,
+	f models.Filter,
+	productID string,
+	minSupport float64,
+) ([]models.PairCount, int, error) {
+	pairCond := `a.product_id < b.product_id`
+	args := []any{f.Start, f.End}
+	if productID != "" {
+		pairCond = `a.product_id = ? and b.product_id <> a.product_id`
+		args = append(args, productID)
+	}
+	args = append(args, minSupport)
+
+	query := `
+		with baskets as (
+			select distinct oi.order_id, oi.product_id
+			from order_items oi
+			join orders o on o.id = oi.order_id
+			where o.order_date between ? and ?
+		), total as (
+			select count(distinct order_id) as n from baskets
+		), items as (
+			select product_id, count(*) as n from baskets group by product_id
+		), pairs as (
+			select a.product_id as pa, b.product_id as pb, count(*) as n
+			from baskets a
+			join baskets b on b.order_id = a.order_id
+			where ` + pairCond + `
+			group by a.product_id, b.product_id
+			having count(*) >= greatest(1, ceil(? * (select n from total)))
+		)
+		select p.pa, coalesce(pra.name, ''), p.pb, coalesce(prb.name, ''), p.n, ia.n, ib.n,
+			(select n from total)
+		from pairs p
+		join items ia on ia.product_id = p.pa
+		join items ib on ib.product_id = p.pb
+		left join products pra on pra.id = p.pa
+		left join products prb on prb.id = p.pb`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get product pairs: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.PairCount
+	total := 0
+	for rows.Next() {
+		var p models.PairCount
+		if err := rows.Scan(&p.ProductA, &p.NameA, &p.ProductB, &p.NameB,
+			&p.Together, &p.OrdersA, &p.OrdersB, &total); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan product pair row: %w", err)
+		}
+		result = append(result, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating product pair rows: %w", err)
+	}
+
+	// without pairs the total is not read from the result
+	if len(result) == 0 {
+		err := r.db.QueryRowContext(ctx, `
+			select count(*) from orders o
+			where o.order_date between ? and ?
+			and exists(select 1 from order_items oi where oi.order_id = o.id)`, f.Start, f.End).Scan(&total)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to count orders: %w", err)
+		}
+	}
+
+	return result, total, nil
+}
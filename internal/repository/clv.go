@@ -0,0 +1,48 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"sales-analytics/internal/constants"
+	"sales-analytics/internal/models"
+)
+
+// GetCustomerSummaries returns the purchase history of every customer that
+// ordered on or before asOf, with the current name and region
+func (r *analyticsRepository) GetCustomerSummaries(
+	ctx context.Context,
+	asOf string,
+) ([]models.CustomerSummary, error) {
+	query := `
+		select o.customer_id, coalesce(c.name, ''), coalesce(c.region, ''),
+			count(distinct o.order_date), min(o.order_date), max(o.order_date),
+			coalesce(sum(` + revenueExpr + `), 0)
+		from orders o
+		join order_items oi on oi.order_id = o.id
+		left join customers c on c.id = o.customer_id
+		where o.order_date <= ? and o.customer_id <> ?
+		group by o.customer_id, c.name, c.region`
+
+	rows, err := r.db.QueryContext(ctx, query, asOf, constants.ErasedCustomerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get customer summaries: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.CustomerSummary
+	for rows.Next() {
+		var s models.CustomerSummary
+		if err := rows.Scan(&s.CustomerID, &s.CustomerName, &s.Region,
+			&s.Purchases, &s.First, &s.Last, &s.Monetary); err != nil {
+			return nil, fmt.Errorf("failed to scan customer summary row: %w", err)
+		}
+		result = append(result, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating customer summary rows: %w", err)
+	}
+
+	return result, nil
+}
@@ -33,19 +33,29 @@ func (r *customerRepository) BulkUpsert(
 	}
 
 	valueStrings := make([]string, 0, len(customers))
-	valueArgs := make([]interface{}, 0, len(customers)*5)
+	valueArgs := make([]interface{}, 0, len(customers)*9)
+	keys := make([][]any, 0, len(customers))
 
 	for _, c := range customers {
-		valueStrings = append(valueStrings, "(?, ?, ?, ?, ?)")
-		valueArgs = append(valueArgs, c.ID, c.Name, c.Email, c.Region, c.Address)
+		valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, nullif(?, ''), nullif(?, ''), nullif(?, ''), ?)")
+		valueArgs = append(valueArgs, c.ID, c.Name, c.Email, c.Region, c.Address,
+			c.EmailIndex, c.AddressIndex, c.JobID, c.SourceLine)
+		keys = append(keys, []any{c.ID})
 	}
 
-	stmt := `insert into customers(id, name, email, region, address) values ` +
+	if err := captureUndo(ctx, r.DB, customerLineage, customers[0].JobID, keys); err != nil {
+		return 0, err
+	}
+
+	stmt := `insert into customers(id, name, email, region, address, email_index, address_index, job_id, source_line) values ` +
 		strings.Join(valueStrings, ",") +
 		` on duplicate key update 
 		name=values(name),
 		region=values(region),
-		address=values(address)`
+		address=values(address),
+		address_index=values(address_index),
+		job_id=values(job_id),
+		source_line=values(source_line)`
 
 	result, err := r.DB.ExecContext(ctx, stmt, valueArgs...)
 	if err != nil {
@@ -55,3 +65,24 @@ func (r *customerRepository) BulkUpsert(
 	affected, _ := result.RowsAffected()
 	return int(affected), nil
 }
+
+// RecordHistory maintains the type-2 history of the given customers, one
+// version per change of their attributes, sequenced by the order date each
+// was read on. Email and address are compared by their blind indexes, as
+// their ciphertext differs on every load.
+func (r *customerRepository) RecordHistory(
+	ctx context.Context,
+	customers []models.Customer,
+	jobID string,
+) error {
+	versions := make([]version, 0, len(customers))
+	for _, c := range customers {
+		versions = append(versions, version{
+			entity: c.ID,
+			seen:   seenOn(c.AsOf),
+			key:    historyKey(c.Name, c.EmailIndex, c.Region, c.AddressIndex),
+			values: []any{c.Name, c.Email, c.Region, c.Address, nullString(c.EmailIndex), nullString(c.AddressIndex)},
+		})
+	}
+	return recordHistory(ctx, r.DB, customerHistory, versions, jobID)
+}
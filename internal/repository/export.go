@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"sales-analytics/internal/models"
+)
+
+type exportRepository struct {
+	Base
+}
+
+func NewExportRepo(db Database) ExportRepository {
+	return &exportRepository{Base{DB: db}}
+}
+
+// Sales calls fn for every order item matching f, in order date order. Rows
+// are read one at a time, the result set is never held in memory.
+func (r *exportRepository) Sales(
+	ctx context.Context,
+	f models.ExportFilter,
+	fn func(models.SaleRow) error,
+) error {
+	pii := `'', ''`
+	if f.IncludePII {
+		pii = `coalesce(c.email, ''), coalesce(c.address, '')`
+	}
+
+	query := `select o.id, oi.product_id, o.customer_id, p.name, coalesce(p.category, ''),
+			coalesce(c.region, ''), date_format(o.order_date, '%Y-%m-%d'), coalesce(oi.quantity, 0), coalesce(oi.unit_price, 0),
+			coalesce(oi.discount, 0), coalesce(oi.shipping_cost, 0), coalesce(c.name, ''), ` + pii + `,
+			coalesce(oi.currency, '')
+		from order_items oi
+		join orders o on o.id = oi.order_id
+		join products p on p.id = oi.product_id
+		left join customers c on c.id = o.customer_id
+		where o.order_date between ? and ?`
+	args := []any{f.Start, f.End}
+
+	for _, cond := range []struct {
+		column, value string
+	}{
+		{"c.region", f.Region},
+		{"p.category", f.Category},
+		{"o.customer_id", f.CustomerID},
+		{"oi.product_id", f.ProductID},
+	} {
+		if cond.value != "" {
+			query += ` and ` + cond.column + ` = ?`
+			args = append(args, cond.value)
+		}
+	}
+	query += ` order by o.order_date, o.id, oi.product_id`
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query sales: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.SaleRow
+		if err := rows.Scan(&s.OrderID, &s.ProductID, &s.CustomerID, &s.ProductName, &s.Category,
+			&s.Region, &s.DateOfSale, &s.Quantity, &s.UnitPrice,
+			&s.Discount, &s.ShippingCost, &s.CustomerName, &s.CustomerEmail, &s.CustomerAddress,
+			&s.Currency); err != nil {
+			return fmt.Errorf("failed to scan sale row: %w", err)
+		}
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating sale rows: %w", err)
+	}
+
+	return nil
+}
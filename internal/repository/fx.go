@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"sales-analytics/internal/models"
+)
+
+type fxRepository struct {
+	Base
+}
+
+func NewFXRepo(db Database) FXRepository {
+	return &fxRepository{Base{DB: db}}
+}
+
+func (r *fxRepository) BulkUpsert(
+	ctx context.Context,
+	rates []models.FXRate,
+) (int, error) {
+	if len(rates) == 0 {
+		return 0, nil
+	}
+
+	valueStrings := make([]string, 0, len(rates))
+	valueArgs := make([]interface{}, 0, len(rates)*3)
+
+	for _, rate := range rates {
+		valueStrings = append(valueStrings, "(?, ?, ?)")
+		valueArgs = append(valueArgs, rate.Currency, rate.Date, rate.Rate)
+	}
+
+	stmt := `insert into fx_rates(currency, rate_date, rate) values ` +
+		strings.Join(valueStrings, ",") +
+		` on duplicate key update rate=values(rate)`
+
+	result, err := r.DB.ExecContext(ctx, stmt, valueArgs...)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, _ := result.RowsAffected()
+	return int(affected), nil
+}
+
+func (r *fxRepository) All(
+	ctx context.Context,
+) ([]models.FXRate, error) {
+	rows, err := r.DB.QueryContext(ctx, `select currency, rate_date, rate from fx_rates order by currency, rate_date`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query fx rates: %w", err)
+	}
+	defer rows.Close()
+
+	var rates []models.FXRate
+	for rows.Next() {
+		var rate models.FXRate
+		if err := rows.Scan(&rate.Currency, &rate.Date, &rate.Rate); err != nil {
+			return nil, fmt.Errorf("failed to scan fx rate: %w", err)
+		}
+		rates = append(rates, rate)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating fx rates: %w", err)
+	}
+
+	return rates, nil
+}
+
+// Rate returns the rate of currency in effect on the given day, or
+// sql.ErrNoRows when none was loaded for that day or before
+func (r *fxRepository) Rate(
+	ctx context.Context,
+	currency string,
+	on time.Time,
+) (float64, error) {
+	var rate float64
+	err := r.DB.QueryRowContext(ctx, `select rate from fx_rates
+		where currency = ? and rate_date <= ?
+		order by rate_date desc limit 1`, currency, on).Scan(&rate)
+	return rate, err
+}
+
+// Reconvert re-resolves the rate of orders, items and returns in currency
+// dated from the given day on, and of any that had no rate yet. Base
+// amounts are generated from the rate.
+func (r *fxRepository) Reconvert(
+	ctx context.Context,
+	currency string,
+	from time.Time,
+) (int64, int64, int64, error) {
+	res, err := r.DB.ExecContext(ctx, `update orders o
+		set o.fx_rate = (
+			select x.rate from fx_rates x
+			where x.currency = o.currency and x.rate_date <= o.order_date
+			order by x.rate_date desc limit 1)
+		where o.currency = ? and (o.order_date >= ? or o.fx_rate is null)`, currency, from)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to reconvert orders: %w", err)
+	}
+	orders, _ := res.RowsAffected()
+
+	res, err = r.DB.ExecContext(ctx, `update order_items oi
+		join orders o on o.id = oi.order_id
+		set oi.fx_rate = o.fx_rate
+		where oi.currency = ? and (o.order_date >= ? or oi.fx_rate is null)`, currency, from)
+	if err != nil {
+		return orders, 0, 0, fmt.Errorf("failed to reconvert order items: %w", err)
+	}
+	items, _ := res.RowsAffected()
+
+	res, err = r.DB.ExecContext(ctx, `update returns rt
+		set rt.fx_rate = (
+			select x.rate from fx_rates x
+			where x.currency = rt.currency and x.rate_date <= rt.return_date
+			order by x.rate_date desc limit 1)
+		where rt.currency = ? and (rt.return_date >= ? or rt.fx_rate is null)`, currency, from)
+	if err != nil {
+		return orders, items, 0, fmt.Errorf("failed to reconvert returns: %w", err)
+	}
+	returns, _ := res.RowsAffected()
+
+	return orders, items, returns, nil
+}
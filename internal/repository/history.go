@@ -0,0 +1,282 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// historyStart opens the first version of an entity, so orders dated before
+// it was first loaded still resolve to a version
+const historyStart = "1000-01-01"
+
+var historyStartDate = time.Date(1000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// historyTable describes a type-2 history table. Versions are ordered by
+// seen_from, the order date the attributes were read from; valid_from and
+// valid_to are derived from it, with the first version open back to
+// historyStart.
+type historyTable struct {
+	name   string
+	entity string
+	// columns are the attributes stored with a version, compared the ones
+	// whose change opens a new version
+	columns  []string
+	compared []string
+}
+
+var (
+	customerHistory = historyTable{
+		name:     "customer_history",
+		entity:   "customer_id",
+		columns:  []string{"name", "email", "region", "address", "email_index", "address_index"},
+		compared: []string{"name", "email_index", "region", "address_index"},
+	}
+	productHistory = historyTable{
+		name:     "product_history",
+		entity:   "product_id",
+		columns:  []string{"name", "category", "unit_price"},
+		compared: []string{"name", "category", "unit_price"},
+	}
+)
+
+// version is one version of an entity's attributes. Stored versions have
+// an id and their current range, new ones carry the column values to insert.
+type version struct {
+	id     int64
+	entity string
+	seen   time.Time
+	from   time.Time
+	to     time.Time // zero while open
+	key    string    // the compared attributes
+	values []any
+}
+
+func historyKey(attrs ...string) string {
+	return strings.Join(attrs, "\x00")
+}
+
+// seenOn is the date of t, the precision history is kept at
+func seenOn(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// resequence merges incoming versions of one entity into its stored ones
+// by the date they were seen. An incoming version equal to the version in
+// effect on its date adds nothing; one that differs splits that version.
+// On the same date a stored version is kept and the last incoming one wins.
+// It returns the stored versions whose range moved and the versions to add,
+// both with their new range.
+func resequence(
+	stored, incoming []version,
+) (moved, added []version) {
+	all := make([]version, 0, len(stored)+len(incoming))
+	all = append(all, stored...)
+	all = append(all, incoming...)
+	// stable, so stored versions precede incoming ones seen the same day
+	// and incoming ones keep their load order
+	sort.SliceStable(all, func(i, j int) bool { return all[i].seen.Before(all[j].seen) })
+
+	kept := make([]version, 0, len(all))
+	for _, v := range all {
+		if n := len(kept); v.id == 0 && n > 0 {
+			last := kept[n-1]
+			switch {
+			case last.key == v.key:
+				continue
+			case last.seen.Equal(v.seen) && last.id != 0:
+				continue
+			case last.seen.Equal(v.seen):
+				kept = kept[:n-1]
+				if n > 1 && kept[n-2].key == v.key {
+					continue
+				}
+			}
+		}
+		kept = append(kept, v)
+	}
+
+	for i, v := range kept {
+		from, to := v.seen, time.Time{}
+		if i == 0 {
+			from = historyStartDate
+		}
+		if i+1 < len(kept) {
+			to = kept[i+1].seen
+		}
+
+		switch {
+		case v.id == 0:
+			v.from, v.to = from, to
+			added = append(added, v)
+		case !v.from.Equal(from) || !v.to.Equal(to):
+			v.from, v.to = from, to
+			moved = append(moved, v)
+		}
+	}
+	return moved, added
+}
+
+// recordHistory merges incoming versions into the history of their
+// entities. Concurrent writers must be serialized, e.g. with Lock, as
+// entities without history have no rows to lock.
+func recordHistory(
+	ctx context.Context,
+	db Database,
+	t historyTable,
+	incoming []version,
+	jobID string,
+) error {
+	if len(incoming) == 0 {
+		return nil
+	}
+
+	byEntity := make(map[string][]version)
+	for _, v := range incoming {
+		byEntity[v.entity] = append(byEntity[v.entity], v)
+	}
+
+	stored, err := storedVersions(ctx, db, t, byEntity)
+	if err != nil {
+		return err
+	}
+
+	var moved, added []version
+	for entity, vs := range byEntity {
+		m, a := resequence(stored[entity], vs)
+		moved = append(moved, m...)
+		added = append(added, a...)
+	}
+
+	// ranges move first, a version is only ever closed by them, so the new
+	// open version never meets the old one
+	if len(moved) > 0 {
+		rows := make([]string, 0, len(moved))
+		args := make([]any, 0, len(moved)*3)
+		for _, v := range moved {
+			rows = append(rows, "row(?, ?, ?)")
+			args = append(args, v.id, v.from, nullDate(v.to))
+		}
+		stmt := fmt.Sprintf(`update %s h join (values %s) as m (id, valid_from, valid_to) on m.id = h.id
+			set h.valid_from = m.valid_from, h.valid_to = m.valid_to`, t.name, strings.Join(rows, ","))
+		if _, err := db.ExecContext(ctx, stmt, args...); err != nil {
+			return fmt.Errorf("failed to resequence %s: %w", t.name, err)
+		}
+	}
+
+	if len(added) > 0 {
+		cols := len(t.columns) + 5
+		placeholder := "(" + strings.TrimSuffix(strings.Repeat("?, ", cols), ", ") + ")"
+		rows := make([]string, 0, len(added))
+		args := make([]any, 0, len(added)*cols)
+		for _, v := range added {
+			rows = append(rows, placeholder)
+			args = append(args, v.entity)
+			args = append(args, v.values...)
+			args = append(args, v.seen, v.from, nullDate(v.to), jobID)
+		}
+		stmt := fmt.Sprintf(`insert into %s (%s, %s, seen_from, valid_from, valid_to, source_job_id) values %s`,
+			t.name, t.entity, strings.Join(t.columns, ", "), strings.Join(rows, ","))
+		if _, err := db.ExecContext(ctx, stmt, args...); err != nil {
+			return fmt.Errorf("failed to insert %s: %w", t.name, err)
+		}
+	}
+	return nil
+}
+
+// storedVersions loads and locks the history of the given entities, in
+// seen order
+func storedVersions(
+	ctx context.Context,
+	db Database,
+	t historyTable,
+	entities map[string][]version,
+) (map[string][]version, error) {
+	ids := make([]any, 0, len(entities))
+	for id := range entities {
+		ids = append(ids, id)
+	}
+
+	compared := make([]string, len(t.compared))
+	for i, c := range t.compared {
+		compared[i] = "cast(" + c + " as char)"
+	}
+	q := fmt.Sprintf(`select id, %s, seen_from, valid_from, valid_to, %s from %s
+		where %s in (%s) order by %s, seen_from, id for update`,
+		t.entity, strings.Join(compared, ", "), t.name,
+		t.entity, strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", "), t.entity)
+
+	rows, err := db.QueryContext(ctx, q, ids...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", t.name, err)
+	}
+	defer rows.Close()
+
+	stored := make(map[string][]version, len(entities))
+	attrs := make([]sql.NullString, len(t.compared))
+	for rows.Next() {
+		var v version
+		var to sql.NullTime
+		dest := []any{&v.id, &v.entity, &v.seen, &v.from, &to}
+		for i := range attrs {
+			dest = append(dest, &attrs[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", t.name, err)
+		}
+
+		key := make([]string, len(attrs))
+		for i, a := range attrs {
+			key[i] = a.String
+		}
+		v.key = historyKey(key...)
+		v.to = to.Time
+		stored[v.entity] = append(stored[v.entity], v)
+	}
+	return stored, rows.Err()
+}
+
+// restitch recomputes the ranges of the given entities' versions from their
+// seen dates, after versions were removed
+func restitch(
+	ctx context.Context,
+	db Database,
+	t historyTable,
+	entities []string,
+) error {
+	if len(entities) == 0 {
+		return nil
+	}
+
+	args := make([]any, 0, len(entities)+1)
+	for _, e := range entities {
+		args = append(args, e)
+	}
+	args = append(args, historyStart)
+	stmt := fmt.Sprintf(`update %s h join (
+			select id, row_number() over w as n, lead(seen_from) over w as next_from
+			from %s where %s in (%s)
+			window w as (partition by %s order by seen_from, id)
+		) s on s.id = h.id
+		set h.valid_from = if(s.n = 1, ?, h.seen_from), h.valid_to = s.next_from`,
+		t.name, t.name, t.entity, strings.TrimSuffix(strings.Repeat("?, ", len(entities)), ", "), t.entity)
+	_, err := db.ExecContext(ctx, stmt, args...)
+	return err
+}
+
+func nullDate(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
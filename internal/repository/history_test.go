@@ -0,0 +1,246 @@
+package repository
+
+import (
+	"testing"
+	"time"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// span is the expected range and attributes of a version, to is "" while
+// the version is open
+type span struct {
+	id       int64
+	key      string
+	from, to string
+}
+
+func incoming(key, seen string) version {
+	return version{entity: "C1", key: key, seen: day(seen)}
+}
+
+func stored(id int64, key, seen, from, to string) version {
+	v := version{id: id, entity: "C1", key: key, seen: day(seen), from: day(from)}
+	if to != "" {
+		v.to = day(to)
+	}
+	return v
+}
+
+func spans(vs []version) []span {
+	out := make([]span, 0, len(vs))
+	for _, v := range vs {
+		s := span{id: v.id, key: v.key, from: v.from.Format("2006-01-02")}
+		if !v.to.IsZero() {
+			s.to = v.to.Format("2006-01-02")
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func equalSpans(t *testing.T, what string, got []version, want []span) {
+	t.Helper()
+	g := spans(got)
+	if len(g) != len(want) {
+		t.Fatalf("%s = %+v, want %+v", what, g, want)
+	}
+	for i := range g {
+		if g[i] != want[i] {
+			t.Fatalf("%s = %+v, want %+v", what, g, want)
+		}
+	}
+}
+
+func TestResequence(t *testing.T) {
+	tests := []struct {
+		name     string
+		stored   []version
+		incoming []version
+		moved    []span
+		added    []span
+	}{
+		{
+			name: "changes within one file",
+			incoming: []version{
+				incoming("north", "2024-01-05"),
+				incoming("north", "2024-01-20"),
+				incoming("south", "2024-02-10"),
+				incoming("east", "2024-03-01"),
+			},
+			added: []span{
+				{key: "north", from: historyStart, to: "2024-02-10"},
+				{key: "south", from: "2024-02-10", to: "2024-03-01"},
+				{key: "east", from: "2024-03-01"},
+			},
+		},
+		{
+			name: "rows out of order within one file",
+			incoming: []version{
+				incoming("east", "2024-03-01"),
+				incoming("north", "2024-01-05"),
+				incoming("south", "2024-02-10"),
+			},
+			added: []span{
+				{key: "north", from: historyStart, to: "2024-02-10"},
+				{key: "south", from: "2024-02-10", to: "2024-03-01"},
+				{key: "east", from: "2024-03-01"},
+			},
+		},
+		{
+			name: "older attributes again after a change",
+			incoming: []version{
+				incoming("south", "2024-03-10"),
+				incoming("north", "2024-03-01"),
+				incoming("north", "2024-03-15"),
+			},
+			added: []span{
+				{key: "north", from: historyStart, to: "2024-03-10"},
+				{key: "south", from: "2024-03-10", to: "2024-03-15"},
+				{key: "north", from: "2024-03-15"},
+			},
+		},
+		{
+			name: "last row of a day wins",
+			incoming: []version{
+				incoming("north", "2024-01-05"),
+				incoming("south", "2024-01-05"),
+			},
+			added: []span{
+				{key: "south", from: historyStart},
+			},
+		},
+		{
+			name: "later change closes the open version",
+			stored: []version{
+				stored(1, "north", "2024-01-05", historyStart, ""),
+			},
+			incoming: []version{
+				incoming("south", "2024-02-10"),
+			},
+			moved: []span{
+				{id: 1, key: "north", from: historyStart, to: "2024-02-10"},
+			},
+			added: []span{
+				{key: "south", from: "2024-02-10"},
+			},
+		},
+		{
+			name: "unchanged attributes add nothing",
+			stored: []version{
+				stored(1, "north", "2024-01-05", historyStart, ""),
+			},
+			incoming: []version{
+				incoming("north", "2024-04-01"),
+			},
+		},
+		{
+			name: "out of order row splits the version covering it",
+			stored: []version{
+				stored(1, "north", "2024-01-05", historyStart, "2024-03-01"),
+				stored(2, "east", "2024-03-01", "2024-03-01", ""),
+			},
+			incoming: []version{
+				incoming("south", "2024-02-10"),
+			},
+			moved: []span{
+				{id: 1, key: "north", from: historyStart, to: "2024-02-10"},
+			},
+			added: []span{
+				{key: "south", from: "2024-02-10", to: "2024-03-01"},
+			},
+		},
+		{
+			name: "row older than the history becomes the first version",
+			stored: []version{
+				stored(1, "north", "2024-03-01", historyStart, ""),
+			},
+			incoming: []version{
+				incoming("south", "2024-01-05"),
+			},
+			moved: []span{
+				{id: 1, key: "north", from: "2024-03-01"},
+			},
+			added: []span{
+				{key: "south", from: historyStart, to: "2024-03-01"},
+			},
+		},
+		{
+			name: "stored version wins on its own date",
+			stored: []version{
+				stored(1, "north", "2024-03-01", historyStart, ""),
+			},
+			incoming: []version{
+				incoming("south", "2024-03-01"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			moved, added := resequence(tt.stored, tt.incoming)
+			equalSpans(t, "moved", moved, tt.moved)
+			equalSpans(t, "added", added, tt.added)
+		})
+	}
+}
+
+func TestResequenceConverges(t *testing.T) {
+	rows := []version{
+		incoming("north", "2024-01-05"),
+		incoming("south", "2024-02-10"),
+		incoming("east", "2024-03-01"),
+	}
+
+	// the same rows split between two loads in either order end up with
+	// the same history as one load
+	for _, order := range [][2][]int{{{0, 2}, {1}}, {{1}, {2, 0}}, {{2}, {0, 1}}} {
+		var history []version
+		var nextID int64
+		for _, load := range order {
+			var batch []version
+			for _, i := range load {
+				batch = append(batch, rows[i])
+			}
+
+			moved, added := resequence(history, batch)
+			for _, m := range moved {
+				for i := range history {
+					if history[i].id == m.id {
+						history[i] = m
+					}
+				}
+			}
+			for _, a := range added {
+				nextID++
+				a.id = nextID
+				history = append(history, a)
+			}
+		}
+
+		got := make([]span, 0, len(history))
+		for _, s := range spans(history) {
+			s.id = 0
+			got = append(got, s)
+		}
+		want := map[string]span{
+			"north": {key: "north", from: historyStart, to: "2024-02-10"},
+			"south": {key: "south", from: "2024-02-10", to: "2024-03-01"},
+			"east":  {key: "east", from: "2024-03-01"},
+		}
+		if len(got) != len(want) {
+			t.Fatalf("loads %v: history = %+v", order, got)
+		}
+		for _, s := range got {
+			if want[s.key] != s {
+				t.Errorf("loads %v: version %+v, want %+v", order, s, want[s.key])
+			}
+		}
+	}
+}
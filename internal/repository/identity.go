@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"sales-analytics/internal/constants"
+	"sales-analytics/internal/models"
+)
+
+type identityRepository struct {
+	Base
+}
+
+func NewIdentityRepo(db Database) IdentityRepository {
+	return &identityRepository{Base{DB: db}}
+}
+
+// Unlinked returns customers that are not linked to a person yet
+func (r *identityRepository) Unlinked(
+	ctx context.Context,
+	limit int,
+) ([]models.Customer, error) {
+	rows, err := r.DB.QueryContext(ctx, `select id, coalesce(name, ''), coalesce(email, ''),
+		coalesce(region, ''), coalesce(address, '')
+		from customers where person_id is null and erased_at is null order by id limit ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unlinked customers: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.Customer
+	for rows.Next() {
+		var c models.Customer
+		if err := rows.Scan(&c.ID, &c.Name, &c.Email, &c.Region, &c.Address); err != nil {
+			return nil, fmt.Errorf("failed to scan customer row: %w", err)
+		}
+		result = append(result, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating customer rows: %w", err)
+	}
+
+	return result, nil
+}
+
+// UpsertPerson returns the person with the email index of c, creating it
+// from c when there is none. Without an email a new person is always
+// created.
+func (r *identityRepository) UpsertPerson(
+	ctx context.Context,
+	c models.Customer,
+) (int64, bool, error) {
+	// id = last_insert_id(id) makes the existing id available on a duplicate
+	res, err := r.DB.ExecContext(ctx, `insert into persons(name, email, email_index, region, address)
+		values (?, nullif(?, ''), nullif(?, ''), ?, ?)
+		on duplicate key update id = last_insert_id(id)`,
+		c.Name, c.Email, c.EmailIndex, c.Region, c.Address)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to upsert person: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, false, err
+	}
+	affected, _ := res.RowsAffected()
+	return id, affected == 1, nil
+}
+
+// SimilarPersons returns persons whose name sounds like name
+func (r *identityRepository) SimilarPersons(
+	ctx context.Context,
+	name string,
+	exclude int64,
+	limit int,
+) ([]models.Person, error) {
+	rows, err := r.DB.QueryContext(ctx, `select id, name, coalesce(email, ''), coalesce(region, ''),
+		coalesce(address, ''), created_at
+		from persons where name_key = soundex(?) and id <> ? limit ?`, name, exclude, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query similar persons: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.Person
+	for rows.Next() {
+		var p models.Person
+		if err := rows.Scan(&p.ID, &p.Name, &p.Email, &p.Region, &p.Address, &p.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan person row: %w", err)
+		}
+		result = append(result, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating person rows: %w", err)
+	}
+
+	return result, nil
+}
+
+func (r *identityRepository) Link(
+	ctx context.Context,
+	customerID string,
+	personID int64,
+) error {
+	return r.Exec(ctx, `update customers set person_id = ? where id = ?`, personID, customerID)
+}
+
+// Propose records a pending merge, reporting false when the same pair was
+// already proposed
+func (r *identityRepository) Propose(
+	ctx context.Context,
+	c models.MergeCandidate,
+) (bool, error) {
+	res, err := r.DB.ExecContext(ctx, `insert ignore into merge_candidates
+		(person_id, match_person_id, customer_id, rule, score, status)
+		values (?, ?, ?, ?, ?, ?)`,
+		c.PersonID, c.MatchPersonID, c.CustomerID, c.Rule, c.Score, constants.CandidatePending)
+	if err != nil {
+		return false, fmt.Errorf("failed to propose merge: %w", err)
+	}
+	affected, _ := res.RowsAffected()
+	return affected == 1, nil
+}
+
+const candidateColumns = `id, person_id, match_person_id, customer_id, rule, score, status, created_at, decided_at`
+
+func (r *identityRepository) Candidates(
+	ctx context.Context,
+	status string,
+	limit int,
+) ([]models.MergeCandidate, error) {
+	rows, err := r.DB.QueryContext(ctx, `select `+candidateColumns+`
+		from merge_candidates where status = ? order by score desc, id limit ?`, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query merge candidates: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.MergeCandidate
+	for rows.Next() {
+		var c models.MergeCandidate
+		if err := rows.Scan(&c.ID, &c.PersonID, &c.MatchPersonID, &c.CustomerID, &c.Rule,
+			&c.Score, &c.Status, &c.CreatedAt, &c.DecidedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan merge candidate row: %w", err)
+		}
+		result = append(result, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating merge candidate rows: %w", err)
+	}
+
+	return result, nil
+}
+
+// LockCandidate reads a candidate and locks it for the rest of the
+// transaction
+func (r *identityRepository) LockCandidate(
+	ctx context.Context,
+	id int64,
+) (models.MergeCandidate, error) {
+	var c models.MergeCandidate
+	err := r.DB.QueryRowContext(ctx, `select `+candidateColumns+`
+		from merge_candidates where id = ? for update`, id).
+		Scan(&c.ID, &c.PersonID, &c.MatchPersonID, &c.CustomerID, &c.Rule,
+			&c.Score, &c.Status, &c.CreatedAt, &c.DecidedAt)
+	return c, err
+}
+
+func (r *identityRepository) SetCandidateStatus(
+	ctx context.Context,
+	id int64,
+	status string,
+) error {
+	return r.Exec(ctx, `update merge_candidates set status = ?, decided_at = current_timestamp where id = ?`,
+		status, id)
+}
+
+// MergePersons moves every customer of person from to person into and
+// deletes from. Pending candidates that involve from are superseded.
+func (r *identityRepository) MergePersons(
+	ctx context.Context,
+	from, into int64,
+) (int64, error) {
+	res, err := r.DB.ExecContext(ctx, `update customers set person_id = ? where person_id = ?`, into, from)
+	if err != nil {
+		return 0, fmt.Errorf("failed to move customers: %w", err)
+	}
+	moved, _ := res.RowsAffected()
+
+	if err := r.Exec(ctx, `update merge_candidates set status = ?, decided_at = current_timestamp
+		where status = ? and (person_id = ? or match_person_id = ?)`,
+		constants.CandidateSuperseded, constants.CandidatePending, from, from); err != nil {
+		return moved, fmt.Errorf("failed to supersede candidates: %w", err)
+	}
+
+	if err := r.Exec(ctx, `delete from persons where id = ?`, from); err != nil {
+		return moved, fmt.Errorf("failed to delete merged person: %w", err)
+	}
+	return moved, nil
+}
+
+// Person returns a person and the IDs of its customers
+func (r *identityRepository) Person(
+	ctx context.Context,
+	id int64,
+) (models.Person, error) {
+	var p models.Person
+	err := r.DB.QueryRowContext(ctx, `select id, name, coalesce(email, ''), coalesce(region, ''),
+		coalesce(address, ''), created_at from persons where id = ?`, id).
+		Scan(&p.ID, &p.Name, &p.Email, &p.Region, &p.Address, &p.CreatedAt)
+	if err != nil {
+		return p, err
+	}
+
+	rows, err := r.DB.QueryContext(ctx, `select id from customers where person_id = ? order by id`, id)
+	if err != nil {
+		return p, fmt.Errorf("failed to query person customers: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var customerID string
+		if err := rows.Scan(&customerID); err != nil {
+			return p, fmt.Errorf("failed to scan customer id: %w", err)
+		}
+		p.Customers = append(p.Customers, customerID)
+	}
+	return p, rows.Err()
+}
@@ -17,11 +17,13 @@ type Database interface {
 type CustomerRepo interface {
 	Upsert(ctx context.Context, customer models.Customer) error
 	BulkUpsert(ctx context.Context, customers []models.Customer) (int, error)
+	RecordHistory(ctx context.Context, customers []models.Customer, jobID string) error
 }
 
 type ProductRepo interface {
 	Upsert(ctx context.Context, product models.Product) error
 	BulkUpsert(ctx context.Context, products []models.Product) (int, error)
+	RecordHistory(ctx context.Context, products []models.Product, jobID string) error
 }
 
 type OrderRepo interface {
@@ -34,23 +36,100 @@ type ItemRepo interface {
 	BulkUpsert(ctx context.Context, itemParams []models.OrderItem) (int, error)
 }
 
+type IdentityRepository interface {
+	Unlinked(ctx context.Context, limit int) ([]models.Customer, error)
+	UpsertPerson(ctx context.Context, c models.Customer) (id int64, created bool, err error)
+	SimilarPersons(ctx context.Context, name string, exclude int64, limit int) ([]models.Person, error)
+	Link(ctx context.Context, customerID string, personID int64) error
+	Propose(ctx context.Context, c models.MergeCandidate) (bool, error)
+	Candidates(ctx context.Context, status string, limit int) ([]models.MergeCandidate, error)
+	LockCandidate(ctx context.Context, id int64) (models.MergeCandidate, error)
+	SetCandidateStatus(ctx context.Context, id int64, status string) error
+	MergePersons(ctx context.Context, from, into int64) (int64, error)
+	Person(ctx context.Context, id int64) (models.Person, error)
+}
+
+type PrivacyRepository interface {
+	Stale(ctx context.Context, t SealedTable, prefix string, after []string, limit int) ([]models.SealedRow, error)
+	Reseal(ctx context.Context, t SealedTable, row models.SealedRow) error
+
+	LockErasable(ctx context.Context, customerID string) (region string, personID int64, err error)
+	CreateReplacement(ctx context.Context, id, region string) error
+	ReassignOrders(ctx context.Context, from, to string) (int64, error)
+	AnonymizeHistory(ctx context.Context, from, to string) (int64, error)
+	DeleteHistory(ctx context.Context, customerID string) (int64, error)
+	DeleteCustomer(ctx context.Context, customerID string) error
+	DetachPerson(ctx context.Context, personID int64) error
+	RecordErasure(ctx context.Context, e models.Erasure, region string) (int64, error)
+	ErasedSubjects(ctx context.Context) (map[string]string, error)
+	RestoreReplacements(ctx context.Context) error
+}
+
+type ExportRepository interface {
+	Sales(ctx context.Context, f models.ExportFilter, fn func(models.SaleRow) error) error
+}
+
+type ReturnRepo interface {
+	Balance(ctx context.Context, ret models.Return) (sold, returned int, duplicate bool, err error)
+	Insert(ctx context.Context, ret models.Return) error
+}
+
 type JobRepository interface {
-	Insert(ctx context.Context, id string)
+	Insert(ctx context.Context, job models.IngestionJob)
 	SetFailed(ctx context.Context, id, msg string)
+	SetCancelled(ctx context.Context, id, msg string)
 	SetCompleted(ctx context.Context, id string, rows int)
 	Bump(ctx context.Context, id string, rows int)
 	Get(ctx context.Context, id string) (models.IngestionJob, error)
 }
 
+type UploadRepository interface {
+	Create(ctx context.Context, u models.UploadSession) error
+	Get(ctx context.Context, id string) (models.UploadSession, error)
+	SetReceived(ctx context.Context, id string, received int64) error
+	SetFinalized(ctx context.Context, id, jobID string) error
+	Delete(ctx context.Context, id string) error
+	// Expired lists open sessions not updated since before
+	Expired(ctx context.Context, before time.Time) ([]string, error)
+}
+
+type WebhookRepository interface {
+	RecordDelivery(ctx context.Context, d models.WebhookDelivery) error
+	ListDeliveries(ctx context.Context, jobID string) ([]models.WebhookDelivery, error)
+}
+
+type FXRepository interface {
+	BulkUpsert(ctx context.Context, rates []models.FXRate) (int, error)
+	All(ctx context.Context) ([]models.FXRate, error)
+	Rate(ctx context.Context, currency string, on time.Time) (float64, error)
+	Reconvert(ctx context.Context, currency string, from time.Time) (orders, items, returns int64, err error)
+}
+
+// LineageRepo reverts what a single ingestion job wrote, all methods are
+// meant to run in one transaction
+type LineageRepo interface {
+	LockJob(ctx context.Context, jobID string) (models.IngestionJob, error)
+	Revert(ctx context.Context, jobID string) ([]models.TableRollback, error)
+	SetRolledBack(ctx context.Context, jobID string) error
+}
+
 type AnalyticsRepo interface {
-	GetTotalRevenue(ctx context.Context, start, end string) (float64, error)
-	GetRevenueByProduct(ctx context.Context, start, end string) ([]models.ProductRevenue, error)
-	GetRevenueByCategory(ctx context.Context, start, end string) ([]models.CategoryRevenue, error)
-	GetRevenueByRegion(ctx context.Context, start, end string) ([]models.RegionRevenue, error)
-	GetTopProducts(ctx context.Context, start, end string, limit int) ([]models.TopProduct, error)
-	GetCustomerCount(ctx context.Context, start, end string) (int, error)
-	GetOrderCount(ctx context.Context, start, end string) (int, error)
-	GetAverageOrderValue(ctx context.Context, start, end string) (float64, error)
+	GetTotalRevenue(ctx context.Context, f models.Filter) (models.RevenueTotals, error)
+	GetRevenueByProduct(ctx context.Context, f models.Filter) ([]models.ProductRevenue, error)
+	GetRevenueByCategory(ctx context.Context, f models.Filter) ([]models.CategoryRevenue, error)
+	GetRevenueByRegion(ctx context.Context, f models.Filter) ([]models.RegionRevenue, error)
+	GetRevenueByCustomer(ctx context.Context, f models.Filter) ([]models.CustomerRevenue, error)
+	GetTopProducts(ctx context.Context, f models.Filter, limit int) ([]models.TopProduct, error)
+	GetCustomerCount(ctx context.Context, f models.Filter) (int, error)
+	GetOrderCount(ctx context.Context, f models.Filter) (int, error)
+	GetAverageOrderValue(ctx context.Context, f models.Filter) (float64, error)
+	GetDailyRevenue(ctx context.Context, f models.Filter, split string) ([]models.DailyRevenue, error)
+	Query(ctx context.Context, q models.AnalyticsQuery) (models.QueryResult, error)
+	GetCohortActivity(ctx context.Context, granularity string, first, last int) ([]models.CohortActivity, error)
+	GetRFMSegments(ctx context.Context, asOf string) ([]models.RFMSegment, error)
+	GetRFMCustomers(ctx context.Context, asOf, segment string, limit, offset int) ([]models.RFMScore, int, error)
+	GetCustomerSummaries(ctx context.Context, asOf string) ([]models.CustomerSummary, error)
+	GetProductPairs(ctx context.Context, f models.Filter, productID string, minSupport float64) ([]models.PairCount, int, error)
 }
 
 type Store interface {
@@ -1,21 +1,22 @@
 package repository
 
-func NewIngestionRepo(db Database) struct {
+// IngestionRepos are the repositories an ingestion worker writes through,
+// sharing one connection or transaction
+type IngestionRepos struct {
 	Customers CustomerRepo
 	Products  ProductRepo
 	Orders    OrderRepo
 	Items     ItemRepo
-} {
+	Returns   ReturnRepo
+}
+
+func NewIngestionRepo(db Database) IngestionRepos {
 	base := Base{DB: db}
-	return struct {
-		Customers CustomerRepo
-		Products  ProductRepo
-		Orders    OrderRepo
-		Items     ItemRepo
-	}{
+	return IngestionRepos{
 		Customers: &customerRepository{Base: base},
 		Products:  &productRepository{Base: base},
 		Orders:    &orderRepository{Base: base},
 		Items:     &itemRepository{Base: base},
+		Returns:   &returnRepository{Base: base},
 	}
 }
@@ -15,9 +15,10 @@ func NewJobRepo(store *orm.Store) JobRepository {
 
 func (r *jobRepo) Insert(
 	ctx context.Context,
-	id string,
+	job models.IngestionJob,
 ) {
-	r.store.DB.ExecContext(ctx, "insert into ingestion_jobs(job_id,status) values(?,?)", id, "running")
+	r.store.DB.ExecContext(ctx, "insert into ingestion_jobs(job_id,status,mode,callback_url) values(?,?,nullif(?,''),nullif(?,''))",
+		job.JobID, "running", job.Mode, job.CallbackURL)
 }
 
 func (r *jobRepo) SetFailed(
@@ -27,6 +28,13 @@ func (r *jobRepo) SetFailed(
 	r.store.DB.ExecContext(ctx, "update ingestion_jobs set status='failed',error_message=? where job_id=?", msg, id)
 }
 
+func (r *jobRepo) SetCancelled(
+	ctx context.Context,
+	id, msg string,
+) {
+	r.store.DB.ExecContext(ctx, "update ingestion_jobs set status='cancelled',error_message=? where job_id=?", msg, id)
+}
+
 func (r *jobRepo) SetCompleted(
 	ctx context.Context,
 	id string,
@@ -50,7 +58,7 @@ func (r *jobRepo) Get(
 ) (models.IngestionJob, error) {
 	var m models.IngestionJob
 	err := r.store.DB.QueryRowContext(ctx, `select job_id,status,total_rows,processed_rows,
-		coalesce(error_message,''),created_at,updated_at from ingestion_jobs where job_id=?`, id).
-		Scan(&m.JobID, &m.Status, &m.TotalRows, &m.ProcessedRows, &m.ErrorMessage, &m.CreatedAt, &m.UpdatedAt)
+		coalesce(error_message,''),coalesce(mode,''),coalesce(callback_url,''),created_at,updated_at from ingestion_jobs where job_id=?`, id).
+		Scan(&m.JobID, &m.Status, &m.TotalRows, &m.ProcessedRows, &m.ErrorMessage, &m.Mode, &m.CallbackURL, &m.CreatedAt, &m.UpdatedAt)
 	return m, err
 }
@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"sales-analytics/internal/models"
+)
+
+// lineageTable describes a table stamped with job_id and source_line and
+// the undo table its prior row images are kept in
+type lineageTable struct {
+	name string
+	undo string
+	keys []string
+	// columns written by ingestion, restored on rollback
+	columns []string
+}
+
+var (
+	customerLineage = lineageTable{
+		name:    "customers",
+		undo:    "customer_undo",
+		keys:    []string{"id"},
+		columns: []string{"name", "email", "region", "address", "email_index", "address_index"},
+	}
+	productLineage = lineageTable{
+		name:    "products",
+		undo:    "product_undo",
+		keys:    []string{"id"},
+		columns: []string{"name", "category", "unit_price"},
+	}
+	orderLineage = lineageTable{
+		name:    "orders",
+		undo:    "order_undo",
+		keys:    []string{"id"},
+		columns: []string{"customer_id", "order_date", "ordered_at", "total_amount", "currency", "fx_rate"},
+	}
+	itemLineage = lineageTable{
+		name:    "order_items",
+		undo:    "order_item_undo",
+		keys:    []string{"order_id", "product_id"},
+		columns: []string{"quantity", "unit_price", "discount", "shipping_cost", "currency", "fx_rate"},
+	}
+
+	// rollback order, children before parents
+	lineageTables = []lineageTable{itemLineage, orderLineage, productLineage, customerLineage}
+)
+
+// keyMatch joins alias a to alias b on the key columns
+func (t lineageTable) keyMatch(a, b string) string {
+	conds := make([]string, len(t.keys))
+	for i, k := range t.keys {
+		conds[i] = fmt.Sprintf("%s.%s = %s.%s", a, k, b, k)
+	}
+	return strings.Join(conds, " and ")
+}
+
+// assign sets the restorable columns of alias a from alias b
+func (t lineageTable) assign(a, b string) string {
+	sets := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		sets[i] = fmt.Sprintf("%s.%s = %s.%s", a, c, b, c)
+	}
+	return strings.Join(sets, ", ")
+}
+
+// captureUndo saves the current image of the rows about to be written by
+// jobID, unless the job already wrote them. Only the first image per row
+// and job is kept, which is the state from before the job.
+func captureUndo(
+	ctx context.Context,
+	db Database,
+	t lineageTable,
+	jobID string,
+	keys [][]any,
+) error {
+	if jobID == "" || len(keys) == 0 {
+		return nil
+	}
+
+	tuple := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(t.keys)), ", ") + ")"
+	tuples := make([]string, len(keys))
+	args := make([]any, 0, len(keys)*len(t.keys)+2)
+	args = append(args, jobID)
+	for i, k := range keys {
+		tuples[i] = tuple
+		args = append(args, k...)
+	}
+	args = append(args, jobID)
+
+	cols := strings.Join(append(append([]string{}, t.keys...), t.columns...), ", ")
+	stmt := fmt.Sprintf(`insert ignore into %s (job_id, %s, prev_job_id, prev_source_line)
+		select ?, %s, job_id, source_line from %s
+		where (%s) in (%s) and not (job_id <=> ?)`,
+		t.undo, cols, cols, t.name, strings.Join(t.keys, ", "), strings.Join(tuples, ","))
+
+	_, err := db.ExecContext(ctx, stmt, args...)
+	return err
+}
+
+type lineageRepository struct {
+	Base
+}
+
+func NewLineageRepo(db Database) LineageRepo {
+	return &lineageRepository{Base{DB: db}}
+}
+
+// LockJob reads a job and locks it for the rest of the transaction
+func (r *lineageRepository) LockJob(
+	ctx context.Context,
+	jobID string,
+) (models.IngestionJob, error) {
+	var m models.IngestionJob
+	err := r.DB.QueryRowContext(ctx, `select job_id,status,coalesce(mode,'') from ingestion_jobs where job_id=? for update`, jobID).
+		Scan(&m.JobID, &m.Status, &m.Mode)
+	return m, err
+}
+
+// Revert undoes the rows written by jobID: rows it inserted are deleted and
+// rows it updated get their prior values back. Rows a later job changed
+// again are left alone, but that job's undo image is rewritten so rolling
+// it back afterwards does not bring back this job's values.
+func (r *lineageRepository) Revert(
+	ctx context.Context,
+	jobID string,
+) ([]models.TableRollback, error) {
+	result := make([]models.TableRollback, 0, len(lineageTables)+1)
+
+	// returns are only ever inserted
+	res, err := r.DB.ExecContext(ctx, `delete from returns where job_id = ?`, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to roll back returns: %w", err)
+	}
+	deleted, _ := res.RowsAffected()
+	result = append(result, models.TableRollback{Table: "returns", Deleted: deleted})
+
+	for _, t := range lineageTables {
+		tr, err := r.revertTable(ctx, t, jobID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to roll back %s: %w", t.name, err)
+		}
+		result = append(result, tr)
+	}
+
+	for _, h := range []historyTable{customerHistory, productHistory} {
+		if err := r.revertHistory(ctx, h, jobID); err != nil {
+			return nil, fmt.Errorf("failed to roll back %s: %w", h.name, err)
+		}
+	}
+	return result, nil
+}
+
+func (r *lineageRepository) revertTable(
+	ctx context.Context,
+	t lineageTable,
+	jobID string,
+) (models.TableRollback, error) {
+	tr := models.TableRollback{Table: t.name}
+
+	err := r.DB.QueryRowContext(ctx,
+		fmt.Sprintf(`select count(*) from %s where prev_job_id = ? and job_id <> ?`, t.undo),
+		jobID, jobID).Scan(&tr.Superseded)
+	if err != nil {
+		return tr, err
+	}
+
+	if tr.Superseded > 0 {
+		// later images of rows this job updated take this job's prior image
+		stmt := fmt.Sprintf(`update %s l join %s u on u.job_id = ? and %s
+			set %s, l.prev_job_id = u.prev_job_id, l.prev_source_line = u.prev_source_line
+			where l.prev_job_id = ? and l.job_id <> ?`,
+			t.undo, t.undo, t.keyMatch("u", "l"), t.assign("l", "u"))
+		if err := r.Exec(ctx, stmt, jobID, jobID, jobID); err != nil {
+			return tr, err
+		}
+
+		// rows this job inserted did not exist before the later job either
+		stmt = fmt.Sprintf(`delete l from %s l left join %s u on u.job_id = ? and %s
+			where l.prev_job_id = ? and l.job_id <> ? and u.job_id is null`,
+			t.undo, t.undo, t.keyMatch("u", "l"))
+		if err := r.Exec(ctx, stmt, jobID, jobID, jobID); err != nil {
+			return tr, err
+		}
+	}
+
+	res, err := r.DB.ExecContext(ctx, fmt.Sprintf(`delete t from %s t left join %s u on u.job_id = ? and %s
+		where t.job_id = ? and u.job_id is null`, t.name, t.undo, t.keyMatch("u", "t")),
+		jobID, jobID)
+	if err != nil {
+		return tr, err
+	}
+	tr.Deleted, _ = res.RowsAffected()
+
+	res, err = r.DB.ExecContext(ctx, fmt.Sprintf(`update %s t join %s u on u.job_id = ? and %s
+		set %s, t.job_id = u.prev_job_id, t.source_line = u.prev_source_line
+		where t.job_id = ?`, t.name, t.undo, t.keyMatch("u", "t"), t.assign("t", "u")),
+		jobID, jobID)
+	if err != nil {
+		return tr, err
+	}
+	tr.Restored, _ = res.RowsAffected()
+
+	err = r.Exec(ctx, fmt.Sprintf(`delete from %s where job_id = ?`, t.undo), jobID)
+	return tr, err
+}
+
+// revertHistory removes the history versions a job added and stretches
+// the remaining versions of their entities over the gaps
+func (r *lineageRepository) revertHistory(
+	ctx context.Context,
+	t historyTable,
+	jobID string,
+) error {
+	rows, err := r.DB.QueryContext(ctx,
+		fmt.Sprintf(`select distinct %s from %s where source_job_id = ?`, t.entity, t.name), jobID)
+	if err != nil {
+		return err
+	}
+	var entities []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		entities = append(entities, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if err := r.Exec(ctx, fmt.Sprintf(`delete from %s where source_job_id = ?`, t.name), jobID); err != nil {
+		return err
+	}
+
+	for len(entities) > 0 {
+		n := min(len(entities), 1000)
+		if err := restitch(ctx, r.DB, t, entities[:n]); err != nil {
+			return err
+		}
+		entities = entities[n:]
+	}
+	return nil
+}
+
+// SetRolledBack marks a job as rolled back
+func (r *lineageRepository) SetRolledBack(
+	ctx context.Context,
+	jobID string,
+) error {
+	return r.Exec(ctx, "update ingestion_jobs set status='rolled_back' where job_id=?", jobID)
+}
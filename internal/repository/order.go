@@ -35,19 +35,30 @@ func (r *orderRepository) BulkUpsert(
 	}
 
 	valueStrings := make([]string, 0, len(orderParams))
-	valueArgs := make([]interface{}, 0, len(orderParams)*4)
+	valueArgs := make([]interface{}, 0, len(orderParams)*9)
+	keys := make([][]any, 0, len(orderParams))
 
 	for _, o := range orderParams {
-		valueStrings = append(valueStrings, "(?, ?, ?, ?)")
-		valueArgs = append(valueArgs, o.ID, o.CustomerID, o.OrderDate, o.TotalAmount)
+		valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, nullif(?, 0), nullif(?, ''), ?)")
+		valueArgs = append(valueArgs, o.ID, o.CustomerID, o.OrderDate, o.OrderedAt, o.TotalAmount, o.Currency, o.FXRate, o.JobID, o.SourceLine)
+		keys = append(keys, []any{o.ID})
 	}
 
-	stmt := `insert into orders(id, customer_id, order_date, total_amount) values ` +
+	if err := captureUndo(ctx, r.DB, orderLineage, orderParams[0].JobID, keys); err != nil {
+		return 0, err
+	}
+
+	stmt := `insert into orders(id, customer_id, order_date, ordered_at, total_amount, currency, fx_rate, job_id, source_line) values ` +
 		strings.Join(valueStrings, ",") +
 		` on duplicate key update 
 		customer_id=values(customer_id),
 		order_date=values(order_date),
-		total_amount=values(total_amount)`
+		ordered_at=values(ordered_at),
+		total_amount=values(total_amount),
+		currency=values(currency),
+		fx_rate=values(fx_rate),
+		job_id=values(job_id),
+		source_line=values(source_line)`
 
 	result, err := r.DB.ExecContext(ctx, stmt, valueArgs...)
 	if err != nil {
@@ -34,26 +34,40 @@ func (r *itemRepository) BulkUpsert(
 	}
 
 	valueStrings := make([]string, 0, len(itemParams))
-	valueArgs := make([]interface{}, 0, len(itemParams)*6)
+	valueArgs := make([]interface{}, 0, len(itemParams)*10)
+	keys := make([][]any, 0, len(itemParams))
 
 	for _, item := range itemParams {
-		valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?)")
+		valueStrings = append(valueStrings, "(?, ?, ?, ?, ?, ?, ?, nullif(?, 0), nullif(?, ''), ?)")
 		valueArgs = append(valueArgs,
 			item.OrderID,
 			item.ProductID,
 			item.Quantity,
 			item.UnitPrice,
 			item.Discount,
-			item.ShippingCost)
+			item.ShippingCost,
+			item.Currency,
+			item.FXRate,
+			item.JobID,
+			item.SourceLine)
+		keys = append(keys, []any{item.OrderID, item.ProductID})
 	}
 
-	stmt := `insert into order_items(order_id, product_id, quantity, unit_price, discount, shipping_cost) values ` +
+	if err := captureUndo(ctx, r.DB, itemLineage, itemParams[0].JobID, keys); err != nil {
+		return 0, err
+	}
+
+	stmt := `insert into order_items(order_id, product_id, quantity, unit_price, discount, shipping_cost, currency, fx_rate, job_id, source_line) values ` +
 		strings.Join(valueStrings, ",") +
 		` on duplicate key update 
 		quantity=values(quantity),
 		unit_price=values(unit_price),
 		discount=values(discount),
-		shipping_cost=values(shipping_cost)`
+		shipping_cost=values(shipping_cost),
+		currency=values(currency),
+		fx_rate=values(fx_rate),
+		job_id=values(job_id),
+		source_line=values(source_line)`
 
 	result, err := r.DB.ExecContext(ctx, stmt, valueArgs...)
 	if err != nil {
@@ -0,0 +1,291 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"sales-analytics/internal/models"
+)
+
+// SealedTable describes a table holding encrypted email and address
+// columns and their blind indexes
+type SealedTable struct {
+	Name string
+	Keys []string
+	// persons only index the email
+	AddressIndex bool
+}
+
+// SealedTables are every table personal data is stored in
+var SealedTables = []SealedTable{
+	{Name: "customers", Keys: []string{"id"}, AddressIndex: true},
+	{Name: "customer_history", Keys: []string{"id"}, AddressIndex: true},
+	{Name: "customer_undo", Keys: []string{"job_id", "id"}, AddressIndex: true},
+	{Name: "persons", Keys: []string{"id"}},
+}
+
+type privacyRepository struct {
+	Base
+}
+
+func NewPrivacyRepo(db Database) PrivacyRepository {
+	return &privacyRepository{Base{DB: db}}
+}
+
+// Stale returns rows after the key after whose email or address is not
+// encrypted with the key of prefix, in key order
+func (r *privacyRepository) Stale(
+	ctx context.Context,
+	t SealedTable,
+	prefix string,
+	after []string,
+	limit int,
+) ([]models.SealedRow, error) {
+	keys := strings.Join(t.Keys, ", ")
+	args := []any{prefix + "%", prefix + "%"}
+
+	cursor := ""
+	if after != nil {
+		cursor = fmt.Sprintf("and (%s) > (%s)", keys, placeholders(len(t.Keys)))
+		for _, k := range after {
+			args = append(args, k)
+		}
+	}
+	args = append(args, limit)
+
+	query := fmt.Sprintf(`select %s, coalesce(email, ''), coalesce(address, '')
+		from %s
+		where ((email is not null and email not like ?) or (address is not null and address not like ?))
+		%s
+		order by %s
+		limit ?`, keys, t.Name, cursor, keys)
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s: %w", t.Name, err)
+	}
+	defer rows.Close()
+
+	var result []models.SealedRow
+	for rows.Next() {
+		row := models.SealedRow{Key: make([]string, len(t.Keys))}
+		dest := make([]any, 0, len(t.Keys)+2)
+		for i := range row.Key {
+			dest = append(dest, &row.Key[i])
+		}
+		dest = append(dest, &row.Email, &row.Address)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan %s row: %w", t.Name, err)
+		}
+		result = append(result, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating %s rows: %w", t.Name, err)
+	}
+
+	return result, nil
+}
+
+// Reseal writes the re-encrypted values and indexes of a row
+func (r *privacyRepository) Reseal(
+	ctx context.Context,
+	t SealedTable,
+	row models.SealedRow,
+) error {
+	sets := "email = nullif(?, ''), address = nullif(?, ''), email_index = nullif(?, '')"
+	args := []any{row.Email, row.Address, row.EmailIndex}
+	if t.AddressIndex {
+		sets += ", address_index = nullif(?, '')"
+		args = append(args, row.AddressIndex)
+	}
+	for _, k := range row.Key {
+		args = append(args, k)
+	}
+
+	stmt := fmt.Sprintf(`update %s set %s where (%s) = (%s)`,
+		t.Name, sets, strings.Join(t.Keys, ", "), placeholders(len(t.Keys)))
+	return r.Exec(ctx, stmt, args...)
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// LockErasable reads the region and person of a customer that was not
+// erased yet and locks it for the rest of the transaction
+func (r *privacyRepository) LockErasable(
+	ctx context.Context,
+	customerID string,
+) (region string, personID int64, err error) {
+	err = r.DB.QueryRowContext(ctx, `select coalesce(region, ''), coalesce(person_id, 0)
+		from customers where id = ? and erased_at is null for update`, customerID).
+		Scan(&region, &personID)
+	return region, personID, err
+}
+
+// CreateReplacement inserts the customer that takes over the orders of an
+// erased one. It keeps the region, so revenue by region is unchanged.
+func (r *privacyRepository) CreateReplacement(
+	ctx context.Context,
+	id, region string,
+) error {
+	return r.Exec(ctx, `insert ignore into customers(id, region, erased_at)
+		values (?, nullif(?, ''), current_timestamp)`, id, region)
+}
+
+// ReassignOrders moves the orders of a customer, and their undo images, to
+// another customer
+func (r *privacyRepository) ReassignOrders(
+	ctx context.Context,
+	from, to string,
+) (int64, error) {
+	res, err := r.DB.ExecContext(ctx, `update orders set customer_id = ? where customer_id = ?`, to, from)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reassign orders: %w", err)
+	}
+	moved, _ := res.RowsAffected()
+
+	if err := r.Exec(ctx, `update order_undo set customer_id = ? where customer_id = ?`, to, from); err != nil {
+		return moved, fmt.Errorf("failed to reassign order undo images: %w", err)
+	}
+	if err := r.Exec(ctx, `update merge_candidates set customer_id = ? where customer_id = ?`, to, from); err != nil {
+		return moved, fmt.Errorf("failed to reassign merge candidates: %w", err)
+	}
+	return moved, nil
+}
+
+// AnonymizeHistory moves the history versions and undo images of a
+// customer to its replacement with the personal data removed, so neither
+// attribution nor a rollback brings it back
+func (r *privacyRepository) AnonymizeHistory(
+	ctx context.Context,
+	from, to string,
+) (int64, error) {
+	res, err := r.DB.ExecContext(ctx, `update customer_history
+		set customer_id = ?, name = null, email = null, address = null, email_index = null, address_index = null
+		where customer_id = ?`, to, from)
+	if err != nil {
+		return 0, fmt.Errorf("failed to anonymize customer history: %w", err)
+	}
+	n, _ := res.RowsAffected()
+
+	if err := r.Exec(ctx, `update customer_undo
+		set id = ?, name = null, email = null, address = null, email_index = null, address_index = null
+		where id = ?`, to, from); err != nil {
+		return n, fmt.Errorf("failed to anonymize customer undo images: %w", err)
+	}
+	return n, nil
+}
+
+// DeleteHistory removes the history versions and undo images of a customer
+func (r *privacyRepository) DeleteHistory(
+	ctx context.Context,
+	customerID string,
+) (int64, error) {
+	res, err := r.DB.ExecContext(ctx, `delete from customer_history where customer_id = ?`, customerID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete customer history: %w", err)
+	}
+	n, _ := res.RowsAffected()
+
+	if err := r.Exec(ctx, `delete from customer_undo where id = ?`, customerID); err != nil {
+		return n, fmt.Errorf("failed to delete customer undo images: %w", err)
+	}
+	return n, nil
+}
+
+func (r *privacyRepository) DeleteCustomer(
+	ctx context.Context,
+	customerID string,
+) error {
+	return r.Exec(ctx, `delete from customers where id = ?`, customerID)
+}
+
+// DetachPerson is called once a customer left a person: a person without
+// customers is deleted with its merge candidates, otherwise its details are
+// taken from one of the remaining customers as they may have come from the
+// one that left
+func (r *privacyRepository) DetachPerson(
+	ctx context.Context,
+	personID int64,
+) error {
+	var remaining int
+	err := r.DB.QueryRowContext(ctx, `select count(*) from customers where person_id = ?`, personID).
+		Scan(&remaining)
+	if err != nil {
+		return fmt.Errorf("failed to count person customers: %w", err)
+	}
+
+	if remaining == 0 {
+		if err := r.Exec(ctx, `delete from merge_candidates where person_id = ? or match_person_id = ?`,
+			personID, personID); err != nil {
+			return fmt.Errorf("failed to delete merge candidates: %w", err)
+		}
+		return r.Exec(ctx, `delete from persons where id = ?`, personID)
+	}
+
+	return r.Exec(ctx, `update persons p
+		join (select name, email, email_index, region, address from customers
+			where person_id = ? order by id limit 1) c
+		set p.name = coalesce(c.name, ''), p.email = c.email, p.email_index = c.email_index,
+			p.region = c.region, p.address = c.address
+		where p.id = ?`, personID, personID)
+}
+
+// RecordErasure remembers the subject so ingestion keeps its data out, and
+// writes the audit record
+func (r *privacyRepository) RecordErasure(
+	ctx context.Context,
+	e models.Erasure,
+	region string,
+) (int64, error) {
+	if err := r.Exec(ctx, `insert into erased_subjects(subject_hash, replacement_id, region, mode)
+		values (?, ?, nullif(?, ''), ?)
+		on duplicate key update replacement_id = values(replacement_id), region = values(region),
+			mode = values(mode), erased_at = current_timestamp`,
+		e.SubjectHash, e.Replacement, region, e.Mode); err != nil {
+		return 0, fmt.Errorf("failed to record erased subject: %w", err)
+	}
+
+	res, err := r.DB.ExecContext(ctx, `insert into erasure_audit
+		(subject_hash, mode, reason, replacement_id, orders, history_rows, erased_at)
+		values (?, ?, nullif(?, ''), ?, ?, ?, ?)`,
+		e.SubjectHash, e.Mode, e.Reason, e.Replacement, e.Orders, e.History, e.ErasedAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to write erasure audit: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// ErasedSubjects maps the subject hash of every erased customer to the
+// customer its orders were given to
+func (r *privacyRepository) ErasedSubjects(
+	ctx context.Context,
+) (map[string]string, error) {
+	rows, err := r.DB.QueryContext(ctx, `select subject_hash, replacement_id from erased_subjects`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query erased subjects: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[string]string)
+	for rows.Next() {
+		var hash, replacement string
+		if err := rows.Scan(&hash, &replacement); err != nil {
+			return nil, fmt.Errorf("failed to scan erased subject: %w", err)
+		}
+		result[hash] = replacement
+	}
+	return result, rows.Err()
+}
+
+// RestoreReplacements recreates replacement customers an overwrite load
+// truncated
+func (r *privacyRepository) RestoreReplacements(
+	ctx context.Context,
+) error {
+	return r.Exec(ctx, `insert ignore into customers(id, region, erased_at)
+		select replacement_id, region, erased_at from erased_subjects`)
+}
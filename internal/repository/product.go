@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"strconv"
 	"strings"
 
 	"sales-analytics/internal/models"
@@ -33,19 +34,27 @@ func (r *productRepository) BulkUpsert(
 	}
 
 	valueStrings := make([]string, 0, len(products))
-	valueArgs := make([]interface{}, 0, len(products)*4)
+	valueArgs := make([]interface{}, 0, len(products)*6)
+	keys := make([][]any, 0, len(products))
 
 	for _, p := range products {
-		valueStrings = append(valueStrings, "(?, ?, ?, ?)")
-		valueArgs = append(valueArgs, p.ID, p.Name, p.Category, p.UnitPrice)
+		valueStrings = append(valueStrings, "(?, ?, ?, ?, nullif(?, ''), ?)")
+		valueArgs = append(valueArgs, p.ID, p.Name, p.Category, p.UnitPrice, p.JobID, p.SourceLine)
+		keys = append(keys, []any{p.ID})
 	}
 
-	stmt := `insert into products(id, name, category, unit_price) values ` +
+	if err := captureUndo(ctx, r.DB, productLineage, products[0].JobID, keys); err != nil {
+		return 0, err
+	}
+
+	stmt := `insert into products(id, name, category, unit_price, job_id, source_line) values ` +
 		strings.Join(valueStrings, ",") +
 		` on duplicate key update 
 		name=values(name),
 		category=values(category),
-		unit_price=values(unit_price)`
+		unit_price=values(unit_price),
+		job_id=values(job_id),
+		source_line=values(source_line)`
 
 	result, err := r.DB.ExecContext(ctx, stmt, valueArgs...)
 	if err != nil {
@@ -55,3 +64,24 @@ func (r *productRepository) BulkUpsert(
 	affected, _ := result.RowsAffected()
 	return int(affected), nil
 }
+
+// RecordHistory maintains the type-2 history of the given products, see
+// customerRepository.RecordHistory. Prices are compared at the two decimals
+// they are stored with.
+func (r *productRepository) RecordHistory(
+	ctx context.Context,
+	products []models.Product,
+	jobID string,
+) error {
+	versions := make([]version, 0, len(products))
+	for _, p := range products {
+		price := strconv.FormatFloat(p.UnitPrice, 'f', 2, 64)
+		versions = append(versions, version{
+			entity: p.ID,
+			seen:   seenOn(p.AsOf),
+			key:    historyKey(p.Name, p.Category, price),
+			values: []any{p.Name, p.Category, price},
+		})
+	}
+	return recordHistory(ctx, r.DB, productHistory, versions, jobID)
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"sales-analytics/internal/models"
+)
+
+type returnRepository struct {
+	Base
+}
+
+func NewReturnRepo(db Database) ReturnRepo {
+	return &returnRepository{Base{DB: db}}
+}
+
+// Balance locks the order item a return is for and reports how many units
+// were sold and already returned or refunded, and whether the same return
+// was already recorded: same kind and day from the same source line, as a
+// reload of the file gives it. Returns of one item on one day from other
+// lines are partial returns of their own. sold is -1 when the order item
+// does not exist.
+func (r *returnRepository) Balance(
+	ctx context.Context,
+	ret models.Return,
+) (sold, returned int, duplicate bool, err error) {
+	err = r.DB.QueryRowContext(ctx, `select quantity from order_items
+		where order_id = ? and product_id = ? for update`, ret.OrderID, ret.ProductID).Scan(&sold)
+	if err == sql.ErrNoRows {
+		return -1, 0, false, nil
+	}
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	err = r.DB.QueryRowContext(ctx, `select coalesce(sum(quantity), 0),
+			coalesce(sum(kind = ? and return_date = ? and source_line <=> ?), 0) > 0
+		from returns where order_id = ? and product_id = ?`,
+		ret.Kind, ret.Date, ret.SourceLine, ret.OrderID, ret.ProductID).Scan(&returned, &duplicate)
+	return sold, returned, duplicate, err
+}
+
+// Insert records a return, one per order item, kind, day and source line
+func (r *returnRepository) Insert(
+	ctx context.Context,
+	ret models.Return,
+) error {
+	return r.Exec(ctx, `insert into returns
+		(order_id, product_id, kind, return_date, quantity, amount, currency, fx_rate, job_id, source_line)
+		values (?, ?, ?, ?, ?, ?, ?, nullif(?, 0), nullif(?, ''), ?)`,
+		ret.OrderID, ret.ProductID, ret.Kind, ret.Date, ret.Quantity, ret.Amount,
+		ret.Currency, ret.FXRate, ret.JobID, ret.SourceLine)
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"sales-analytics/internal/constants"
+	"sales-analytics/internal/models"
+)
+
+// rfmRules assign segments from the recency score r and fm, the rounded
+// mean of the frequency and monetary scores; the first match wins
+var rfmRules = []struct {
+	segment string
+	cond    string
+}{
+	{models.SegmentChampions, "r >= 4 and fm >= 4"},
+	{models.SegmentLoyal, "r >= 3 and fm >= 4"},
+	{models.SegmentPotentialLoyalists, "r >= 4 and fm >= 2"},
+	{models.SegmentNewCustomers, "r >= 4"},
+	{models.SegmentNeedAttention, "r = 3 and fm >= 3"},
+	{models.SegmentAboutToSleep, "r = 3"},
+	{models.SegmentAtRisk, "fm >= 4"},
+	{models.SegmentHibernating, "r = 2"},
+	{models.SegmentLost, "true"},
+}
+
+// quintile scores rows 1 to 5 by the share of rows ranked strictly below
+// them in order. Equal values always score the same, at the bottom of the
+// range they share: when most customers ordered once, they all score 1.
+func quintile(order string) string {
+	return "least(5, 1 + floor(5 * percent_rank() over (order by " + order + ")))"
+}
+
+// rfmScored scores every customer that ordered on or before the reference
+// date, taken twice
+func rfmScored() string {
+	cases := make([]string, len(rfmRules))
+	for i, rule := range rfmRules {
+		cases[i] = "when " + rule.cond + " then '" + rule.segment + "'"
+	}
+
+	return `with stats as (
+			select o.customer_id, datediff(?, max(o.order_date)) as recency_days,
+				count(distinct o.id) as frequency, coalesce(sum(` + revenueExpr + `), 0) as monetary
+			from orders o
+			join order_items oi on oi.order_id = o.id
+			where o.order_date <= ? and o.customer_id <> ?
+			group by o.customer_id
+		), quintiles as (
+			select s.*,
+				` + quintile("recency_days desc") + ` as r,
+				` + quintile("frequency") + ` as f,
+				` + quintile("monetary") + ` as m
+			from stats s
+		), scored as (
+			select q.*, round((q.f + q.m) / 2) as fm
+			from quintiles q
+		), segmented as (
+			select s.*, case ` + strings.Join(cases, " ") + ` end as segment
+			from scored s
+		)`
+}
+
+func (r *analyticsRepository) GetRFMSegments(
+	ctx context.Context,
+	asOf string,
+) ([]models.RFMSegment, error) {
+	query := rfmScored() + `
+		select segment, count(*), avg(recency_days), avg(frequency), avg(monetary), sum(monetary)
+		from segmented
+		group by segment`
+
+	rows, err := r.db.QueryContext(ctx, query, asOf, asOf, constants.ErasedCustomerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rfm segments: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.RFMSegment
+	for rows.Next() {
+		var s models.RFMSegment
+		if err := rows.Scan(&s.Segment, &s.Customers, &s.AvgRecencyDays, &s.AvgFrequency, &s.AvgMonetary, &s.Monetary); err != nil {
+			return nil, fmt.Errorf("failed to scan rfm segment row: %w", err)
+		}
+		result = append(result, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rfm segment rows: %w", err)
+	}
+
+	return result, nil
+}
+
+// GetRFMCustomers returns a page of scored customers, best first, and the
+// number of customers across all pages; segment restricts them when set
+func (r *analyticsRepository) GetRFMCustomers(
+	ctx context.Context,
+	asOf, segment string,
+	limit, offset int,
+) ([]models.RFMScore, int, error) {
+	args := []any{asOf, asOf, constants.ErasedCustomerID}
+	where := ""
+	if segment != "" {
+		where = "where s.segment = ?"
+		args = append(args, segment)
+	}
+	query := rfmScored() + `
+		select s.customer_id, coalesce(c.name, ''), s.recency_days, s.frequency, s.monetary,
+			s.r, s.f, s.m, s.segment, count(*) over ()
+		from segmented s
+		left join customers c on c.id = s.customer_id
+		` + where + `
+		order by s.r + s.f + s.m desc, s.monetary desc, s.customer_id
+		limit ? offset ?`
+	args = append(args, limit, offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get rfm customers: %w", err)
+	}
+	defer rows.Close()
+
+	result := []models.RFMScore{}
+	total := 0
+	for rows.Next() {
+		var s models.RFMScore
+		if err := rows.Scan(&s.CustomerID, &s.CustomerName, &s.RecencyDays, &s.Frequency, &s.Monetary,
+			&s.R, &s.F, &s.M, &s.Segment, &total); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan rfm customer row: %w", err)
+		}
+		result = append(result, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating rfm customer rows: %w", err)
+	}
+
+	return result, total, nil
+}
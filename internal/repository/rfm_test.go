@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// percentRank is MySQL's percent_rank() over values in ascending order:
+// (rank - 1) / (rows - 1), rank counting from the first row of a tie
+func percentRank(values []int) []float64 {
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+	ranks := make([]float64, len(values))
+	for i, v := range values {
+		below := sort.SearchInts(sorted, v)
+		if len(values) > 1 {
+			ranks[i] = float64(below) / float64(len(values)-1)
+		}
+	}
+	return ranks
+}
+
+// score evaluates the quintile expression on a percent rank
+func score(rank float64) int {
+	return int(math.Min(5, 1+math.Floor(5*rank)))
+}
+
+func TestQuintileExpr(t *testing.T) {
+	want := "least(5, 1 + floor(5 * percent_rank() over (order by frequency)))"
+	if got := quintile("frequency"); got != want {
+		t.Fatalf("quintile = %s, want %s", got, want)
+	}
+	q := rfmScored()
+	for _, order := range []string{"recency_days desc", "frequency", "monetary"} {
+		if !strings.Contains(q, quintile(order)) {
+			t.Errorf("rfmScored does not score by %s with quintile", order)
+		}
+	}
+}
+
+// TestQuintileTies evaluates the quintile expression on heavily tied
+// columns the way MySQL computes it, the tests run without a database
+func TestQuintileTies(t *testing.T) {
+	tests := []struct {
+		name      string
+		frequency map[int]int // orders -> customers
+		want      map[int]int // orders -> score
+	}{
+		{
+			name:      "most customers ordered once",
+			frequency: map[int]int{1: 70, 2: 15, 3: 10, 8: 5},
+			want:      map[int]int{1: 1, 2: 4, 3: 5, 8: 5},
+		},
+		{
+			name:      "almost everyone ordered once",
+			frequency: map[int]int{1: 95, 2: 4, 5: 1},
+			want:      map[int]int{1: 1, 2: 5, 5: 5},
+		},
+		{
+			name:      "everyone tied",
+			frequency: map[int]int{1: 40},
+			want:      map[int]int{1: 1},
+		},
+		{
+			name:      "no ties",
+			frequency: map[int]int{1: 1, 2: 1, 3: 1, 4: 1, 5: 1, 6: 1, 7: 1, 8: 1, 9: 1, 10: 1},
+			want:      map[int]int{1: 1, 2: 1, 3: 2, 4: 2, 5: 3, 6: 3, 7: 4, 8: 4, 9: 5, 10: 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var values []int
+			for orders, customers := range tt.frequency {
+				for range customers {
+					values = append(values, orders)
+				}
+			}
+
+			got := make(map[int]int)
+			for i, rank := range percentRank(values) {
+				s := score(rank)
+				if prev, ok := got[values[i]]; ok && prev != s {
+					t.Fatalf("customers with %d orders scored %d and %d", values[i], prev, s)
+				}
+				got[values[i]] = s
+			}
+			for orders, want := range tt.want {
+				if got[orders] != want {
+					t.Errorf("%d orders scored %d, want %d", orders, got[orders], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sales-analytics/internal/constants"
+	"sales-analytics/internal/models"
+	"sales-analytics/pkg/orm"
+)
+
+type uploadRepo struct{ store *orm.Store }
+
+func NewUploadRepo(store *orm.Store) UploadRepository {
+	return &uploadRepo{store: store}
+}
+
+func (r *uploadRepo) Create(
+	ctx context.Context,
+	u models.UploadSession,
+) error {
+	_, err := r.store.DB.ExecContext(ctx, `insert into upload_sessions
+		(id, file_name, total_size, received_bytes, sha256, mode, callback_url, status)
+		values (?, ?, ?, 0, nullif(?, ''), ?, nullif(?, ''), ?)`,
+		u.ID, u.FileName, u.TotalSize, u.SHA256, u.Mode, u.CallbackURL, constants.UploadOpen)
+	if err != nil {
+		return fmt.Errorf("failed to create upload session: %w", err)
+	}
+	return nil
+}
+
+func (r *uploadRepo) Get(
+	ctx context.Context,
+	id string,
+) (models.UploadSession, error) {
+	var u models.UploadSession
+	err := r.store.DB.QueryRowContext(ctx, `select id, file_name, total_size, received_bytes,
+		coalesce(sha256, ''), mode, coalesce(callback_url, ''), status, coalesce(job_id, ''),
+		created_at, updated_at from upload_sessions where id = ?`, id).
+		Scan(&u.ID, &u.FileName, &u.TotalSize, &u.Received, &u.SHA256, &u.Mode,
+			&u.CallbackURL, &u.Status, &u.JobID, &u.CreatedAt, &u.UpdatedAt)
+	return u, err
+}
+
+func (r *uploadRepo) SetReceived(
+	ctx context.Context,
+	id string,
+	received int64,
+) error {
+	_, err := r.store.DB.ExecContext(ctx, "update upload_sessions set received_bytes=? where id=?", received, id)
+	if err != nil {
+		return fmt.Errorf("failed to update upload offset: %w", err)
+	}
+	return nil
+}
+
+func (r *uploadRepo) SetFinalized(
+	ctx context.Context,
+	id, jobID string,
+) error {
+	_, err := r.store.DB.ExecContext(ctx, "update upload_sessions set status=?, job_id=? where id=?",
+		constants.UploadFinalized, jobID, id)
+	if err != nil {
+		return fmt.Errorf("failed to finalize upload session: %w", err)
+	}
+	return nil
+}
+
+func (r *uploadRepo) Delete(
+	ctx context.Context,
+	id string,
+) error {
+	_, err := r.store.DB.ExecContext(ctx, "delete from upload_sessions where id=?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete upload session: %w", err)
+	}
+	return nil
+}
+
+func (r *uploadRepo) Expired(
+	ctx context.Context,
+	before time.Time,
+) ([]string, error) {
+	rows, err := r.store.DB.QueryContext(ctx,
+		"select id from upload_sessions where status=? and updated_at < ?",
+		constants.UploadOpen, before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired upload sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan upload session: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
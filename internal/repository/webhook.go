@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"sales-analytics/internal/models"
+	"sales-analytics/pkg/orm"
+)
+
+type webhookRepo struct{ store *orm.Store }
+
+func NewWebhookRepo(store *orm.Store) WebhookRepository {
+	return &webhookRepo{store: store}
+}
+
+func (r *webhookRepo) RecordDelivery(
+	ctx context.Context,
+	d models.WebhookDelivery,
+) error {
+	_, err := r.store.DB.ExecContext(ctx, `insert into webhook_deliveries
+		(job_id, url, event, attempt, status_code, error_message, delivered, duration_ms)
+		values (?, ?, ?, ?, nullif(?, 0), nullif(?, ''), ?, ?)`,
+		d.JobID, d.URL, d.Event, d.Attempt, d.StatusCode, d.Error, d.Delivered, d.DurationMs)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook delivery: %w", err)
+	}
+	return nil
+}
+
+func (r *webhookRepo) ListDeliveries(
+	ctx context.Context,
+	jobID string,
+) ([]models.WebhookDelivery, error) {
+	rows, err := r.store.DB.QueryContext(ctx, `select id, job_id, url, event, attempt,
+		coalesce(status_code, 0), coalesce(error_message, ''), delivered, duration_ms, created_at
+		from webhook_deliveries where job_id = ? order by id`, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var result []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.JobID, &d.URL, &d.Event, &d.Attempt,
+			&d.StatusCode, &d.Error, &d.Delivered, &d.DurationMs, &d.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery row: %w", err)
+		}
+		result = append(result, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook delivery rows: %w", err)
+	}
+
+	return result, nil
+}
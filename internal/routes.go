@@ -11,16 +11,63 @@ func RegisterRoutes(
 	ing handler.Ingestion,
 	st handler.Status,
 	an handler.Analytics,
+	wh handler.Webhook,
+	up handler.Uploads,
+	fx handler.FX,
+	id handler.Identity,
+	pv handler.Privacy,
+	ex handler.Export,
 ) {
 	v1 := r.Group("/api/v1")
 	{
 		// Ingestion endpoints
 		v1.POST("/ingestion/upload", ing.Upload)
+		v1.POST("/ingestion/upload/stream", ing.UploadStream)
 		v1.GET("/ingestion/status/:id", st.Get)
 		v1.POST("/ingestion/refresh", ing.Refresh)
+		v1.POST("/ingestion/s3", ing.ImportS3)
+		v1.GET("/ingestion/jobs/:id/events", ing.Events)
+		v1.GET("/ingestion/jobs/:id/webhooks", wh.Deliveries)
+		v1.POST("/ingestion/jobs/:id/rollback", ing.Rollback)
+
+		// Resumable chunked uploads
+		v1.POST("/ingestion/uploads", up.Create)
+		v1.HEAD("/ingestion/uploads/:id", up.Get)
+		v1.GET("/ingestion/uploads/:id", up.Get)
+		v1.PUT("/ingestion/uploads/:id", up.Put)
+		v1.POST("/ingestion/uploads/:id/complete", up.Complete)
+		v1.DELETE("/ingestion/uploads/:id", up.Abort)
+
+		// Exchange rates
+		v1.POST("/fx/rates", fx.LoadRates)
+
+		// Customer identity resolution
+		v1.POST("/identity/resolve", id.Resolve)
+		v1.GET("/identity/candidates", id.Candidates)
+		v1.POST("/identity/candidates/:id/approve", id.Approve)
+		v1.POST("/identity/candidates/:id/reject", id.Reject)
+		v1.GET("/identity/persons/:id", id.Person)
+
+		// Personal data
+		v1.POST("/privacy/keys/rotate", pv.RotateKeys)
+		v1.DELETE("/customers/:id", pv.Erase)
+
+		// Sales export
+		v1.GET("/sales/export", ex.Sales)
 
 		// Analytics endpoints
 		v1.GET("/analytics/revenue", an.Revenue)
+		v1.GET("/analytics/kpis", an.KPIs)
+		v1.POST("/analytics/query", an.Query)
+		v1.GET("/analytics/cohorts", an.Cohorts)
+		v1.GET("/analytics/rfm", an.RFM)
+		v1.GET("/analytics/rfm/customers", an.RFMCustomers)
+		v1.GET("/analytics/clv", an.CLV)
+		v1.GET("/analytics/clv/regions", an.CLVByRegion)
+		v1.GET("/analytics/basket", an.Basket)
+		v1.GET("/analytics/basket/products/:id", an.BasketProduct)
+		v1.GET("/analytics/abc", an.ABC)
+		v1.GET("/analytics/forecast", an.Forecast)
 	}
 	r.GET("/swagger", handler.Swagger)
 }
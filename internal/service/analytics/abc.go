@@ -0,0 +1,118 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"sales-analytics/internal/models"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidEntity     = errors.New("invalid entity, expected products or customers")
+	ErrInvalidThresholds = errors.New("invalid thresholds, expected 0 < a < b <= 1")
+)
+
+// ABC ranks products or customers by gross revenue and classes them A until
+// their cumulative share reaches a, B until it reaches b and C after. The
+// item crossing a threshold belongs to the class below it, so A is never
+// empty while there is revenue.
+func (s *service) ABC(
+	ctx context.Context,
+	f models.Filter,
+	entity string,
+	a, b float64,
+) (models.ABCResult, error) {
+	result := models.ABCResult{Entity: entity, A: a, B: b}
+	if !(a > 0 && a < b && b <= 1) {
+		return result, ErrInvalidThresholds
+	}
+
+	var items []models.ABCItem
+	switch entity {
+	case models.ABCProducts:
+		products, err := s.ByProduct(ctx, f)
+		if err != nil {
+			return result, err
+		}
+		for _, p := range products {
+			items = append(items, models.ABCItem{ID: p.ProductID, Name: p.ProductName, Revenue: p.Revenue})
+		}
+	case models.ABCCustomers:
+		factor, err := s.factor(ctx, f)
+		if err != nil {
+			return result, err
+		}
+		customers, err := s.repo.GetRevenueByCustomer(ctx, f)
+		if err != nil {
+			return result, fmt.Errorf("failed to calculate revenue by customer: %w", err)
+		}
+		for _, c := range customers {
+			items = append(items, models.ABCItem{ID: c.CustomerID, Name: c.CustomerName, Revenue: c.Revenue * factor})
+		}
+	default:
+		return result, ErrInvalidEntity
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Revenue != items[j].Revenue {
+			return items[i].Revenue > items[j].Revenue
+		}
+		return items[i].ID < items[j].ID
+	})
+	for _, it := range items {
+		if it.Revenue > 0 {
+			result.Revenue += it.Revenue
+		}
+	}
+
+	classes := map[string]*models.ABCClass{"A": {Class: "A"}, "B": {Class: "B"}, "C": {Class: "C"}}
+	cumulative := 0.0
+	for i := range items {
+		it := &items[i]
+		it.Rank = i + 1
+
+		it.Class = "C"
+		if it.Revenue > 0 && result.Revenue > 0 {
+			it.Share = it.Revenue / result.Revenue
+			switch {
+			case cumulative < a:
+				it.Class = "A"
+			case cumulative < b:
+				it.Class = "B"
+			}
+			cumulative += it.Share
+		}
+		it.CumulativeShare = cumulative
+
+		cl := classes[it.Class]
+		cl.Items++
+		cl.Revenue += it.Revenue
+	}
+
+	for _, name := range []string{"A", "B", "C"} {
+		cl := classes[name]
+		if len(items) > 0 {
+			cl.ItemShare = float64(cl.Items) / float64(len(items))
+		}
+		if result.Revenue > 0 {
+			cl.RevenueShare = cl.Revenue / result.Revenue
+		}
+		result.Classes = append(result.Classes, *cl)
+	}
+	result.Items = items
+	if result.Items == nil {
+		result.Items = []models.ABCItem{}
+	}
+
+	s.log.Debug("ABC analysis completed",
+		zap.String("entity", entity),
+		zap.String("start_date", f.Start),
+		zap.String("end_date", f.End),
+		zap.Int("items", len(items)))
+
+	return result, nil
+}
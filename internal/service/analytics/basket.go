@@ -0,0 +1,83 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"sales-analytics/internal/models"
+
+	"go.uber.org/zap"
+)
+
+var ErrInvalidThreshold = errors.New("invalid threshold, support is above 0 and at most 1, confidence between 0 and 1, lift not negative")
+
+func (s *service) Basket(
+	ctx context.Context,
+	f models.Filter,
+	opts models.BasketOptions,
+) (models.BasketResult, error) {
+	var result models.BasketResult
+	// written so NaN fails too; support bounds the pairs returned
+	if !(opts.MinSupport > 0 && opts.MinSupport <= 1) || !(opts.MinConfidence >= 0 && opts.MinConfidence <= 1) ||
+		!(opts.MinLift >= 0) {
+		return result, ErrInvalidThreshold
+	}
+
+	counts, orders, err := s.repo.GetProductPairs(ctx, f, opts.ProductID, opts.MinSupport)
+	if err != nil {
+		return result, fmt.Errorf("failed to analyze baskets: %w", err)
+	}
+	result.Orders = orders
+
+	result.Pairs = []models.ProductPair{}
+	for _, c := range counts {
+		p := models.ProductPair{
+			ProductA:     c.ProductA,
+			NameA:        c.NameA,
+			ProductB:     c.ProductB,
+			NameB:        c.NameB,
+			Orders:       c.Together,
+			Support:      float64(c.Together) / float64(orders),
+			ConfidenceAB: float64(c.Together) / float64(c.OrdersA),
+			ConfidenceBA: float64(c.Together) / float64(c.OrdersB),
+			Lift:         float64(c.Together) * float64(orders) / (float64(c.OrdersA) * float64(c.OrdersB)),
+		}
+
+		// a looked up product is always A, otherwise either direction of
+		// the pair may reach the confidence
+		confidence := p.ConfidenceAB
+		if opts.ProductID == "" {
+			confidence = math.Max(p.ConfidenceAB, p.ConfidenceBA)
+		}
+		if confidence < opts.MinConfidence || p.Lift < opts.MinLift {
+			continue
+		}
+		result.Pairs = append(result.Pairs, p)
+	}
+
+	sort.Slice(result.Pairs, func(i, j int) bool {
+		a, b := result.Pairs[i], result.Pairs[j]
+		if a.Lift != b.Lift {
+			return a.Lift > b.Lift
+		}
+		if a.Orders != b.Orders {
+			return a.Orders > b.Orders
+		}
+		return a.ProductA+"\x00"+a.ProductB < b.ProductA+"\x00"+b.ProductB
+	})
+	if opts.Limit > 0 && len(result.Pairs) > opts.Limit {
+		result.Pairs = result.Pairs[:opts.Limit]
+	}
+
+	s.log.Debug("Basket analysis completed",
+		zap.String("start_date", f.Start),
+		zap.String("end_date", f.End),
+		zap.String("product_id", opts.ProductID),
+		zap.Int("orders", orders),
+		zap.Int("pairs", len(result.Pairs)))
+
+	return result, nil
+}
@@ -0,0 +1,195 @@
+package analytics
+
+import (
+	"context"
+	"math"
+	"sort"
+)
+
+// bgnbd is a fitted BG/NBD model (Fader, Hardie and Lee, 2005): while alive
+// a customer purchases at a gamma(r, alpha) distributed rate and after each
+// purchase drops out with a beta(a, b) distributed probability
+type bgnbd struct {
+	r, alpha, a, b float64
+}
+
+// rfmT is a customer in BG/NBD terms: x repeat purchases, the last at tx,
+// observed for T, times in weeks since the first purchase
+type rfmT struct {
+	x, tx, T float64
+}
+
+// logLikelihood of one customer
+func (m bgnbd) logLikelihood(c rfmT) float64 {
+	lg := func(v float64) float64 {
+		l, _ := math.Lgamma(v)
+		return l
+	}
+
+	a1 := lg(m.r+c.x) - lg(m.r) + m.r*math.Log(m.alpha)
+	a2 := lg(m.a+m.b) + lg(m.b+c.x) - lg(m.b) - lg(m.a+m.b+c.x)
+	a3 := -(m.r + c.x) * math.Log(m.alpha+c.T)
+	if c.x == 0 {
+		return a1 + a2 + a3
+	}
+	a4 := math.Log(m.a) - math.Log(m.b+c.x-1) - (m.r+c.x)*math.Log(m.alpha+c.tx)
+	hi := math.Max(a3, a4)
+	return a1 + a2 + hi + math.Log(math.Exp(a3-hi)+math.Exp(a4-hi))
+}
+
+// expected returns the expected purchases in the next t weeks; false when
+// the parameters are outside the domain of the formula
+func (m bgnbd) expected(c rfmT, t float64) (float64, bool) {
+	z := t / (m.alpha + c.T + t)
+	hyp, ok := hyp2f1(m.r+c.x, m.b+c.x, m.a+m.b+c.x-1, z)
+	if !ok {
+		return 0, false
+	}
+	num := (m.a + m.b + c.x - 1) / (m.a - 1) *
+		(1 - math.Pow((m.alpha+c.T)/(m.alpha+c.T+t), m.r+c.x)*hyp)
+	den := 1.0
+	if c.x > 0 {
+		den += m.a / (m.b + c.x - 1) * math.Pow((m.alpha+c.T)/(m.alpha+c.tx), m.r+c.x)
+	}
+	if e := num / den; e > 0 && !math.IsInf(e, 0) && !math.IsNaN(e) {
+		return e, true
+	}
+	return 0, true
+}
+
+// probAlive returns the probability the customer has not dropped out
+func (m bgnbd) probAlive(c rfmT) float64 {
+	if c.x == 0 {
+		return 1
+	}
+	return 1 / (1 + m.a/(m.b+c.x-1)*math.Pow((m.alpha+c.T)/(m.alpha+c.tx), m.r+c.x))
+}
+
+// hyp2f1 is the Gaussian hypergeometric function for c > 0 and
+// 0 <= z < 1; false outside of it, where the series divides by zero or
+// diverges
+func hyp2f1(a, b, c, z float64) (float64, bool) {
+	if c <= 0 || z < 0 || z >= 1 {
+		return 0, false
+	}
+	term, sum := 1.0, 1.0
+	for k := 0.0; k < 10000; k++ {
+		term *= (a + k) * (b + k) / ((c + k) * (k + 1)) * z
+		sum += term
+		if math.Abs(term) < 1e-12*math.Abs(sum) {
+			break
+		}
+	}
+	return sum, !math.IsInf(sum, 0) && !math.IsNaN(sum)
+}
+
+// fitBGNBD estimates the parameters by maximum likelihood, searching over
+// their logarithms so they stay positive
+func fitBGNBD(ctx context.Context, customers []rfmT) (bgnbd, error) {
+	toModel := func(p []float64) bgnbd {
+		return bgnbd{r: math.Exp(p[0]), alpha: math.Exp(p[1]), a: math.Exp(p[2]), b: math.Exp(p[3])}
+	}
+	cost := func(p []float64) float64 {
+		m := toModel(p)
+		ll := 0.0
+		for _, c := range customers {
+			ll += m.logLikelihood(c)
+		}
+		if math.IsNaN(ll) {
+			return math.Inf(1)
+		}
+		return -ll
+	}
+
+	// start from a rate of one purchase per mean customer age
+	meanT := 1.0
+	if len(customers) > 0 {
+		sum := 0.0
+		for _, c := range customers {
+			sum += c.T
+		}
+		meanT = math.Max(sum/float64(len(customers)), 1)
+	}
+	p, err := nelderMead(ctx, cost, []float64{0, math.Log(meanT), 0, 0}, 2000)
+	if err != nil {
+		return bgnbd{}, err
+	}
+	return toModel(p), nil
+}
+
+// nelderMead minimizes f from start with the downhill simplex method,
+// giving up when ctx is done
+func nelderMead(
+	ctx context.Context,
+	f func([]float64) float64,
+	start []float64,
+	maxIter int,
+) ([]float64, error) {
+	n := len(start)
+	type vertex struct {
+		p []float64
+		v float64
+	}
+
+	simplex := make([]vertex, n+1)
+	simplex[0] = vertex{p: start, v: f(start)}
+	for i := 0; i < n; i++ {
+		p := append([]float64(nil), start...)
+		p[i] += 0.5
+		simplex[i+1] = vertex{p: p, v: f(p)}
+	}
+
+	point := func(from, to []float64, t float64) []float64 {
+		p := make([]float64, n)
+		for i := range p {
+			p[i] = from[i] + t*(to[i]-from[i])
+		}
+		return p
+	}
+
+	for iter := 0; iter < maxIter; iter++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		sort.Slice(simplex, func(i, j int) bool { return simplex[i].v < simplex[j].v })
+		best, worst := simplex[0], simplex[n]
+		if math.Abs(worst.v-best.v) <= 1e-9*(math.Abs(best.v)+1e-9) {
+			break
+		}
+
+		centroid := make([]float64, n)
+		for _, s := range simplex[:n] {
+			for i := range centroid {
+				centroid[i] += s.p[i] / float64(n)
+			}
+		}
+
+		reflected := point(centroid, worst.p, -1)
+		rv := f(reflected)
+		switch {
+		case rv < best.v:
+			expanded := point(centroid, worst.p, -2)
+			if ev := f(expanded); ev < rv {
+				simplex[n] = vertex{expanded, ev}
+			} else {
+				simplex[n] = vertex{reflected, rv}
+			}
+		case rv < simplex[n-1].v:
+			simplex[n] = vertex{reflected, rv}
+		default:
+			contracted := point(centroid, worst.p, 0.5)
+			if cv := f(contracted); cv < worst.v {
+				simplex[n] = vertex{contracted, cv}
+				continue
+			}
+			// shrink towards the best vertex
+			for i := 1; i <= n; i++ {
+				p := point(best.p, simplex[i].p, 0.5)
+				simplex[i] = vertex{p, f(p)}
+			}
+		}
+	}
+
+	sort.Slice(simplex, func(i, j int) bool { return simplex[i].v < simplex[j].v })
+	return simplex[0].p, nil
+}
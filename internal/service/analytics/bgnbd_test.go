@@ -0,0 +1,60 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestHyp2f1(t *testing.T) {
+	// 2F1(1, 1; 2; z) = -ln(1-z) / z
+	for _, z := range []float64{0, 0.3, 0.9} {
+		want := 1.0
+		if z > 0 {
+			want = -math.Log(1-z) / z
+		}
+		got, ok := hyp2f1(1, 1, 2, z)
+		if !ok || math.Abs(got-want) > 1e-9 {
+			t.Errorf("hyp2f1(1, 1, 2, %v) = %v, %v, want %v", z, got, ok, want)
+		}
+	}
+
+	for _, c := range []float64{0, -1, -0.5} {
+		if _, ok := hyp2f1(1, 1, c, 0.5); ok {
+			t.Errorf("hyp2f1 with c = %v succeeded", c)
+		}
+	}
+}
+
+func TestExpectedOutsideModel(t *testing.T) {
+	// a + b <= 1 puts c = a+b+x-1 at or below zero for customers without
+	// repeat purchases
+	m := bgnbd{r: 1, alpha: 1, a: 0.4, b: 0.5}
+	if _, ok := m.expected(rfmT{x: 0, T: 10}, 52); ok {
+		t.Error("expected succeeded outside the model")
+	}
+	if _, ok := m.expected(rfmT{x: 2, tx: 5, T: 10}, 52); !ok {
+		t.Error("expected failed with c > 0")
+	}
+}
+
+func TestNelderMeadCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	f := func(p []float64) float64 {
+		if calls++; calls == 10 {
+			cancel()
+		}
+		return p[0]*p[0] + p[1]*p[1]
+	}
+
+	if _, err := nelderMead(ctx, f, []float64{3, -2}, 1000); !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context.Canceled", err)
+	}
+
+	p, err := nelderMead(context.Background(), f, []float64{3, -2}, 1000)
+	if err != nil || math.Abs(p[0]) > 1e-3 || math.Abs(p[1]) > 1e-3 {
+		t.Errorf("minimum = %v, %v, want near 0, 0", p, err)
+	}
+}
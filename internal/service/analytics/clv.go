@@ -0,0 +1,250 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"sales-analytics/internal/models"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// maxFitCustomers caps the customers the BG/NBD model is fitted on,
+	// larger bases are sampled evenly
+	maxFitCustomers = 10000
+	// maxCachedFits bounds the fitted models kept, the cache starts over
+	// when full
+	maxCachedFits = 64
+)
+
+// fitKey identifies the data a BG/NBD model was fitted on; any order, return
+// or merge changing the customers as of the date changes one of the sums
+type fitKey struct {
+	asOf      string
+	customers int
+	x, tx, T  float64
+}
+
+var ErrInvalidCLVModel = errors.New("invalid clv model, expected bgnbd or simple")
+
+// clvModel returns the named model, the configured one when empty, with
+// defaults filled in
+func (s *service) clvModel(name string) models.CLVModel {
+	m := models.CLVModel{
+		Model:  name,
+		Margin: s.clv.Margin,
+	}
+	if m.Model == "" {
+		m.Model = models.CLVModelBGNBD
+	}
+	if m.Margin <= 0 {
+		m.Margin = 1
+	}
+	switch m.Model {
+	case models.CLVModelBGNBD:
+		m.HorizonMonths = s.clv.HorizonMonths
+		if m.HorizonMonths <= 0 {
+			m.HorizonMonths = 12
+		}
+	case models.CLVModelSimple:
+		m.LifetimeYears = s.clv.LifetimeYears
+		if m.LifetimeYears <= 0 {
+			m.LifetimeYears = 3
+		}
+	}
+	return m
+}
+
+// estimate predicts the value of every customer that ordered on or before
+// f.End
+func (s *service) estimate(
+	ctx context.Context,
+	f models.Filter,
+) ([]models.CLVEstimate, models.CLVModel, error) {
+	model := s.clvModel(s.clv.Model)
+	if model.Model != models.CLVModelBGNBD && model.Model != models.CLVModelSimple {
+		return nil, model, ErrInvalidCLVModel
+	}
+
+	asOf, err := time.Parse("2006-01-02", f.End)
+	if err != nil {
+		return nil, model, fmt.Errorf("invalid as_of date: %w", err)
+	}
+
+	factor, err := s.factor(ctx, f)
+	if err != nil {
+		return nil, model, err
+	}
+
+	summaries, err := s.repo.GetCustomerSummaries(ctx, f.End)
+	if err != nil {
+		return nil, model, fmt.Errorf("failed to load customer summaries: %w", err)
+	}
+	model.Customers = len(summaries)
+
+	weeks := func(from, to time.Time) float64 { return to.Sub(from).Hours() / (24 * 7) }
+	histories := make([]rfmT, len(summaries))
+	for i, c := range summaries {
+		histories[i] = rfmT{
+			x:  float64(c.Purchases - 1),
+			tx: weeks(c.First, c.Last),
+			T:  weeks(c.First, asOf),
+		}
+	}
+
+	horizon := float64(model.HorizonMonths) * 52 / 12
+	expected := make([]float64, len(summaries))
+	var alive []float64
+	if model.Model == models.CLVModelBGNBD {
+		fitted, err := s.fitBGNBD(ctx, f.End, histories)
+		if err != nil {
+			return nil, model, fmt.Errorf("failed to fit clv model: %w", err)
+		}
+		model.Params = map[string]float64{"r": fitted.r, "alpha": fitted.alpha, "a": fitted.a, "b": fitted.b}
+
+		alive = make([]float64, len(summaries))
+		for i, h := range histories {
+			e, ok := fitted.expected(h, horizon)
+			if !ok {
+				s.log.Warn("BG/NBD parameters outside the model, using the simple model",
+					zap.String("as_of", f.End),
+					zap.Any("params", model.Params))
+				model = s.clvModel(models.CLVModelSimple)
+				model.Customers = len(summaries)
+				alive = nil
+				break
+			}
+			expected[i], alive[i] = e, fitted.probAlive(h)
+		}
+	}
+	if model.Model == models.CLVModelSimple {
+		for i, h := range histories {
+			// the purchase rate so far, customers younger than a month
+			// counted as a month old
+			years := math.Max(h.T/52, 1.0/12)
+			expected[i] = float64(summaries[i].Purchases) / years * model.LifetimeYears
+		}
+	}
+
+	estimates := make([]models.CLVEstimate, len(summaries))
+	for i, c := range summaries {
+		e := models.CLVEstimate{
+			CustomerID:        c.CustomerID,
+			CustomerName:      c.CustomerName,
+			Region:            c.Region,
+			Purchases:         c.Purchases,
+			AvgValue:          c.Monetary / float64(c.Purchases) * factor,
+			ExpectedPurchases: expected[i],
+		}
+		if alive != nil {
+			e.ProbAlive = &alive[i]
+		}
+		e.CLV = e.ExpectedPurchases * e.AvgValue * model.Margin
+		estimates[i] = e
+	}
+
+	s.log.Debug("CLV estimated",
+		zap.String("as_of", f.End),
+		zap.String("model", model.Model),
+		zap.Any("params", model.Params),
+		zap.Int("customers", len(estimates)))
+
+	return estimates, model, nil
+}
+
+// fitBGNBD fits the model on an even sample of the histories as of asOf,
+// reusing the fit while the data is unchanged
+func (s *service) fitBGNBD(
+	ctx context.Context,
+	asOf string,
+	histories []rfmT,
+) (bgnbd, error) {
+	key := fitKey{asOf: asOf, customers: len(histories)}
+	for _, h := range histories {
+		key.x += h.x
+		key.tx += h.tx
+		key.T += h.T
+	}
+
+	s.fitMu.Lock()
+	fitted, ok := s.fits[key]
+	s.fitMu.Unlock()
+	if ok {
+		return fitted, nil
+	}
+
+	step := (len(histories) + maxFitCustomers - 1) / maxFitCustomers
+	sample := make([]rfmT, 0, maxFitCustomers)
+	for i := 0; i < len(histories); i += max(step, 1) {
+		sample = append(sample, histories[i])
+	}
+	fitted, err := fitBGNBD(ctx, sample)
+	if err != nil {
+		return fitted, err
+	}
+
+	s.fitMu.Lock()
+	if s.fits == nil || len(s.fits) >= maxCachedFits {
+		s.fits = make(map[fitKey]bgnbd)
+	}
+	s.fits[key] = fitted
+	s.fitMu.Unlock()
+	return fitted, nil
+}
+
+func (s *service) TopCLV(
+	ctx context.Context,
+	f models.Filter,
+	limit int,
+) (models.CLVModel, []models.CLVEstimate, error) {
+	estimates, model, err := s.estimate(ctx, f)
+	if err != nil {
+		return model, nil, err
+	}
+
+	sort.Slice(estimates, func(i, j int) bool {
+		if estimates[i].CLV != estimates[j].CLV {
+			return estimates[i].CLV > estimates[j].CLV
+		}
+		return estimates[i].CustomerID < estimates[j].CustomerID
+	})
+	if len(estimates) > limit {
+		estimates = estimates[:limit]
+	}
+	return model, estimates, nil
+}
+
+func (s *service) CLVByRegion(
+	ctx context.Context,
+	f models.Filter,
+) (models.CLVModel, []models.RegionCLV, error) {
+	estimates, model, err := s.estimate(ctx, f)
+	if err != nil {
+		return model, nil, err
+	}
+
+	byRegion := make(map[string]*models.RegionCLV)
+	for _, e := range estimates {
+		r, ok := byRegion[e.Region]
+		if !ok {
+			r = &models.RegionCLV{Region: e.Region}
+			byRegion[e.Region] = r
+		}
+		r.Customers++
+		r.TotalCLV += e.CLV
+	}
+
+	regions := make([]models.RegionCLV, 0, len(byRegion))
+	for _, r := range byRegion {
+		r.AvgCLV = r.TotalCLV / float64(r.Customers)
+		regions = append(regions, *r)
+	}
+	sort.Slice(regions, func(i, j int) bool { return regions[i].AvgCLV > regions[j].AvgCLV })
+
+	return model, regions, nil
+}
@@ -0,0 +1,109 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"sales-analytics/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// maxCohortPeriods bounds the periods of a request, the triangle grows with
+// their square
+const maxCohortPeriods = 60
+
+var (
+	ErrInvalidGranularity = errors.New("invalid granularity, expected monthly or quarterly")
+	ErrTooManyPeriods     = fmt.Errorf("too many cohort periods, at most %d", maxCohortPeriods)
+)
+
+// periodIndex numbers the month or quarter of t like the repository does
+func periodIndex(t time.Time, granularity string) int {
+	if granularity == models.CohortQuarterly {
+		return t.Year()*4 + (int(t.Month())-1)/3
+	}
+	return t.Year()*12 + int(t.Month()) - 1
+}
+
+func periodLabel(index int, granularity string) string {
+	if granularity == models.CohortQuarterly {
+		return fmt.Sprintf("%d-Q%d", index/4, index%4+1)
+	}
+	return fmt.Sprintf("%d-%02d", index/12, index%12+1)
+}
+
+func (s *service) Cohorts(
+	ctx context.Context,
+	f models.Filter,
+	granularity string,
+) ([]models.Cohort, error) {
+	if granularity != models.CohortMonthly && granularity != models.CohortQuarterly {
+		return nil, ErrInvalidGranularity
+	}
+
+	start, err := time.Parse("2006-01-02", f.Start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start date: %w", err)
+	}
+	end, err := time.Parse("2006-01-02", f.End)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end date: %w", err)
+	}
+	first, last := periodIndex(start, granularity), periodIndex(end, granularity)
+	if last-first+1 > maxCohortPeriods {
+		return nil, ErrTooManyPeriods
+	}
+
+	factor, err := s.factor(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	activity, err := s.repo.GetCohortActivity(ctx, granularity, first, last)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate cohorts: %w", err)
+	}
+
+	// a row per cohort, each with a cell for every period up to last, so the
+	// result is a triangle
+	var cohorts []models.Cohort
+	for idx := first; idx <= last; idx++ {
+		c := models.Cohort{Cohort: periodLabel(idx, granularity)}
+		for off := 0; idx+off <= last; off++ {
+			c.Periods = append(c.Periods, models.CohortPeriod{
+				Offset: off,
+				Period: periodLabel(idx+off, granularity),
+			})
+		}
+		cohorts = append(cohorts, c)
+	}
+	for _, a := range activity {
+		i := a.Cohort - first
+		if i < 0 || i >= len(cohorts) || a.Offset >= len(cohorts[i].Periods) {
+			continue
+		}
+		cohorts[i].Periods[a.Offset].Active = a.Active
+		cohorts[i].Periods[a.Offset].Revenue = a.Revenue * factor
+	}
+	for i := range cohorts {
+		c := &cohorts[i]
+		c.Size = c.Periods[0].Active
+		if c.Size == 0 {
+			continue
+		}
+		for j := range c.Periods {
+			c.Periods[j].Retention = float64(c.Periods[j].Active) / float64(c.Size)
+		}
+	}
+
+	s.log.Debug("Cohorts calculated",
+		zap.String("start_date", f.Start),
+		zap.String("end_date", f.End),
+		zap.String("granularity", granularity),
+		zap.Int("cohorts", len(cohorts)))
+
+	return cohorts, nil
+}
@@ -0,0 +1,163 @@
+package analytics
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"sales-analytics/internal/models"
+)
+
+var ErrInvalidCompare = errors.New("invalid compare, expected previous, yoy or custom with compare_start and compare_end")
+
+// ComparisonPeriod returns f moved to the period it is compared with.
+// previous is the period of the same length right before f, counted in
+// whole months when f spans whole months; yoy is the same dates a year
+// earlier, 29 February becoming the 28th. Amounts of the returned period
+// convert at the rate of f, so a change never comes from the exchange rate.
+func ComparisonPeriod(
+	f models.Filter,
+	mode, start, end string,
+) (models.Filter, error) {
+	s, err := time.Parse("2006-01-02", f.Start)
+	if err != nil {
+		return f, fmt.Errorf("invalid start date: %w", err)
+	}
+	e, err := time.Parse("2006-01-02", f.End)
+	if err != nil {
+		return f, fmt.Errorf("invalid end date: %w", err)
+	}
+
+	var ps, pe time.Time
+	switch mode {
+	case models.ComparePrevious:
+		if s.Day() == 1 && e.AddDate(0, 0, 1).Day() == 1 {
+			months := (e.Year()-s.Year())*12 + int(e.Month()-s.Month()) + 1
+			ps, pe = s.AddDate(0, -months, 0), s.AddDate(0, 0, -1)
+		} else {
+			days := int(e.Sub(s).Hours() / 24)
+			pe = s.AddDate(0, 0, -1)
+			ps = pe.AddDate(0, 0, -days)
+		}
+	case models.CompareYoY:
+		ps, pe = lastYear(s), lastYear(e)
+	case models.CompareCustom:
+		if ps, err = time.Parse("2006-01-02", start); err != nil {
+			return f, ErrInvalidCompare
+		}
+		if pe, err = time.Parse("2006-01-02", end); err != nil || pe.Before(ps) {
+			return f, ErrInvalidCompare
+		}
+	default:
+		return f, ErrInvalidCompare
+	}
+
+	if f.RateOn == "" {
+		f.RateOn = f.End
+	}
+	f.Start, f.End = ps.Format("2006-01-02"), pe.Format("2006-01-02")
+	return f, nil
+}
+
+func lastYear(t time.Time) time.Time {
+	prev := time.Date(t.Year()-1, t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if prev.Month() != t.Month() {
+		// 29 February
+		prev = prev.AddDate(0, 0, -prev.Day())
+	}
+	return prev
+}
+
+// CompareProducts sets the change of every product and returns them
+// followed by the products sold only in the comparison period, with no
+// revenue; products without sales in the comparison period compare with zero
+func CompareProducts(cur, prev []models.ProductRevenue) []models.ProductRevenue {
+	byID := make(map[string]models.ProductRevenue, len(prev))
+	for _, p := range prev {
+		byID[p.ProductID] = p
+	}
+	for i, c := range cur {
+		p := byID[c.ProductID]
+		cur[i].Change = models.NewRevenueChange(c.Revenue, c.Net, p.Revenue, p.Net)
+		delete(byID, c.ProductID)
+	}
+	for _, p := range prev {
+		if _, ok := byID[p.ProductID]; ok {
+			cur = append(cur, models.ProductRevenue{
+				ProductID:   p.ProductID,
+				ProductName: p.ProductName,
+				Change:      models.NewRevenueChange(0, 0, p.Revenue, p.Net),
+			})
+		}
+	}
+	return cur
+}
+
+// CompareCategories is CompareProducts for categories
+func CompareCategories(cur, prev []models.CategoryRevenue) []models.CategoryRevenue {
+	byName := make(map[string]models.CategoryRevenue, len(prev))
+	for _, p := range prev {
+		byName[p.Category] = p
+	}
+	for i, c := range cur {
+		p := byName[c.Category]
+		cur[i].Change = models.NewRevenueChange(c.Revenue, c.Net, p.Revenue, p.Net)
+		delete(byName, c.Category)
+	}
+	for _, p := range prev {
+		if _, ok := byName[p.Category]; ok {
+			cur = append(cur, models.CategoryRevenue{
+				Category: p.Category,
+				Change:   models.NewRevenueChange(0, 0, p.Revenue, p.Net),
+			})
+		}
+	}
+	return cur
+}
+
+// CompareRegions is CompareProducts for regions
+func CompareRegions(cur, prev []models.RegionRevenue) []models.RegionRevenue {
+	byName := make(map[string]models.RegionRevenue, len(prev))
+	for _, p := range prev {
+		byName[p.Region] = p
+	}
+	for i, c := range cur {
+		p := byName[c.Region]
+		cur[i].Change = models.NewRevenueChange(c.Revenue, c.Net, p.Revenue, p.Net)
+		delete(byName, c.Region)
+	}
+	for _, p := range prev {
+		if _, ok := byName[p.Region]; ok {
+			cur = append(cur, models.RegionRevenue{
+				Region: p.Region,
+				Change: models.NewRevenueChange(0, 0, p.Revenue, p.Net),
+			})
+		}
+	}
+	return cur
+}
+
+// CompareTopProducts is CompareProducts for top products, also comparing
+// the quantity sold; prev must hold every product of the comparison period,
+// not only its top ones. Products that dropped out are not added, the list
+// stays the top of the current period.
+func CompareTopProducts(cur, prev []models.TopProduct) {
+	byID := make(map[string]models.TopProduct, len(prev))
+	for _, p := range prev {
+		byID[p.ProductID] = p
+	}
+	for i, c := range cur {
+		p := byID[c.ProductID]
+		cur[i].Change = models.NewRevenueChange(c.Revenue, c.Net, p.Revenue, p.Net)
+		cur[i].Change.Quantity = models.NewChange(float64(c.QuantitySold), float64(p.QuantitySold))
+	}
+}
+
+// CompareTotals returns the change of the gross, returned and net revenue
+func CompareTotals(cur, prev models.RevenueTotals) map[string]*models.Change {
+	return map[string]*models.Change{
+		"gross":   models.NewChange(cur.Gross, prev.Gross),
+		"returns": models.NewChange(cur.Returns, prev.Returns),
+		"net":     models.NewChange(cur.Net, prev.Net),
+	}
+}
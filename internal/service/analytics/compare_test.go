@@ -0,0 +1,121 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"sales-analytics/internal/models"
+	"sales-analytics/internal/service/fx"
+)
+
+func TestCompareProductsKeepsDecliners(t *testing.T) {
+	cur := []models.ProductRevenue{
+		{ProductID: "P1", ProductName: "Laptop", Revenue: 300, Net: 250},
+		{ProductID: "P3", ProductName: "Mouse", Revenue: 50, Net: 50},
+	}
+	prev := []models.ProductRevenue{
+		{ProductID: "P2", ProductName: "Monitor", Revenue: 400, Net: 380},
+		{ProductID: "P1", ProductName: "Laptop", Revenue: 200, Net: 200},
+	}
+
+	got := CompareProducts(cur, prev)
+	if len(got) != 3 {
+		t.Fatalf("rows = %+v, want 3", got)
+	}
+
+	tests := []struct {
+		id                string
+		revenue, previous float64
+		delta             float64
+		percent           *float64
+	}{
+		{id: "P1", revenue: 300, previous: 200, delta: 100, percent: ptr(50)},
+		{id: "P3", revenue: 50, previous: 0, delta: 50},
+		{id: "P2", revenue: 0, previous: 400, delta: -400, percent: ptr(-100)},
+	}
+	for i, tt := range tests {
+		r := got[i]
+		if r.ProductID != tt.id || r.Revenue != tt.revenue {
+			t.Fatalf("row %d = %s with %v, want %s with %v", i, r.ProductID, r.Revenue, tt.id, tt.revenue)
+		}
+		c := r.Change.Revenue
+		if c.Previous != tt.previous || c.Delta != tt.delta || !equalPercent(c.Percent, tt.percent) {
+			t.Errorf("%s change = %+v, want previous %v delta %v", tt.id, c, tt.previous, tt.delta)
+		}
+	}
+	if got[2].ProductName != "Monitor" || got[2].Change.Net.Delta != -380 {
+		t.Errorf("dropped product = %+v, net %+v", got[2], got[2].Change.Net)
+	}
+}
+
+func TestCompareCategoriesAndRegionsKeepDecliners(t *testing.T) {
+	categories := CompareCategories(
+		[]models.CategoryRevenue{{Category: "Electronics", Revenue: 10, Net: 10}},
+		[]models.CategoryRevenue{{Category: "Books", Revenue: 5, Net: 4}},
+	)
+	if len(categories) != 2 || categories[1].Category != "Books" || categories[1].Change.Revenue.Delta != -5 {
+		t.Errorf("categories = %+v", categories)
+	}
+
+	regions := CompareRegions(
+		[]models.RegionRevenue{{Region: "North", Revenue: 10, Net: 10}},
+		[]models.RegionRevenue{{Region: "North", Revenue: 10, Net: 10}, {Region: "South", Revenue: 7, Net: 7}},
+	)
+	if len(regions) != 2 || regions[1].Region != "South" || regions[1].Change.Net.Previous != 7 {
+		t.Errorf("regions = %+v", regions)
+	}
+}
+
+// rates serves one rate per day and records the days asked for
+type rates struct {
+	fx.Service
+	byDay map[string]float64
+	asked []string
+}
+
+func (r *rates) Base() string { return "USD" }
+
+func (r *rates) Rate(ctx context.Context, currency string, on time.Time) (float64, error) {
+	day := on.Format("2006-01-02")
+	r.asked = append(r.asked, day)
+	return r.byDay[day], nil
+}
+
+func TestComparisonPeriodConvertsAtTheSameRate(t *testing.T) {
+	fxSvc := &rates{byDay: map[string]float64{"2024-03-31": 2, "2023-03-31": 4, "2024-02-29": 8}}
+	s := &service{fx: fxSvc}
+	f := models.Filter{Start: "2024-03-01", End: "2024-03-31", Currency: "EUR"}
+
+	for _, mode := range []string{models.ComparePrevious, models.CompareYoY} {
+		prev, err := ComparisonPeriod(f, mode, "", "")
+		if err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		cur, err := s.factor(context.Background(), f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before, err := s.factor(context.Background(), prev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cur != before || cur != 0.5 {
+			t.Errorf("%s: factors %v and %v, want both 0.5", mode, cur, before)
+		}
+	}
+	for _, day := range fxSvc.asked {
+		if day != "2024-03-31" {
+			t.Errorf("rate looked up on %s", day)
+		}
+	}
+}
+
+func ptr(v float64) *float64 { return &v }
+
+func equalPercent(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,115 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"sales-analytics/internal/models"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrShortHistory = errors.New("not enough history, at least 3 complete intervals are needed")
+	ErrInvalidLevel = errors.New("invalid level, expected 80, 90, 95 or 99")
+)
+
+// seasonLength is the number of intervals in a season of each interval
+var seasonLength = map[string]int{
+	models.IntervalDaily:     7,
+	models.IntervalWeekly:    52,
+	models.IntervalMonthly:   12,
+	models.IntervalQuarterly: 4,
+	models.IntervalYearly:    0,
+}
+
+// zScores of the two sided prediction intervals
+var zScores = map[int]float64{80: 1.2816, 90: 1.6449, 95: 1.9600, 99: 2.5758}
+
+// Forecast fits a model per trend series on the complete intervals of the
+// period and forecasts the gross revenue of the next periods intervals
+func (s *service) Forecast(
+	ctx context.Context,
+	f models.Filter,
+	interval, split string,
+	periods, level int,
+) ([]models.ForecastSeries, error) {
+	z, ok := zScores[level]
+	if !ok {
+		return nil, ErrInvalidLevel
+	}
+
+	series, err := s.Trend(ctx, f, interval, split)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.ForecastSeries, 0, len(series))
+	for _, sr := range series {
+		// intervals cut by the period would read as a drop in revenue
+		history := sr.Buckets
+		for len(history) > 0 && history[0].Start < f.Start {
+			history = history[1:]
+		}
+		for len(history) > 0 && history[len(history)-1].End > f.End {
+			history = history[:len(history)-1]
+		}
+		if len(history) < 3 {
+			return nil, ErrShortHistory
+		}
+
+		y := make([]float64, len(history))
+		for i, b := range history {
+			y[i] = b.Revenue
+		}
+
+		out := models.ForecastSeries{Group: sr.Group, History: history}
+		season := seasonLength[interval]
+		if season > 0 && len(y) >= 2*season {
+			out.Model, out.SeasonLength = models.ForecastHoltWinters, season
+		} else {
+			out.Model, season = models.ForecastHolt, 0
+		}
+
+		m, err := fitSmoothing(ctx, y, season)
+		if err != nil {
+			return nil, err
+		}
+		out.Params = map[string]float64{"alpha": m.alpha, "beta": m.beta}
+		if season > 0 {
+			out.Params["gamma"] = m.gamma
+		}
+		out.RMSE = m.sigma
+
+		next, err := time.Parse("2006-01-02", history[len(history)-1].Start)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket start: %w", err)
+		}
+		for h := 1; h <= periods; h++ {
+			next = nextBucket(next, interval)
+			value, sd := m.forecast(h)
+			out.Points = append(out.Points, models.ForecastPoint{
+				Period:   bucketLabel(next, interval),
+				Start:    next.Format("2006-01-02"),
+				End:      nextBucket(next, interval).AddDate(0, 0, -1).Format("2006-01-02"),
+				Forecast: math.Max(value, 0),
+				Lower:    math.Max(value-z*sd, 0),
+				Upper:    math.Max(value+z*sd, 0),
+			})
+		}
+		result = append(result, out)
+	}
+
+	s.log.Debug("Revenue forecast calculated",
+		zap.String("start_date", f.Start),
+		zap.String("end_date", f.End),
+		zap.String("interval", interval),
+		zap.String("split", split),
+		zap.Int("periods", periods),
+		zap.Int("series", len(result)))
+
+	return result, nil
+}
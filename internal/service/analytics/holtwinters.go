@@ -0,0 +1,126 @@
+package analytics
+
+import (
+	"context"
+	"math"
+)
+
+// smoothing is a fitted additive Holt-Winters model; with season 0 it is
+// Holt's linear trend method
+type smoothing struct {
+	alpha, beta, gamma float64
+	season             int
+
+	level, trend float64
+	seasonal     []float64
+	sigma        float64
+}
+
+// run smooths y with the parameters and returns the sum of squared one
+// step errors and their count
+func (m *smoothing) run(y []float64) (float64, int) {
+	sse, n := 0.0, 0
+	if m.season == 0 {
+		m.level, m.trend = y[0], y[1]-y[0]
+		for t := 1; t < len(y); t++ {
+			e := y[t] - (m.level + m.trend)
+			sse += e * e
+			n++
+			prev := m.level
+			m.level = m.alpha*y[t] + (1-m.alpha)*(m.level+m.trend)
+			m.trend = m.beta*(m.level-prev) + (1-m.beta)*m.trend
+		}
+		return sse, n
+	}
+
+	// the first two seasons give the initial level, trend and seasonal
+	// indices
+	p := m.season
+	first, second := mean(y[:p]), mean(y[p:2*p])
+	m.level, m.trend = first, (second-first)/float64(p)
+	m.seasonal = make([]float64, len(y))
+	for i := 0; i < p; i++ {
+		m.seasonal[i] = y[i] - first
+	}
+
+	for t := p; t < len(y); t++ {
+		s := m.seasonal[t-p]
+		e := y[t] - (m.level + m.trend + s)
+		sse += e * e
+		n++
+		prev := m.level
+		m.level = m.alpha*(y[t]-s) + (1-m.alpha)*(m.level+m.trend)
+		m.trend = m.beta*(m.level-prev) + (1-m.beta)*m.trend
+		m.seasonal[t] = m.gamma*(y[t]-m.level) + (1-m.gamma)*s
+	}
+	m.seasonal = m.seasonal[len(y)-p:]
+	return sse, n
+}
+
+// forecast returns the forecast h steps after the history and the
+// standard deviation of its error
+func (m *smoothing) forecast(h int) (float64, float64) {
+	f := m.level + float64(h)*m.trend
+	if m.season > 0 {
+		f += m.seasonal[(h-1)%m.season]
+	}
+
+	variance := 1.0
+	for j := 1; j < h; j++ {
+		c := m.alpha * (1 + float64(j)*m.beta)
+		if m.season > 0 && j%m.season == 0 {
+			// the variance is stated in the error correction form, whose
+			// seasonal coefficient is (1-alpha) times the gamma used here
+			c += (1 - m.alpha) * m.gamma
+		}
+		variance += c * c
+	}
+	return f, m.sigma * math.Sqrt(variance)
+}
+
+// fitSmoothing estimates the smoothing parameters minimizing the squared
+// one step errors; season 0 fits Holt's method
+func fitSmoothing(ctx context.Context, y []float64, season int) (*smoothing, error) {
+	unit := func(v float64) float64 { return 1 / (1 + math.Exp(-v)) }
+	model := func(p []float64) *smoothing {
+		m := &smoothing{alpha: unit(p[0]), beta: unit(p[1]), season: season}
+		if season > 0 {
+			m.gamma = unit(p[2])
+		}
+		return m
+	}
+	cost := func(p []float64) float64 {
+		sse, _ := model(p).run(y)
+		if math.IsNaN(sse) {
+			return math.Inf(1)
+		}
+		return sse
+	}
+
+	start := []float64{logit(0.3), logit(0.1)}
+	if season > 0 {
+		start = append(start, logit(0.1))
+	}
+	p, err := nelderMead(ctx, cost, start, 1000)
+	if err != nil {
+		return nil, err
+	}
+	m := model(p)
+	sse, n := m.run(y)
+	if n > 0 {
+		m.sigma = math.Sqrt(sse / float64(n))
+	}
+	return m, nil
+}
+
+func logit(p float64) float64 {
+	return math.Log(p / (1 - p))
+}
+
+func mean(v []float64) float64 {
+	sum := 0.0
+	for _, x := range v {
+		sum += x
+	}
+	return sum / float64(len(v))
+}
@@ -0,0 +1,77 @@
+package analytics
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func near(a, b, tol float64) bool {
+	return math.Abs(a-b) <= tol
+}
+
+func TestHoltLinearSeries(t *testing.T) {
+	// y = 10 + 2t, Holt's method starts on the exact level and trend
+	y := make([]float64, 12)
+	for i := range y {
+		y[i] = 10 + 2*float64(i)
+	}
+
+	m := &smoothing{alpha: 0.5, beta: 0.3}
+	if sse, n := m.run(y); sse > 1e-9 || n != len(y)-1 {
+		t.Fatalf("run = %v over %d steps, want 0 over %d", sse, n, len(y)-1)
+	}
+	for h := 1; h <= 6; h++ {
+		f, _ := m.forecast(h)
+		if want := 10 + 2*float64(len(y)-1+h); !near(f, want, 1e-9) {
+			t.Errorf("forecast(%d) = %v, want %v", h, f, want)
+		}
+	}
+
+	fitted, err := fitSmoothing(context.Background(), y, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f, _ := fitted.forecast(3); !near(f, 10+2*14, 1e-6) {
+		t.Errorf("fitted forecast(3) = %v, want %v", f, 10+2*14)
+	}
+}
+
+func TestHoltWintersSeasonalSeries(t *testing.T) {
+	// y = 100 + 3t + season, the season summing to zero
+	season := []float64{5, -3, 2, -4}
+	truth := func(t int) float64 { return 100 + 3*float64(t) + season[t%len(season)] }
+	y := make([]float64, 40)
+	for i := range y {
+		y[i] = truth(i)
+	}
+
+	m, err := fitSmoothing(context.Background(), y, len(season))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for h := 1; h <= 8; h++ {
+		f, _ := m.forecast(h)
+		if want := truth(len(y) - 1 + h); !near(f, want, 0.5) {
+			t.Errorf("forecast(%d) = %v, want %v", h, f, want)
+		}
+	}
+}
+
+func TestForecastInterval(t *testing.T) {
+	holt := &smoothing{alpha: 0.5, beta: 0.2, sigma: 2}
+	// c1 = 0.5 * 1.2, c2 = 0.5 * 1.4
+	if _, sd := holt.forecast(3); !near(sd, 2*math.Sqrt(1+0.36+0.49), 1e-12) {
+		t.Errorf("Holt sd(3) = %v", sd)
+	}
+
+	seasonal := &smoothing{alpha: 0.5, beta: 0, gamma: 0.4, season: 4, sigma: 1, seasonal: make([]float64, 4)}
+	// c1..c3 = 0.5, the seasonal step adds (1 - 0.5) * 0.4
+	want := math.Sqrt(1 + 3*0.25 + 0.7*0.7)
+	if _, sd := seasonal.forecast(5); !near(sd, want, 1e-12) {
+		t.Errorf("Holt-Winters sd(5) = %v, want %v", sd, want)
+	}
+	if _, sd := seasonal.forecast(1); sd != 1 {
+		t.Errorf("sd(1) = %v, want sigma", sd)
+	}
+}
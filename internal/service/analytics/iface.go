@@ -6,12 +6,42 @@ import (
 )
 
 type Service interface {
-	Total(ctx context.Context, start, end string) (float64, error)
-	ByProduct(ctx context.Context, start, end string) ([]models.ProductRevenue, error)
-	ByCategory(ctx context.Context, start, end string) ([]models.CategoryRevenue, error)
-	ByRegion(ctx context.Context, start, end string) ([]models.RegionRevenue, error)
-	TopProducts(ctx context.Context, start, end string, limit int) ([]models.TopProduct, error)
-	CustomerCount(ctx context.Context, start, end string) (int, error)
-	OrderCount(ctx context.Context, start, end string) (int, error)
-	AverageOrderValue(ctx context.Context, start, end string) (float64, error)
+	Total(ctx context.Context, f models.Filter) (models.RevenueTotals, error)
+	ByProduct(ctx context.Context, f models.Filter) ([]models.ProductRevenue, error)
+	ByCategory(ctx context.Context, f models.Filter) ([]models.CategoryRevenue, error)
+	ByRegion(ctx context.Context, f models.Filter) ([]models.RegionRevenue, error)
+	TopProducts(ctx context.Context, f models.Filter, limit int) ([]models.TopProduct, error)
+	CustomerCount(ctx context.Context, f models.Filter) (int, error)
+	OrderCount(ctx context.Context, f models.Filter) (int, error)
+	AverageOrderValue(ctx context.Context, f models.Filter) (float64, error)
+	// KPIs returns revenue, customers, orders and average order value of the
+	// period in one call
+	KPIs(ctx context.Context, f models.Filter) (models.KPIs, error)
+	// Query runs an ad hoc query of metrics grouped by dimensions
+	Query(ctx context.Context, q models.AnalyticsQuery) (models.QueryResult, error)
+	// Cohorts groups customers by the month or quarter of their first order
+	// in the period and follows their orders in every later period
+	Cohorts(ctx context.Context, f models.Filter, granularity string) ([]models.Cohort, error)
+	// RFMSegments scores every customer by recency, frequency and monetary
+	// quintile as of f.End and summarizes the named segments
+	RFMSegments(ctx context.Context, f models.Filter) ([]models.RFMSegment, error)
+	RFMCustomers(ctx context.Context, f models.Filter, segment string, limit, offset int) (models.RFMPage, error)
+	// TopCLV predicts the lifetime value of every customer as of f.End with
+	// the configured model and returns the most valuable
+	TopCLV(ctx context.Context, f models.Filter, limit int) (models.CLVModel, []models.CLVEstimate, error)
+	// CLVByRegion averages the predicted lifetime values per region
+	CLVByRegion(ctx context.Context, f models.Filter) (models.CLVModel, []models.RegionCLV, error)
+	// Basket returns the product pairs bought together in orders of the
+	// period that meet the thresholds, by lift
+	Basket(ctx context.Context, f models.Filter, opts models.BasketOptions) (models.BasketResult, error)
+	// ABC ranks products or customers by revenue with their cumulative share
+	// and A/B/C class
+	ABC(ctx context.Context, f models.Filter, entity string, a, b float64) (models.ABCResult, error)
+	// Forecast fits a Holt-Winters model on the trend of the period and
+	// forecasts the revenue of the next periods intervals with prediction
+	// intervals at the given level
+	Forecast(ctx context.Context, f models.Filter, interval, split string, periods, level int) ([]models.ForecastSeries, error)
+	// Trend returns zero-filled revenue, order and quantity buckets of the
+	// given interval, one series per category or region when split is set
+	Trend(ctx context.Context, f models.Filter, interval, split string) ([]models.TrendSeries, error)
 }
@@ -0,0 +1,72 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"sales-analytics/internal/models"
+
+	"go.uber.org/zap"
+)
+
+// KPIs computes the headline metrics concurrently, each on its own
+// connection; the first error cancels the others
+func (s *service) KPIs(
+	ctx context.Context,
+	f models.Filter,
+) (models.KPIs, error) {
+	var k models.KPIs
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	run := func(name string, fn func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(); err != nil {
+				once.Do(func() {
+					firstErr = fmt.Errorf("%s: %w", name, err)
+					cancel()
+				})
+			}
+		}()
+	}
+
+	run("revenue", func() (err error) {
+		k.Revenue, err = s.Total(ctx, f)
+		return err
+	})
+	run("customers", func() (err error) {
+		k.Customers, err = s.CustomerCount(ctx, f)
+		return err
+	})
+	run("orders", func() (err error) {
+		k.Orders, err = s.OrderCount(ctx, f)
+		return err
+	})
+	run("average order value", func() (err error) {
+		k.AverageOrderValue, err = s.AverageOrderValue(ctx, f)
+		return err
+	})
+	wg.Wait()
+
+	if firstErr != nil {
+		return k, firstErr
+	}
+
+	s.log.Debug("KPIs calculated",
+		zap.String("start_date", f.Start),
+		zap.String("end_date", f.End),
+		zap.String("region", f.Region),
+		zap.String("category", f.Category),
+		zap.Int("orders", k.Orders))
+
+	return k, nil
+}
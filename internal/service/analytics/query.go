@@ -0,0 +1,112 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"sales-analytics/internal/models"
+	"sales-analytics/internal/repository"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultQueryLimit = 100
+	maxQueryLimit     = 10000
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+// validate checks every name of the query against the metrics and
+// dimensions the repository compiles, and the known operators, and fills
+// in the default limit
+func validate(q *models.AnalyticsQuery) error {
+	if len(q.Metrics) == 0 {
+		return fmt.Errorf("%w: at least one metric is required", ErrInvalidQuery)
+	}
+
+	selected := make(map[string]bool)
+	for _, m := range q.Metrics {
+		if ok, _ := repository.IsQueryMetric(m); !ok {
+			return fmt.Errorf("%w: unknown metric %q", ErrInvalidQuery, m)
+		}
+		if selected[m] {
+			return fmt.Errorf("%w: metric %q selected twice", ErrInvalidQuery, m)
+		}
+		selected[m] = true
+	}
+	for _, d := range q.Dimensions {
+		if !repository.IsQueryDimension(d) {
+			return fmt.Errorf("%w: unknown dimension %q", ErrInvalidQuery, d)
+		}
+		if selected[d] {
+			return fmt.Errorf("%w: dimension %q selected twice", ErrInvalidQuery, d)
+		}
+		selected[d] = true
+	}
+
+	for _, f := range q.Filters {
+		if !repository.IsQueryDimension(f.Field) {
+			return fmt.Errorf("%w: cannot filter on %q", ErrInvalidQuery, f.Field)
+		}
+		switch f.Op {
+		case models.OpEq, models.OpNe:
+		case models.OpIn, models.OpNotIn:
+			if len(f.Values) == 0 {
+				return fmt.Errorf("%w: filter on %q needs values", ErrInvalidQuery, f.Field)
+			}
+		default:
+			return fmt.Errorf("%w: unknown operator %q, expected eq, ne, in or not_in", ErrInvalidQuery, f.Op)
+		}
+	}
+
+	for _, s := range q.Sort {
+		if !selected[s.Field] {
+			return fmt.Errorf("%w: sort field %q is not a selected metric or dimension", ErrInvalidQuery, s.Field)
+		}
+	}
+
+	switch {
+	case q.Limit == 0:
+		q.Limit = defaultQueryLimit
+	case q.Limit < 0 || q.Limit > maxQueryLimit:
+		return fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, maxQueryLimit)
+	}
+	return nil
+}
+
+func (s *service) Query(
+	ctx context.Context,
+	q models.AnalyticsQuery,
+) (models.QueryResult, error) {
+	if err := validate(&q); err != nil {
+		return models.QueryResult{}, err
+	}
+
+	factor, err := s.factor(ctx, q.Filter)
+	if err != nil {
+		return models.QueryResult{}, err
+	}
+
+	result, err := s.repo.Query(ctx, q)
+	if err != nil {
+		return result, fmt.Errorf("failed to run analytics query: %w", err)
+	}
+	if factor != 1 {
+		for _, row := range result.Rows {
+			for name, v := range row {
+				if _, amount := repository.IsQueryMetric(name); amount {
+					row[name] = v.(float64) * factor
+				}
+			}
+		}
+	}
+
+	s.log.Debug("Analytics query completed",
+		zap.Strings("metrics", q.Metrics),
+		zap.Strings("dimensions", q.Dimensions),
+		zap.Int("rows", len(result.Rows)))
+
+	return result, nil
+}
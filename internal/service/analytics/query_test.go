@@ -0,0 +1,138 @@
+package analytics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"sales-analytics/internal/models"
+)
+
+func TestValidateQuery(t *testing.T) {
+	revenue := []string{models.MetricRevenue}
+	tests := []struct {
+		name string
+		q    models.AnalyticsQuery
+		want string // "" when valid
+	}{
+		{
+			name: "no metric",
+			q:    models.AnalyticsQuery{Dimensions: []string{models.DimRegion}},
+			want: "at least one metric",
+		},
+		{
+			name: "unknown metric",
+			q:    models.AnalyticsQuery{Metrics: []string{"profit"}},
+			want: `unknown metric "profit"`,
+		},
+		{
+			name: "metric twice",
+			q:    models.AnalyticsQuery{Metrics: []string{models.MetricOrders, models.MetricOrders}},
+			want: "selected twice",
+		},
+		{
+			name: "unknown dimension",
+			q:    models.AnalyticsQuery{Metrics: revenue, Dimensions: []string{"c.email"}},
+			want: `unknown dimension "c.email"`,
+		},
+		{
+			name: "unknown filter field",
+			q: models.AnalyticsQuery{
+				Metrics: revenue,
+				Filters: []models.QueryFilter{{Field: models.MetricRevenue, Op: models.OpEq, Value: "1"}},
+			},
+			want: `cannot filter on "revenue"`,
+		},
+		{
+			name: "unknown operator",
+			q: models.AnalyticsQuery{
+				Metrics: revenue,
+				Filters: []models.QueryFilter{{Field: models.DimRegion, Op: "gt", Value: "a"}},
+			},
+			want: `unknown operator "gt"`,
+		},
+		{
+			name: "empty in",
+			q: models.AnalyticsQuery{
+				Metrics: revenue,
+				Filters: []models.QueryFilter{{Field: models.DimRegion, Op: models.OpIn}},
+			},
+			want: "needs values",
+		},
+		{
+			name: "empty not_in",
+			q: models.AnalyticsQuery{
+				Metrics: revenue,
+				Filters: []models.QueryFilter{{Field: models.DimRegion, Op: models.OpNotIn}},
+			},
+			want: "needs values",
+		},
+		{
+			name: "sort on a field not selected",
+			q: models.AnalyticsQuery{
+				Metrics: revenue,
+				Sort:    []models.QuerySort{{Field: models.DimRegion}},
+			},
+			want: `sort field "region"`,
+		},
+		{
+			name: "sort on an unknown field",
+			q: models.AnalyticsQuery{
+				Metrics: revenue,
+				Sort:    []models.QuerySort{{Field: "1; select 1"}},
+			},
+			want: "sort field",
+		},
+		{
+			name: "negative limit",
+			q:    models.AnalyticsQuery{Metrics: revenue, Limit: -1},
+			want: "limit must be between 1 and 10000",
+		},
+		{
+			name: "limit above the maximum",
+			q:    models.AnalyticsQuery{Metrics: revenue, Limit: maxQueryLimit + 1},
+			want: "limit must be between 1 and 10000",
+		},
+		{
+			name: "valid",
+			q: models.AnalyticsQuery{
+				Metrics:    []string{models.MetricNet, models.MetricCustomers},
+				Dimensions: []string{models.DimRegion, models.DimMonth},
+				Filters: []models.QueryFilter{
+					{Field: models.DimCategory, Op: models.OpNotIn, Values: []string{"Books"}},
+					{Field: models.DimYear, Op: models.OpNe, Value: "2023"},
+				},
+				Sort:  []models.QuerySort{{Field: models.MetricNet, Desc: true}, {Field: models.DimMonth}},
+				Limit: maxQueryLimit,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate(&tt.q)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("validate: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidQuery) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want ErrInvalidQuery with %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateQueryLimit(t *testing.T) {
+	for _, tt := range []struct{ limit, want int }{
+		{0, defaultQueryLimit},
+		{1, 1},
+		{maxQueryLimit, maxQueryLimit},
+	} {
+		q := models.AnalyticsQuery{Metrics: []string{models.MetricRevenue}, Limit: tt.limit}
+		if err := validate(&q); err != nil || q.Limit != tt.want {
+			t.Errorf("limit %d: got %d, %v, want %d", tt.limit, q.Limit, err, tt.want)
+		}
+	}
+}
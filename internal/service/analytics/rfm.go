@@ -0,0 +1,99 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"sales-analytics/internal/models"
+
+	"go.uber.org/zap"
+)
+
+var ErrInvalidSegment = errors.New("invalid segment")
+
+// segments in the order they are reported
+var segments = []string{
+	models.SegmentChampions,
+	models.SegmentLoyal,
+	models.SegmentPotentialLoyalists,
+	models.SegmentNewCustomers,
+	models.SegmentNeedAttention,
+	models.SegmentAboutToSleep,
+	models.SegmentAtRisk,
+	models.SegmentHibernating,
+	models.SegmentLost,
+}
+
+// RFMSegments scores customers as of f.End and summarizes every segment,
+// empty ones included
+func (s *service) RFMSegments(
+	ctx context.Context,
+	f models.Filter,
+) ([]models.RFMSegment, error) {
+	factor, err := s.factor(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	found, err := s.repo.GetRFMSegments(ctx, f.End)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate rfm segments: %w", err)
+	}
+	bySegment := make(map[string]models.RFMSegment, len(found))
+	for _, seg := range found {
+		bySegment[seg.Segment] = seg
+	}
+
+	result := make([]models.RFMSegment, 0, len(segments))
+	for _, name := range segments {
+		seg := bySegment[name]
+		seg.Segment = name
+		seg.AvgMonetary *= factor
+		seg.Monetary *= factor
+		result = append(result, seg)
+	}
+
+	s.log.Debug("RFM segments calculated",
+		zap.String("as_of", f.End),
+		zap.Int("scored_segments", len(found)))
+
+	return result, nil
+}
+
+// RFMCustomers returns a page of customers scored as of f.End, best first
+func (s *service) RFMCustomers(
+	ctx context.Context,
+	f models.Filter,
+	segment string,
+	limit, offset int,
+) (models.RFMPage, error) {
+	page := models.RFMPage{Limit: limit, Offset: offset}
+	if segment != "" && !contains(segments, segment) {
+		return page, fmt.Errorf("%w %q", ErrInvalidSegment, segment)
+	}
+
+	factor, err := s.factor(ctx, f)
+	if err != nil {
+		return page, err
+	}
+
+	page.Customers, page.Total, err = s.repo.GetRFMCustomers(ctx, f.End, segment, limit, offset)
+	if err != nil {
+		return page, fmt.Errorf("failed to list rfm customers: %w", err)
+	}
+	for i := range page.Customers {
+		page.Customers[i].Monetary *= factor
+	}
+
+	return page, nil
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
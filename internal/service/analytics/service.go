@@ -4,134 +4,230 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"sync"
+	"time"
 
+	"sales-analytics/config"
 	"sales-analytics/internal/models"
 	"sales-analytics/internal/repository"
+	"sales-analytics/internal/service/fx"
 
 	"go.uber.org/zap"
 )
 
 type service struct {
 	repo repository.AnalyticsRepo
+	fx   fx.Service
+	clv  config.CLV
 	log  *zap.Logger
+
+	// fits caches fitted BG/NBD models, see fitBGNBD
+	fitMu sync.Mutex
+	fits  map[fitKey]bgnbd
 }
 
-func New(db *sql.DB, log *zap.Logger) Service {
+func New(db *sql.DB, fxSvc fx.Service, clv config.CLV, log *zap.Logger) Service {
 	repo := repository.NewAnalyticsRepo(db)
 	return &service{
 		repo: repo,
+		fx:   fxSvc,
+		clv:  clv,
 		log:  log,
 	}
 }
 
-func (s *service) Total(ctx context.Context, start, end string) (float64, error) {
-	revenue, err := s.repo.GetTotalRevenue(ctx, start, end)
+// factor converts base currency amounts to the currency of the filter
+func (s *service) factor(ctx context.Context, f models.Filter) (float64, error) {
+	if f.Currency == "" || f.Currency == s.fx.Base() {
+		return 1, nil
+	}
+
+	day := f.End
+	if f.RateOn != "" {
+		day = f.RateOn
+	}
+	on, err := time.Parse("2006-01-02", day)
 	if err != nil {
-		return 0, fmt.Errorf("failed to calculate total revenue: %w", err)
+		return 0, fmt.Errorf("invalid rate date: %w", err)
 	}
+	rate, err := s.fx.Rate(ctx, f.Currency, on)
+	if err != nil {
+		return 0, err
+	}
+	return 1 / rate, nil
+}
+
+func (s *service) Total(ctx context.Context, f models.Filter) (models.RevenueTotals, error) {
+	factor, err := s.factor(ctx, f)
+	if err != nil {
+		return models.RevenueTotals{}, err
+	}
+
+	revenue, err := s.repo.GetTotalRevenue(ctx, f)
+	if err != nil {
+		return revenue, fmt.Errorf("failed to calculate total revenue: %w", err)
+	}
+	revenue.Gross *= factor
+	revenue.Returns *= factor
+	revenue.Net *= factor
 
 	s.log.Debug("Total revenue calculated",
-		zap.String("start_date", start),
-		zap.String("end_date", end),
-		zap.Float64("revenue", revenue))
+		zap.String("start_date", f.Start),
+		zap.String("end_date", f.End),
+		zap.Float64("revenue", revenue.Gross),
+		zap.Float64("returns", revenue.Returns),
+		zap.Int("unconverted", revenue.Unconverted))
+
+	if revenue.Unconverted > 0 {
+		s.log.Warn("sales without fx rate left out of revenue",
+			zap.String("start_date", f.Start),
+			zap.String("end_date", f.End),
+			zap.Int("unconverted", revenue.Unconverted))
+	}
 
 	return revenue, nil
 }
 
-func (s *service) ByProduct(ctx context.Context, start, end string) ([]models.ProductRevenue, error) {
-	products, err := s.repo.GetRevenueByProduct(ctx, start, end)
+func (s *service) ByProduct(ctx context.Context, f models.Filter) ([]models.ProductRevenue, error) {
+	factor, err := s.factor(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	products, err := s.repo.GetRevenueByProduct(ctx, f)
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate revenue by product: %w", err)
 	}
+	for i := range products {
+		products[i].Revenue *= factor
+		products[i].Returns *= factor
+		products[i].Net *= factor
+	}
 
 	s.log.Debug("Revenue by product calculated",
-		zap.String("start_date", start),
-		zap.String("end_date", end),
+		zap.String("start_date", f.Start),
+		zap.String("end_date", f.End),
 		zap.Int("product_count", len(products)))
 
 	return products, nil
 }
 
-func (s *service) ByCategory(ctx context.Context, start, end string) ([]models.CategoryRevenue, error) {
-	categories, err := s.repo.GetRevenueByCategory(ctx, start, end)
+func (s *service) ByCategory(ctx context.Context, f models.Filter) ([]models.CategoryRevenue, error) {
+	factor, err := s.factor(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := s.repo.GetRevenueByCategory(ctx, f)
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate revenue by category: %w", err)
 	}
+	for i := range categories {
+		categories[i].Revenue *= factor
+		categories[i].Returns *= factor
+		categories[i].Net *= factor
+	}
 
 	s.log.Debug("Revenue by category calculated",
-		zap.String("start_date", start),
-		zap.String("end_date", end),
+		zap.String("start_date", f.Start),
+		zap.String("end_date", f.End),
 		zap.Int("category_count", len(categories)))
 
 	return categories, nil
 }
 
-func (s *service) ByRegion(ctx context.Context, start, end string) ([]models.RegionRevenue, error) {
-	regions, err := s.repo.GetRevenueByRegion(ctx, start, end)
+func (s *service) ByRegion(ctx context.Context, f models.Filter) ([]models.RegionRevenue, error) {
+	factor, err := s.factor(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	regions, err := s.repo.GetRevenueByRegion(ctx, f)
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate revenue by region: %w", err)
 	}
+	for i := range regions {
+		regions[i].Revenue *= factor
+		regions[i].Returns *= factor
+		regions[i].Net *= factor
+	}
 
 	s.log.Debug("Revenue by region calculated",
-		zap.String("start_date", start),
-		zap.String("end_date", end),
+		zap.String("start_date", f.Start),
+		zap.String("end_date", f.End),
 		zap.Int("region_count", len(regions)))
 
 	return regions, nil
 }
 
-func (s *service) TopProducts(ctx context.Context, start, end string, limit int) ([]models.TopProduct, error) {
-	products, err := s.repo.GetTopProducts(ctx, start, end, limit)
+func (s *service) TopProducts(ctx context.Context, f models.Filter, limit int) ([]models.TopProduct, error) {
+	factor, err := s.factor(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	products, err := s.repo.GetTopProducts(ctx, f, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to calculate top products: %w", err)
 	}
+	for i := range products {
+		products[i].Revenue *= factor
+		products[i].Returns *= factor
+		products[i].Net *= factor
+	}
 
 	s.log.Debug("Top products calculated",
-		zap.String("start_date", start),
-		zap.String("end_date", end),
+		zap.String("start_date", f.Start),
+		zap.String("end_date", f.End),
 		zap.Int("limit", limit),
 		zap.Int("product_count", len(products)))
 
 	return products, nil
 }
 
-func (s *service) CustomerCount(ctx context.Context, start, end string) (int, error) {
-	count, err := s.repo.GetCustomerCount(ctx, start, end)
+func (s *service) CustomerCount(ctx context.Context, f models.Filter) (int, error) {
+	count, err := s.repo.GetCustomerCount(ctx, f)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count customers: %w", err)
 	}
 
 	s.log.Debug("Customer count calculated",
-		zap.String("start_date", start),
-		zap.String("end_date", end),
+		zap.String("start_date", f.Start),
+		zap.String("end_date", f.End),
 		zap.Int("count", count))
 
 	return count, nil
 }
 
-func (s *service) OrderCount(ctx context.Context, start, end string) (int, error) {
-	count, err := s.repo.GetOrderCount(ctx, start, end)
+func (s *service) OrderCount(ctx context.Context, f models.Filter) (int, error) {
+	count, err := s.repo.GetOrderCount(ctx, f)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count orders: %w", err)
 	}
 
 	s.log.Debug("Order count calculated",
-		zap.String("start_date", start),
-		zap.String("end_date", end),
+		zap.String("start_date", f.Start),
+		zap.String("end_date", f.End),
 		zap.Int("count", count))
 
 	return count, nil
 }
 
-func (s *service) AverageOrderValue(ctx context.Context, start, end string) (float64, error) {
-	avg, err := s.repo.GetAverageOrderValue(ctx, start, end)
+func (s *service) AverageOrderValue(ctx context.Context, f models.Filter) (float64, error) {
+	factor, err := s.factor(ctx, f)
+	if err != nil {
+		return 0, err
+	}
+
+	avg, err := s.repo.GetAverageOrderValue(ctx, f)
 	if err != nil {
 		return 0, fmt.Errorf("failed to calculate average order value: %w", err)
 	}
+	avg *= factor
 
 	s.log.Debug("Average order value calculated",
-		zap.String("start_date", start),
-		zap.String("end_date", end),
+		zap.String("start_date", f.Start),
+		zap.String("end_date", f.End),
 		zap.Float64("average", avg))
 
 	return avg, nil
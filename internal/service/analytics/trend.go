@@ -0,0 +1,159 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"sales-analytics/internal/models"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidInterval = errors.New("invalid interval, expected daily, weekly, monthly, quarterly or yearly")
+	ErrInvalidSplit    = errors.New("invalid split, expected category or region")
+)
+
+// bucketStart returns the first day of the interval containing day; weeks
+// start on Monday
+func bucketStart(day time.Time, interval string) time.Time {
+	y, m, d := day.Date()
+	switch interval {
+	case models.IntervalWeekly:
+		offset := (int(day.Weekday()) + 6) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, time.UTC)
+	case models.IntervalMonthly:
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+	case models.IntervalQuarterly:
+		return time.Date(y, m-(m-1)%3, 1, 0, 0, 0, 0, time.UTC)
+	case models.IntervalYearly:
+		return time.Date(y, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// nextBucket returns the first day of the interval after the one starting
+// on start
+func nextBucket(start time.Time, interval string) time.Time {
+	switch interval {
+	case models.IntervalWeekly:
+		return start.AddDate(0, 0, 7)
+	case models.IntervalMonthly:
+		return start.AddDate(0, 1, 0)
+	case models.IntervalQuarterly:
+		return start.AddDate(0, 3, 0)
+	case models.IntervalYearly:
+		return start.AddDate(1, 0, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// bucketLabel names the interval starting on start
+func bucketLabel(start time.Time, interval string) string {
+	switch interval {
+	case models.IntervalWeekly:
+		y, w := start.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", y, w)
+	case models.IntervalMonthly:
+		return start.Format("2006-01")
+	case models.IntervalQuarterly:
+		return fmt.Sprintf("%d-Q%d", start.Year(), (int(start.Month())-1)/3+1)
+	case models.IntervalYearly:
+		return start.Format("2006")
+	}
+	return start.Format("2006-01-02")
+}
+
+func (s *service) Trend(
+	ctx context.Context,
+	f models.Filter,
+	interval, split string,
+) ([]models.TrendSeries, error) {
+	switch interval {
+	case models.IntervalDaily, models.IntervalWeekly, models.IntervalMonthly,
+		models.IntervalQuarterly, models.IntervalYearly:
+	default:
+		return nil, ErrInvalidInterval
+	}
+	switch split {
+	case "", "category", "region":
+	default:
+		return nil, ErrInvalidSplit
+	}
+
+	start, err := time.Parse("2006-01-02", f.Start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start date: %w", err)
+	}
+	end, err := time.Parse("2006-01-02", f.End)
+	if err != nil {
+		return nil, fmt.Errorf("invalid end date: %w", err)
+	}
+
+	factor, err := s.factor(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	days, err := s.repo.GetDailyRevenue(ctx, f, split)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate revenue trend: %w", err)
+	}
+
+	// the empty buckets every series starts from
+	var template []models.TrendBucket
+	index := make(map[time.Time]int)
+	for b := bucketStart(start, interval); !b.After(end); b = nextBucket(b, interval) {
+		index[b] = len(template)
+		template = append(template, models.TrendBucket{
+			Period: bucketLabel(b, interval),
+			Start:  b.Format("2006-01-02"),
+			End:    nextBucket(b, interval).AddDate(0, 0, -1).Format("2006-01-02"),
+		})
+	}
+
+	series := make(map[string][]models.TrendBucket)
+	if split == "" {
+		series[""] = append([]models.TrendBucket(nil), template...)
+	}
+	for _, d := range days {
+		buckets, ok := series[d.Group]
+		if !ok {
+			buckets = append([]models.TrendBucket(nil), template...)
+			series[d.Group] = buckets
+		}
+		i, ok := index[bucketStart(d.Day, interval)]
+		if !ok {
+			continue
+		}
+		buckets[i].Revenue += d.Revenue * factor
+		buckets[i].Returns += d.Returns * factor
+		buckets[i].Net += d.Net * factor
+		buckets[i].Orders += d.Orders
+		buckets[i].Quantity += d.Quantity
+	}
+
+	groups := make([]string, 0, len(series))
+	for g := range series {
+		groups = append(groups, g)
+	}
+	sort.Strings(groups)
+
+	result := make([]models.TrendSeries, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, models.TrendSeries{Group: g, Buckets: series[g]})
+	}
+
+	s.log.Debug("Revenue trend calculated",
+		zap.String("start_date", f.Start),
+		zap.String("end_date", f.End),
+		zap.String("interval", interval),
+		zap.String("split", split),
+		zap.Int("series", len(result)),
+		zap.Int("buckets", len(template)))
+
+	return result, nil
+}
@@ -0,0 +1,100 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"sales-analytics/internal/models"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// header is the column layout of the ingestion CSV, followed by the
+// optional currency column, so an export can be loaded again as is
+var header = []string{
+	"Order ID", "Product ID", "Customer ID", "Product Name", "Category", "Region",
+	"Date of Sale", "Quantity Sold", "Unit Price", "Discount", "Shipping Cost",
+	"Payment Method", "Customer Name", "Customer Email", "Customer Address", "Currency",
+}
+
+type encoder interface {
+	encode(row models.SaleRow) error
+	flush() error
+}
+
+func newEncoder(
+	format string,
+	w io.Writer,
+) (encoder, error) {
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(header); err != nil {
+			return nil, err
+		}
+		return &csvEncoder{w: cw, rec: make([]string, len(header))}, nil
+	case FormatNDJSON:
+		bw := bufio.NewWriter(w)
+		return &ndjsonEncoder{w: bw, enc: json.NewEncoder(bw)}, nil
+	default:
+		return nil, ErrInvalidFormat
+	}
+}
+
+type csvEncoder struct {
+	w   *csv.Writer
+	rec []string
+}
+
+func (e *csvEncoder) encode(
+	row models.SaleRow,
+) error {
+	// the payment method is not stored, its column stays empty
+	e.rec[0] = row.OrderID
+	e.rec[1] = row.ProductID
+	e.rec[2] = row.CustomerID
+	e.rec[3] = row.ProductName
+	e.rec[4] = row.Category
+	e.rec[5] = row.Region
+	e.rec[6] = row.DateOfSale
+	e.rec[7] = strconv.Itoa(row.Quantity)
+	e.rec[8] = formatFloat(row.UnitPrice)
+	e.rec[9] = formatFloat(row.Discount)
+	e.rec[10] = formatFloat(row.ShippingCost)
+	e.rec[11] = ""
+	e.rec[12] = row.CustomerName
+	e.rec[13] = row.CustomerEmail
+	e.rec[14] = row.CustomerAddress
+	e.rec[15] = row.Currency
+	return e.w.Write(e.rec)
+}
+
+func (e *csvEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonEncoder struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) encode(
+	row models.SaleRow,
+) error {
+	return e.enc.Encode(row)
+}
+
+func (e *ndjsonEncoder) flush() error {
+	return e.w.Flush()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
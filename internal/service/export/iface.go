@@ -0,0 +1,16 @@
+package export
+
+import (
+	"context"
+	"io"
+
+	"sales-analytics/internal/models"
+)
+
+type Service interface {
+	// Sales writes the order items matching f to w in the given format,
+	// row by row, and returns the number of rows written. flush, when not
+	// nil, is called every few rows so the client receives data as it is
+	// read.
+	Sales(ctx context.Context, f models.ExportFilter, format string, w io.Writer, flush func() error) (int, error)
+}
@@ -0,0 +1,94 @@
+package export
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+
+	"sales-analytics/internal/models"
+	"sales-analytics/internal/repository"
+	"sales-analytics/pkg/pii"
+
+	"go.uber.org/zap"
+)
+
+// rows written between two flushes
+const flushEvery = 1000
+
+var ErrInvalidFormat = errors.New("invalid format, expected csv or ndjson")
+
+type service struct {
+	repo repository.ExportRepository
+	keys *pii.Keyring
+	log  *zap.Logger
+}
+
+func New(
+	db *sql.DB,
+	keys *pii.Keyring,
+	log *zap.Logger,
+) Service {
+	return &service{
+		repo: repository.NewExportRepo(db),
+		keys: keys,
+		log:  log,
+	}
+}
+
+func (s *service) Sales(
+	ctx context.Context,
+	f models.ExportFilter,
+	format string,
+	w io.Writer,
+	flush func() error,
+) (int, error) {
+	enc, err := newEncoder(format, w)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = s.repo.Sales(ctx, f, func(row models.SaleRow) error {
+		if f.IncludePII {
+			email, err := s.keys.Decrypt(row.CustomerEmail)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt email of customer %s: %w", row.CustomerID, err)
+			}
+			address, err := s.keys.Decrypt(row.CustomerAddress)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt address of customer %s: %w", row.CustomerID, err)
+			}
+			row.CustomerEmail, row.CustomerAddress = email, address
+		}
+
+		if err := enc.encode(row); err != nil {
+			return fmt.Errorf("failed to write sale row: %w", err)
+		}
+		count++
+
+		if count%flushEvery == 0 {
+			return s.flush(enc, flush)
+		}
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+
+	return count, s.flush(enc, flush)
+}
+
+func (s *service) flush(
+	enc encoder,
+	flush func() error,
+) error {
+	if err := enc.flush(); err != nil {
+		return fmt.Errorf("failed to write sale rows: %w", err)
+	}
+	if flush != nil {
+		return flush()
+	}
+	return nil
+}
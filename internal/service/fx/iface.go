@@ -0,0 +1,25 @@
+package fx
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"sales-analytics/internal/models"
+)
+
+type Service interface {
+	// Base is the currency amounts are converted to
+	Base() string
+
+	// Load upserts the rates of a date,currency,rate CSV and recomputes the
+	// base amounts of sales they apply to
+	Load(ctx context.Context, r io.Reader) (models.FXLoad, error)
+
+	// Rate returns the value of one unit of currency in the base currency
+	// on the given day
+	Rate(ctx context.Context, currency string, on time.Time) (float64, error)
+
+	// Table loads every rate for in-memory lookups during ingestion
+	Table(ctx context.Context) (*Table, error)
+}
@@ -0,0 +1,236 @@
+package fx
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"sales-analytics/internal/models"
+	"sales-analytics/internal/repository"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultBase = "USD"
+	dateLayout  = "2006-01-02"
+	batchSize   = 1000
+)
+
+var (
+	// ErrNoRate is returned when no rate of a currency was loaded for the
+	// requested day or before
+	ErrNoRate      = errors.New("no fx rate for currency")
+	ErrInvalidFile = errors.New("invalid fx rates file")
+
+	currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// NormalizeCurrency upper-cases a currency code, reporting whether it is a
+// three letter ISO 4217 style code
+func NormalizeCurrency(code string) (string, bool) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return code, currencyCode.MatchString(code)
+}
+
+type service struct {
+	db   *sql.DB
+	repo repository.FXRepository
+	base string
+	log  *zap.Logger
+}
+
+func New(
+	db *sql.DB,
+	base string,
+	log *zap.Logger,
+) (Service, error) {
+	if base == "" {
+		base = defaultBase
+	}
+	base, ok := NormalizeCurrency(base)
+	if !ok {
+		return nil, fmt.Errorf("invalid base currency %q", base)
+	}
+
+	return &service{
+		db:   db,
+		repo: repository.NewFXRepo(db),
+		base: base,
+		log:  log,
+	}, nil
+}
+
+func (s *service) Base() string {
+	return s.base
+}
+
+func (s *service) Rate(
+	ctx context.Context,
+	currency string,
+	on time.Time,
+) (float64, error) {
+	if currency == s.base {
+		return 1, nil
+	}
+
+	rate, err := s.repo.Rate(ctx, currency, on)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("%w %s on %s", ErrNoRate, currency, on.Format(dateLayout))
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get fx rate: %w", err)
+	}
+	return rate, nil
+}
+
+func (s *service) Table(
+	ctx context.Context,
+) (*Table, error) {
+	rates, err := s.repo.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newTable(s.base, rates), nil
+}
+
+// Load reads the whole file before writing anything, a single bad line
+// rejects the file
+func (s *service) Load(
+	ctx context.Context,
+	r io.Reader,
+) (models.FXLoad, error) {
+	var load models.FXLoad
+
+	rates, err := s.parse(r)
+	if err != nil {
+		return load, err
+	}
+	if len(rates) == 0 {
+		return load, fmt.Errorf("%w: no rates", ErrInvalidFile)
+	}
+
+	// earliest date per currency, sales from then on are reconverted
+	from := make(map[string]time.Time)
+	minDate, maxDate := rates[0].Date, rates[0].Date
+	for _, rate := range rates {
+		if d, ok := from[rate.Currency]; !ok || rate.Date.Before(d) {
+			from[rate.Currency] = rate.Date
+		}
+		if rate.Date.Before(minDate) {
+			minDate = rate.Date
+		}
+		if rate.Date.After(maxDate) {
+			maxDate = rate.Date
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return load, fmt.Errorf("failed to begin fx load: %w", err)
+	}
+	defer tx.Rollback()
+
+	repo := repository.NewFXRepo(tx)
+	for start := 0; start < len(rates); start += batchSize {
+		end := min(start+batchSize, len(rates))
+		if _, err := repo.BulkUpsert(ctx, rates[start:end]); err != nil {
+			return load, fmt.Errorf("failed to store fx rates: %w", err)
+		}
+	}
+
+	for currency, d := range from {
+		orders, items, returns, err := repo.Reconvert(ctx, currency, d)
+		if err != nil {
+			return load, err
+		}
+		load.Orders += orders
+		load.Items += items
+		load.Returns += returns
+		load.Currencies = append(load.Currencies, currency)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return load, fmt.Errorf("failed to commit fx load: %w", err)
+	}
+
+	slices.Sort(load.Currencies)
+	load.Rates = len(rates)
+	load.From = minDate.Format(dateLayout)
+	load.To = maxDate.Format(dateLayout)
+
+	s.log.Info("fx rates loaded",
+		zap.Int("rates", load.Rates),
+		zap.Strings("currencies", load.Currencies),
+		zap.String("from", load.From),
+		zap.String("to", load.To),
+		zap.Int64("orders_reconverted", load.Orders),
+		zap.Int64("items_reconverted", load.Items),
+		zap.Int64("returns_reconverted", load.Returns))
+
+	return load, nil
+}
+
+// parse reads a CSV with a date, currency and rate header, in any order
+func (s *service) parse(
+	r io.Reader,
+) ([]models.FXRate, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read header: %s", ErrInvalidFile, err)
+	}
+	col := map[string]int{"date": -1, "currency": -1, "rate": -1}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := col[name]; ok {
+			col[name] = i
+		}
+	}
+	for name, i := range col {
+		if i < 0 {
+			return nil, fmt.Errorf("%w: missing %s column", ErrInvalidFile, name)
+		}
+	}
+
+	var rates []models.FXRate
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidFile, err)
+		}
+		line, _ := cr.FieldPos(0)
+
+		date, err := time.Parse(dateLayout, strings.TrimSpace(rec[col["date"]]))
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: invalid date", ErrInvalidFile, line)
+		}
+		currency, ok := NormalizeCurrency(rec[col["currency"]])
+		if !ok {
+			return nil, fmt.Errorf("%w: line %d: invalid currency %q", ErrInvalidFile, line, rec[col["currency"]])
+		}
+		if currency == s.base {
+			return nil, fmt.Errorf("%w: line %d: %s is the base currency", ErrInvalidFile, line, currency)
+		}
+		rate, err := strconv.ParseFloat(strings.TrimSpace(rec[col["rate"]]), 64)
+		if err != nil || rate <= 0 {
+			return nil, fmt.Errorf("%w: line %d: rate must be a positive number", ErrInvalidFile, line)
+		}
+
+		rates = append(rates, models.FXRate{Currency: currency, Date: date, Rate: rate})
+	}
+	return rates, nil
+}
@@ -0,0 +1,46 @@
+package fx
+
+import (
+	"sort"
+	"time"
+
+	"sales-analytics/internal/models"
+)
+
+// Table is an in-memory snapshot of the fx rates, safe for concurrent reads
+type Table struct {
+	base  string
+	rates map[string][]models.FXRate // per currency, ordered by date
+}
+
+func newTable(base string, rates []models.FXRate) *Table {
+	t := &Table{base: base, rates: make(map[string][]models.FXRate)}
+	for _, r := range rates {
+		t.rates[r.Currency] = append(t.rates[r.Currency], r)
+	}
+	for _, rs := range t.rates {
+		sort.Slice(rs, func(i, j int) bool { return rs[i].Date.Before(rs[j].Date) })
+	}
+	return t
+}
+
+// Base is the currency the table converts to
+func (t *Table) Base() string {
+	return t.base
+}
+
+// Rate returns the rate of currency in effect on the given day, false when
+// none was loaded for that day or before
+func (t *Table) Rate(currency string, on time.Time) (float64, bool) {
+	if currency == t.base {
+		return 1, true
+	}
+
+	rs := t.rates[currency]
+	// first rate after the day, the one before it is in effect
+	i := sort.Search(len(rs), func(i int) bool { return rs[i].Date.After(on) })
+	if i == 0 {
+		return 0, false
+	}
+	return rs[i-1].Rate, true
+}
@@ -0,0 +1,25 @@
+package identity
+
+import (
+	"context"
+
+	"sales-analytics/internal/models"
+)
+
+type Service interface {
+	// Resolve links every customer without a person to one: by normalized
+	// email automatically, otherwise to a new person, proposing a merge
+	// when the name and address resemble an existing person. Runs are
+	// serialized, ErrResolveBusy is returned when another does not finish
+	// in time.
+	Resolve(ctx context.Context) (models.ResolveResult, error)
+
+	// Schedule runs Resolve in the background
+	Schedule()
+
+	Candidates(ctx context.Context, status string, limit int) ([]models.MergeCandidate, error)
+	Approve(ctx context.Context, id int64) (models.Person, error)
+	Reject(ctx context.Context, id int64) error
+
+	Person(ctx context.Context, id int64) (models.Person, error)
+}
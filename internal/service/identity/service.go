@@ -0,0 +1,373 @@
+package identity
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"sales-analytics/internal/constants"
+	"sales-analytics/internal/models"
+	"sales-analytics/internal/repository"
+	"sales-analytics/pkg/pii"
+
+	"go.uber.org/zap"
+)
+
+const (
+	batchSize = 1000
+	// similar persons compared per new person
+	maxCandidates = 50
+
+	// RuleNameAddress proposes a merge of persons with similar names and
+	// addresses
+	RuleNameAddress = "name_address"
+	// proposeThreshold is the lowest name and address score proposed
+	proposeThreshold = 0.85
+
+	// resolveLock serializes resolution runs across jobs and instances, two
+	// runs would both create a person for a customer without an email
+	resolveLock        = "identity_resolve"
+	resolveLockTimeout = 30 * time.Second
+)
+
+var (
+	ErrCandidateNotFound = errors.New("merge candidate not found")
+	ErrNotPending        = errors.New("merge candidate already decided")
+	ErrPersonNotFound    = errors.New("person not found")
+	ErrResolveBusy       = errors.New("identity resolution already running")
+)
+
+type service struct {
+	db   *sql.DB
+	repo repository.IdentityRepository
+	keys *pii.Keyring
+	log  *zap.Logger
+
+	// background runs started by Schedule; a request while one runs is
+	// picked up by another run after it
+	mu      sync.Mutex
+	running bool
+	pending bool
+}
+
+func New(
+	db *sql.DB,
+	keys *pii.Keyring,
+	log *zap.Logger,
+) Service {
+	return &service{
+		db:   db,
+		repo: repository.NewIdentityRepo(db),
+		keys: keys,
+		log:  log,
+	}
+}
+
+// Resolve links the unlinked customers in batches, one transaction each,
+// holding the resolution lock for the whole run
+func (s *service) Resolve(
+	ctx context.Context,
+) (models.ResolveResult, error) {
+	var result models.ResolveResult
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if err := repository.Lock(ctx, conn, resolveLock, resolveLockTimeout); err != nil {
+		if errors.Is(err, repository.ErrLockTimeout) {
+			return result, ErrResolveBusy
+		}
+		return result, err
+	}
+	defer repository.Unlock(context.WithoutCancel(ctx), conn, resolveLock)
+
+	for {
+		n, err := s.resolveBatch(ctx, conn, &result)
+		if err != nil {
+			return result, err
+		}
+		if n == 0 {
+			break
+		}
+	}
+
+	s.log.Info("identities resolved",
+		zap.Int("customers", result.Customers),
+		zap.Int("merged", result.Merged),
+		zap.Int("persons_created", result.Created),
+		zap.Int("proposed", result.Proposed))
+	return result, nil
+}
+
+// resolveBatch links up to batchSize unlinked customers in one transaction
+// and returns how many it linked
+func (s *service) resolveBatch(
+	ctx context.Context,
+	conn *sql.Conn,
+	result *models.ResolveResult,
+) (int, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin resolution batch: %w", err)
+	}
+	defer tx.Rollback()
+
+	repo := repository.NewIdentityRepo(tx)
+	customers, err := repo.Unlinked(ctx, batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	batch := models.ResolveResult{}
+	for _, c := range customers {
+		if err := s.resolve(ctx, repo, c, &batch); err != nil {
+			return 0, fmt.Errorf("failed to resolve customer %s: %w", c.ID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit resolution batch: %w", err)
+	}
+
+	result.Customers += batch.Customers
+	result.Merged += batch.Merged
+	result.Created += batch.Created
+	result.Proposed += batch.Proposed
+	return len(customers), nil
+}
+
+// Schedule starts a resolution run in the background, or another one after
+// the current run when one is in progress
+func (s *service) Schedule() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		s.pending = true
+		return
+	}
+	s.running = true
+	go s.background()
+}
+
+func (s *service) background() {
+	for {
+		if _, err := s.Resolve(context.Background()); err != nil {
+			// customers stay unlinked and are picked up by the next run
+			s.log.Error("background identity resolution failed", zap.Error(err))
+		}
+
+		s.mu.Lock()
+		if !s.pending {
+			s.running = false
+			s.mu.Unlock()
+			return
+		}
+		s.pending = false
+		s.mu.Unlock()
+	}
+}
+
+// resolve links one customer. A customer whose normalized email belongs to
+// a person joins it; everyone else gets a new person, which is compared
+// against persons with a similar sounding name.
+func (s *service) resolve(
+	ctx context.Context,
+	repo repository.IdentityRepository,
+	c models.Customer,
+	result *models.ResolveResult,
+) error {
+	email, err := s.keys.Decrypt(c.Email)
+	if err != nil {
+		return err
+	}
+	address, err := s.keys.Decrypt(c.Address)
+	if err != nil {
+		return err
+	}
+
+	// the person gets its own ciphertext, customers loaded before
+	// encryption was enabled have none yet
+	person := c
+	if person.Email, person.EmailIndex, err = s.keys.Email(email); err != nil {
+		return err
+	}
+	if person.Address, err = s.keys.Encrypt(address); err != nil {
+		return err
+	}
+
+	personID, created, err := repo.UpsertPerson(ctx, person)
+	if err != nil {
+		return err
+	}
+	if err := repo.Link(ctx, c.ID, personID); err != nil {
+		return fmt.Errorf("failed to link customer: %w", err)
+	}
+
+	result.Customers++
+	if !created {
+		result.Merged++
+		return nil
+	}
+	result.Created++
+
+	similar, err := repo.SimilarPersons(ctx, c.Name, personID, maxCandidates)
+	if err != nil {
+		return err
+	}
+
+	var best models.MergeCandidate
+	for _, p := range similar {
+		matchAddress, err := s.keys.Decrypt(p.Address)
+		if err != nil {
+			return err
+		}
+		score := 0.5*nameSimilarity(c.Name, p.Name) + 0.5*addressSimilarity(address, matchAddress)
+		if score >= proposeThreshold && score > best.Score {
+			best = models.MergeCandidate{
+				PersonID:      personID,
+				MatchPersonID: p.ID,
+				CustomerID:    c.ID,
+				Rule:          RuleNameAddress,
+				Score:         score,
+			}
+		}
+	}
+	if best.MatchPersonID == 0 {
+		return nil
+	}
+
+	proposed, err := repo.Propose(ctx, best)
+	if err != nil {
+		return err
+	}
+	if proposed {
+		result.Proposed++
+	}
+	return nil
+}
+
+func (s *service) Candidates(
+	ctx context.Context,
+	status string,
+	limit int,
+) ([]models.MergeCandidate, error) {
+	return s.repo.Candidates(ctx, status, limit)
+}
+
+// Approve merges the person of a pending candidate into its match and
+// returns the merged person
+func (s *service) Approve(
+	ctx context.Context,
+	id int64,
+) (models.Person, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Person{}, fmt.Errorf("failed to begin merge: %w", err)
+	}
+	defer tx.Rollback()
+
+	repo := repository.NewIdentityRepo(tx)
+
+	c, err := s.lockPending(ctx, repo, id)
+	if err != nil {
+		return models.Person{}, err
+	}
+
+	moved, err := repo.MergePersons(ctx, c.PersonID, c.MatchPersonID)
+	if err != nil {
+		return models.Person{}, err
+	}
+	if err := repo.SetCandidateStatus(ctx, id, constants.CandidateApproved); err != nil {
+		return models.Person{}, fmt.Errorf("failed to approve candidate: %w", err)
+	}
+
+	person, err := repo.Person(ctx, c.MatchPersonID)
+	if err != nil {
+		return models.Person{}, fmt.Errorf("failed to read merged person: %w", err)
+	}
+	if err := s.open(&person); err != nil {
+		return models.Person{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.Person{}, fmt.Errorf("failed to commit merge: %w", err)
+	}
+
+	s.log.Info("persons merged",
+		zap.Int64("candidate_id", id),
+		zap.Int64("from", c.PersonID),
+		zap.Int64("into", c.MatchPersonID),
+		zap.Int64("customers_moved", moved))
+	return person, nil
+}
+
+func (s *service) Reject(
+	ctx context.Context,
+	id int64,
+) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin reject: %w", err)
+	}
+	defer tx.Rollback()
+
+	repo := repository.NewIdentityRepo(tx)
+
+	if _, err := s.lockPending(ctx, repo, id); err != nil {
+		return err
+	}
+	if err := repo.SetCandidateStatus(ctx, id, constants.CandidateRejected); err != nil {
+		return fmt.Errorf("failed to reject candidate: %w", err)
+	}
+	return tx.Commit()
+}
+
+// lockPending locks a candidate that still awaits a decision
+func (s *service) lockPending(
+	ctx context.Context,
+	repo repository.IdentityRepository,
+	id int64,
+) (models.MergeCandidate, error) {
+	c, err := repo.LockCandidate(ctx, id)
+	if err == sql.ErrNoRows {
+		return c, ErrCandidateNotFound
+	}
+	if err != nil {
+		return c, fmt.Errorf("failed to lock candidate: %w", err)
+	}
+	if c.Status != constants.CandidatePending {
+		return c, ErrNotPending
+	}
+	return c, nil
+}
+
+func (s *service) Person(
+	ctx context.Context,
+	id int64,
+) (models.Person, error) {
+	p, err := s.repo.Person(ctx, id)
+	if err == sql.ErrNoRows {
+		return p, ErrPersonNotFound
+	}
+	if err != nil {
+		return p, err
+	}
+	return p, s.open(&p)
+}
+
+// open decrypts the email and address of a person
+func (s *service) open(p *models.Person) error {
+	var err error
+	if p.Email, err = s.keys.Decrypt(p.Email); err != nil {
+		return fmt.Errorf("failed to decrypt person email: %w", err)
+	}
+	if p.Address, err = s.keys.Decrypt(p.Address); err != nil {
+		return fmt.Errorf("failed to decrypt person address: %w", err)
+	}
+	return nil
+}
@@ -4,9 +4,12 @@ import (
 	"bufio"
 	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
@@ -17,8 +20,18 @@ const (
 	readerBuf = 8 << 20 // 8MB buffer for CSV reading for better performance
 )
 
-// readCSV reads CSV data and sends rows to the worker pool
-func (s *service) readCSV(ctx context.Context, r io.Reader, rows chan<- []string, jobID string) int {
+// csvRow is a record together with the line it starts on in the source
+type csvRow struct {
+	line   int
+	fields []string
+	// values of the optional currency and type columns
+	currency string
+	kind     string
+}
+
+// readCSV reads CSV data and sends rows to the worker pool. It returns an
+// error only when the input cannot be read at all.
+func (s *service) readCSV(ctx context.Context, r io.Reader, rows chan<- csvRow, dates *dateParser, jobID string, stats *jobStats) (int, error) {
 	// use buffered reader for better performance
 	bufReader := bufio.NewReaderSize(r, readerBuf)
 	csvReader := csv.NewReader(bufReader)
@@ -34,12 +47,50 @@ func (s *service) readCSV(ctx context.Context, r io.Reader, rows chan<- []string
 	lastBatchTime := startTime
 	batchSize := 10000
 
-	// Read and discard header row
-	_, err := csvReader.Read()
+	// the fixed columns are positional, the header only locates the
+	// optional currency and type columns
+	header, err := csvReader.Read()
 	if err != nil {
 		s.log.Error("failed to read csv header", zap.Error(err))
-		s.jobRepo.SetFailed(ctx, jobID, fmt.Sprintf("failed to read csv header: %s", err))
-		return 0
+		return 0, fmt.Errorf("failed to read csv header: %w", err)
+	}
+	currencyCol, kindCol := -1, -1
+	for i, name := range header {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "currency":
+			currencyCol = i
+		case "type":
+			kindCol = i
+		}
+	}
+
+	// without configured formats the first rows are held back until the
+	// date format is detected from them
+	var sample []csvRow
+	detect := func() {
+		dateSamples := make([]string, 0, len(sample))
+		for _, row := range sample {
+			if dateCol < len(row.fields) && row.fields[dateCol] != "" {
+				dateSamples = append(dateSamples, row.fields[dateCol])
+			}
+		}
+		if err := dates.detect(dateSamples); err != nil {
+			s.log.Warn("date format detection",
+				zap.String("job_id", jobID),
+				zap.Error(err))
+			s.warn(jobID, 0, err)
+		}
+	}
+	flush := func() bool {
+		for _, row := range sample {
+			select {
+			case rows <- row:
+			case <-ctx.Done():
+				return false
+			}
+		}
+		sample = nil
+		return true
 	}
 
 	// read all rows and send to worker pool
@@ -47,7 +98,7 @@ func (s *service) readCSV(ctx context.Context, r io.Reader, rows chan<- []string
 		// check if context was canceled
 		select {
 		case <-ctx.Done():
-			return rowCount
+			return rowCount, nil
 		default: // continue reading
 		}
 
@@ -55,28 +106,61 @@ func (s *service) readCSV(ctx context.Context, r io.Reader, rows chan<- []string
 		if err == io.EOF {
 			break
 		}
+		var parseErr *csv.ParseError
+		if err != nil && !errors.As(err, &parseErr) {
+			// the input itself failed (connection dropped, size limit hit),
+			// retrying would see the same error forever
+			s.log.Error("failed to read csv input",
+				zap.String("job_id", jobID),
+				zap.Error(err),
+				zap.Int("rows_read", rowCount))
+			return rowCount, fmt.Errorf("failed to read csv after %d rows: %w", rowCount, err)
+		}
 		if err != nil {
 			parseErrors++
 			s.log.Warn("error reading csv line",
 				zap.String("job_id", jobID),
 				zap.Error(err),
-				zap.Int("line", rowCount+1))
+				zap.Int("line", parseErr.Line))
+			s.warn(jobID, parseErr.Line, err)
 			continue
 		}
 
 		rowCount++
+		atomic.AddInt64(&stats.rows, 1)
 
 		// create a copy of the record to avoid race conditions
 		// when csv reader reuses the underlying slice
 		recordCopy := make([]string, len(record))
 		copy(recordCopy, record)
 
+		row := csvRow{fields: recordCopy}
+		row.line, _ = csvReader.FieldPos(0)
+		if currencyCol >= 0 && currencyCol < len(recordCopy) {
+			row.currency = recordCopy[currencyCol]
+		}
+		if kindCol >= 0 && kindCol < len(recordCopy) {
+			row.kind = recordCopy[kindCol]
+		}
+
+		if dates.needsDetection() {
+			sample = append(sample, row)
+			if len(sample) < dates.detectRows {
+				continue
+			}
+			detect()
+			if !flush() {
+				return rowCount, nil
+			}
+			continue
+		}
+
 		// send to worker pool with backpressure
 		select {
-		case rows <- recordCopy:
+		case rows <- row:
 			// row sent to channel
 		case <-ctx.Done():
-			return rowCount
+			return rowCount, nil
 		}
 
 		// log progress periodically or after batch
@@ -119,6 +203,14 @@ func (s *service) readCSV(ctx context.Context, r io.Reader, rows chan<- []string
 		}
 	}
 
+	// files shorter than the sample
+	if len(sample) > 0 {
+		detect()
+		if !flush() {
+			return rowCount, nil
+		}
+	}
+
 	duration := time.Since(startTime)
 	rowsPerSecond := float64(rowCount) / duration.Seconds()
 
@@ -130,11 +222,36 @@ func (s *service) readCSV(ctx context.Context, r io.Reader, rows chan<- []string
 		zap.Float64("rows_per_second", rowsPerSecond),
 		zap.Int("buffer_size", readerBuf))
 
-	return rowCount
+	return rowCount, nil
+}
+
+// positions of the customer columns, which are kept out of logs
+const (
+	customerIDCol = 2
+	nameCol       = 12
+	emailCol      = 13
+	addressCol    = 14
+)
+
+// piiCols identify or describe a customer; the ID counts too, as it names
+// erased customers
+var piiCols = []int{customerIDCol, nameCol, emailCol, addressCol}
+
+// redact returns a copy of a record with the personal data masked, for
+// logging
+func redact(rec []string) []string {
+	out := make([]string, len(rec))
+	copy(out, rec)
+	for _, i := range piiCols {
+		if i < len(out) && out[i] != "" {
+			out[i] = "[redacted]"
+		}
+	}
+	return out
 }
 
 // parseRow converts a CSV row into structured data
-func parseRow(rec []string) (Sale, error) {
+func parseRow(rec []string, dates *dateParser) (Sale, error) {
 	var s Sale
 
 	if len(rec) < 15 {
@@ -144,14 +261,14 @@ func parseRow(rec []string) (Sale, error) {
 	// extract basic identifiers - use direct indexing for performance
 	s.OrderID = rec[0]
 	s.ProductID = rec[1]
-	s.CustomerID = rec[2]
+	s.CustomerID = rec[customerIDCol]
 
 	s.ProductName = rec[3]
 	s.ProductCategory = rec[4]
 	s.Region = rec[5]
-	s.CustomerName = rec[12]
-	s.CustomerEmail = rec[13]
-	s.CustomerAddress = rec[14]
+	s.CustomerName = rec[nameCol]
+	s.CustomerEmail = rec[emailCol]
+	s.CustomerAddress = rec[addressCol]
 
 	// parse numeric values
 	qty, err := strconv.Atoi(rec[7])
@@ -179,11 +296,12 @@ func parseRow(rec []string) (Sale, error) {
 	s.Shipping = shipping
 
 	// parse date - this is typically the slowest operation
-	date, err := time.Parse("2006-01-02", rec[6])
+	date, at, err := dates.parse(rec[dateCol])
 	if err != nil {
-		return s, fmt.Errorf("invalid date: %w", err)
+		return s, err
 	}
 	s.OrderDate = date
+	s.OrderedAt = at
 
 	s.OrderTotal = float64(s.Quantity)*s.Price*(1-s.Discount) + s.Shipping
 
@@ -0,0 +1,250 @@
+package ingestion
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"sales-analytics/config"
+)
+
+const (
+	// dateCol is the position of the order date
+	dateCol = 6
+
+	defaultDetectRows = 100
+	isoFormat         = "ISO8601"
+)
+
+// detectFormats are tried on the first rows of sources without configured
+// formats. Where a date reads both ways month-first wins for slashes and
+// day-first for dots and dashes, as usual in the exports we get.
+var detectFormats = []string{
+	"YYYY-MM-DD",
+	isoFormat,
+	"YYYY-MM-DDTHH:mm:ss",
+	"YYYY-MM-DD HH:mm:ss",
+	"YYYY-MM-DD HH:mm",
+	"YYYY/MM/DD",
+	"MM/DD/YYYY",
+	"DD/MM/YYYY",
+	"MM/DD/YYYY HH:mm:ss",
+	"DD/MM/YYYY HH:mm:ss",
+	"MM/DD/YYYY HH:mm",
+	"DD/MM/YYYY HH:mm",
+	"DD.MM.YYYY",
+	"DD.MM.YYYY HH:mm:ss",
+	"DD.MM.YYYY HH:mm",
+	"DD-MM-YYYY",
+}
+
+// dateFormat is a format as configured and the Go layout it parses with
+type dateFormat struct {
+	name   string
+	layout string
+	// clock is set for formats with a time of day, which are converted to
+	// the reporting time zone
+	clock bool
+}
+
+// compileFormat turns YYYY, MM, DD, HH, mm and ss into a Go layout. Month
+// and day accept one or two digits.
+func compileFormat(name string) (dateFormat, error) {
+	if strings.EqualFold(name, isoFormat) || strings.EqualFold(name, "RFC3339") {
+		return dateFormat{name: isoFormat, layout: time.RFC3339, clock: true}, nil
+	}
+
+	for _, token := range []string{"YYYY", "MM", "DD"} {
+		if !strings.Contains(name, token) {
+			return dateFormat{}, fmt.Errorf("date format %q needs YYYY, MM and DD", name)
+		}
+	}
+
+	layout := strings.NewReplacer(
+		"YYYY", "2006",
+		"MM", "1",
+		"DD", "2",
+		"HH", "15",
+		"mm", "04",
+		"ss", "05",
+	).Replace(name)
+	return dateFormat{name: name, layout: layout, clock: strings.Contains(layout, "15")}, nil
+}
+
+func compileFormats(names []string) ([]dateFormat, error) {
+	formats := make([]dateFormat, 0, len(names))
+	for _, name := range names {
+		f, err := compileFormat(name)
+		if err != nil {
+			return nil, err
+		}
+		formats = append(formats, f)
+	}
+	return formats, nil
+}
+
+// dateRules are the formats and time zone of a source; no formats means
+// detect them
+type dateRules struct {
+	formats []dateFormat
+	zone    *time.Location
+}
+
+type dateSource struct {
+	match string
+	rules dateRules
+}
+
+// dateConfig is the compiled config.Dates
+type dateConfig struct {
+	defaults   dateRules
+	sources    []dateSource
+	reporting  *time.Location
+	detectRows int
+}
+
+func newDateConfig(cfg config.Dates) (dateConfig, error) {
+	dc := dateConfig{detectRows: cfg.DetectRows}
+	if dc.detectRows <= 0 {
+		dc.detectRows = defaultDetectRows
+	}
+
+	var err error
+	if dc.reporting, err = loadZone(cfg.ReportingTimezone); err != nil {
+		return dc, err
+	}
+	if dc.defaults, err = newDateRules(cfg.Formats, cfg.Timezone); err != nil {
+		return dc, err
+	}
+
+	for _, src := range cfg.Sources {
+		if src.Match == "" {
+			return dc, errors.New("date source needs a match")
+		}
+		formats, zone := src.Formats, src.Timezone
+		if len(formats) == 0 {
+			formats = cfg.Formats
+		}
+		if zone == "" {
+			zone = cfg.Timezone
+		}
+		rules, err := newDateRules(formats, zone)
+		if err != nil {
+			return dc, fmt.Errorf("date source %q: %w", src.Match, err)
+		}
+		dc.sources = append(dc.sources, dateSource{match: src.Match, rules: rules})
+	}
+	return dc, nil
+}
+
+func newDateRules(formats []string, zone string) (dateRules, error) {
+	var r dateRules
+	var err error
+	if r.formats, err = compileFormats(formats); err != nil {
+		return r, err
+	}
+	r.zone, err = loadZone(zone)
+	return r, err
+}
+
+// loadZone loads an IANA time zone, UTC when empty
+func loadZone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+// parser returns the date parser of a source, the first configured source
+// its path or URL starts with decides. Uploads have no source.
+func (dc dateConfig) parser(source string) *dateParser {
+	rules := dc.defaults
+	for _, src := range dc.sources {
+		if source != "" && strings.HasPrefix(source, src.match) {
+			rules = src.rules
+			break
+		}
+	}
+	return &dateParser{
+		formats:    rules.formats,
+		zone:       rules.zone,
+		reporting:  dc.reporting,
+		detectRows: dc.detectRows,
+	}
+}
+
+// dateParser parses the order dates of one job. Without formats the reader
+// detects them before handing out the first row, workers only read it.
+type dateParser struct {
+	formats    []dateFormat
+	zone       *time.Location
+	reporting  *time.Location
+	detectRows int
+}
+
+func (p *dateParser) needsDetection() bool {
+	return len(p.formats) == 0
+}
+
+// parse returns the order date in the reporting time zone and, for values
+// with a time of day, the instant of the order. The date is midnight UTC of
+// that day, which is how dates are stored.
+func (p *dateParser) parse(value string) (time.Time, *time.Time, error) {
+	for _, f := range p.formats {
+		t, err := time.ParseInLocation(f.layout, value, p.zone)
+		if err != nil {
+			continue
+		}
+		if f.clock {
+			t = t.In(p.reporting)
+			at := t
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), &at, nil
+		}
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil, nil
+	}
+	return time.Time{}, nil, fmt.Errorf("invalid date: %q", value)
+}
+
+// detect picks the format that reads the most sample dates. It returns an
+// error describing a doubtful choice, which does not stop the job.
+func (p *dateParser) detect(samples []string) error {
+	candidates, _ := compileFormats(detectFormats)
+
+	var best dateFormat
+	var ties []string
+	bestN := 0
+	for _, f := range candidates {
+		n := 0
+		for _, v := range samples {
+			if _, err := time.Parse(f.layout, v); err == nil {
+				n++
+			}
+		}
+		switch {
+		case n > bestN:
+			best, bestN, ties = f, n, nil
+		case n == bestN && n > 0:
+			ties = append(ties, f.name)
+		}
+	}
+
+	if bestN == 0 {
+		// let every row try every format
+		p.formats = candidates
+		return errors.New("could not detect the date format, trying all known formats per row")
+	}
+
+	p.formats = []dateFormat{best}
+	switch {
+	case bestN < len(samples):
+		return fmt.Errorf("detected date format %s, which reads %d of %d sampled dates", best.name, bestN, len(samples))
+	case len(ties) > 0:
+		return fmt.Errorf("date format is ambiguous, using %s over %s", best.name, strings.Join(ties, ", "))
+	}
+	return nil
+}
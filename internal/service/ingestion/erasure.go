@@ -0,0 +1,50 @@
+package ingestion
+
+import (
+	"context"
+
+	"sales-analytics/internal/repository"
+	"sales-analytics/internal/service/privacy"
+	"sales-analytics/pkg/pii"
+)
+
+// erasures are the customers erased on request, by subject hash
+type erasures struct {
+	keys         *pii.Keyring
+	replacements map[string]string
+}
+
+// loadErasures reads the erased customers and recreates the replacement
+// customers their orders belong to, in case an overwrite truncated them
+func (s *service) loadErasures(ctx context.Context) (*erasures, error) {
+	repo := repository.NewPrivacyRepo(s.db)
+
+	replacements, err := repo.ErasedSubjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(replacements) > 0 {
+		if err := repo.RestoreReplacements(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return &erasures{keys: s.keys, replacements: replacements}, nil
+}
+
+// replace gives a sale of an erased customer to its replacement and drops
+// its personal data, reporting whether it did
+func (e *erasures) replace(sale *Sale) bool {
+	if len(e.replacements) == 0 {
+		return false
+	}
+
+	replacement, ok := e.replacements[privacy.Subject(e.keys, sale.CustomerID)]
+	if !ok {
+		return false
+	}
+	sale.CustomerID = replacement
+	sale.CustomerName = ""
+	sale.CustomerEmail = ""
+	sale.CustomerAddress = ""
+	return true
+}
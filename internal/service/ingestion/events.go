@@ -0,0 +1,129 @@
+package ingestion
+
+import (
+	"sync"
+
+	"sales-analytics/internal/models"
+)
+
+// event types streamed to job subscribers
+const (
+	EventProgress = "progress"
+	EventPhase    = "phase"
+	EventWarning  = "warning"
+	EventResult   = "result"
+)
+
+// job phases reported through EventPhase
+const (
+	PhasePreparing  = "preparing"
+	PhaseTruncating = "truncating"
+	PhaseLoading    = "loading"
+	PhaseFinalizing = "finalizing"
+)
+
+// subscriberBuffer is how many events a slow subscriber may lag behind
+// before intermediate events are dropped for it
+const subscriberBuffer = 64
+
+// Event is a single notification about a running job
+type Event struct {
+	Type string
+	Data any
+}
+
+type Progress struct {
+	JobID         string  `json:"job_id"`
+	RowsRead      int64   `json:"rows_read"`
+	Processed     int64   `json:"processed_rows"`
+	Failed        int64   `json:"failed_rows"`
+	Customers     int64   `json:"customers"`
+	Products      int64   `json:"products"`
+	Orders        int64   `json:"orders"`
+	Items         int64   `json:"items"`
+	RowsPerSecond float64 `json:"rows_per_second"`
+	ElapsedMs     int64   `json:"elapsed_ms"`
+}
+
+type Phase struct {
+	JobID string `json:"job_id"`
+	Phase string `json:"phase"`
+}
+
+type Warning struct {
+	JobID   string `json:"job_id"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// broker is an in-process pub/sub of job events keyed by job id
+type broker struct {
+	mu   sync.Mutex
+	subs map[string]map[chan Event]struct{}
+}
+
+func newBroker() *broker {
+	return &broker{subs: make(map[string]map[chan Event]struct{})}
+}
+
+// subscribe registers a listener for jobID. The returned channel is closed
+// after the result event or when the returned cancel func is called.
+func (b *broker) subscribe(jobID string) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subs[jobID] == nil {
+		b.subs[jobID] = make(map[chan Event]struct{})
+	}
+	b.subs[jobID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if _, ok := b.subs[jobID][ch]; ok {
+				delete(b.subs[jobID], ch)
+				if len(b.subs[jobID]) == 0 {
+					delete(b.subs, jobID)
+				}
+				close(ch)
+			}
+		})
+	}
+}
+
+// publish fans e out to every subscriber of jobID without blocking;
+// subscribers that are too far behind miss the event
+func (b *broker) publish(jobID string, e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs[jobID] {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// finish delivers the result to every subscriber and closes their
+// channels. The result is always delivered, dropping the oldest queued
+// event of a full subscriber if needed.
+func (b *broker) finish(jobID string, r models.JobResult) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e := Event{Type: EventResult, Data: r}
+	for ch := range b.subs[jobID] {
+		select {
+		case ch <- e:
+		default:
+			<-ch
+			ch <- e
+		}
+		close(ch)
+	}
+	delete(b.subs, jobID)
+}
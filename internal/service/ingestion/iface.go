@@ -9,7 +9,16 @@ import (
 type Service interface {
 	ImportFromPath(ctx context.Context, jobID, mode string) error
 
+	// ImportFromSource imports a local path or an s3://bucket/key object
+	ImportFromSource(ctx context.Context, source, jobID, mode string) error
+
 	ImportFile(ctx context.Context, r io.Reader, jobID, mode string) error
 
 	GetJobStatus(ctx context.Context, jobID string) (models.IngestionJob, error)
+
+	// Rollback reverts the rows written by a finished append job
+	Rollback(ctx context.Context, jobID string) (models.RollbackResult, error)
+
+	// Subscribe streams progress, phase, warning and result events of a job
+	Subscribe(jobID string) (<-chan Event, func())
 }
@@ -1,6 +1,10 @@
 package ingestion
 
 import (
+	"crypto/sha256"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"sales-analytics/internal/models"
@@ -12,8 +16,10 @@ type Sale struct {
 	ProductID  string
 	CustomerID string
 
-	// order info
+	// order info; OrderDate is the day in the reporting time zone, OrderedAt
+	// the instant when the source gives a time of day
 	OrderDate  time.Time
+	OrderedAt  *time.Time
 	OrderTotal float64
 
 	// product info
@@ -31,6 +37,18 @@ type Sale struct {
 	Quantity int
 	Discount float64
 	Shipping float64
+
+	// Currency of the amounts above; FXRate converts them to the base
+	// currency, 0 while no rate is known
+	Currency string
+	FXRate   float64
+
+	// Kind is empty for a sale, or a return kind when the row gives back
+	// part of an earlier sale
+	Kind string
+
+	// where the row came from, stamped on everything written from it
+	Lineage models.Lineage
 }
 
 // ToCustomer converts sale data to a Customer model
@@ -41,6 +59,8 @@ func (s Sale) ToCustomer() models.Customer {
 		Email:   s.CustomerEmail,
 		Region:  s.Region,
 		Address: s.CustomerAddress,
+		AsOf:    s.OrderDate,
+		Lineage: s.Lineage,
 	}
 }
 
@@ -51,7 +71,80 @@ func (s Sale) ToProduct() models.Product {
 		Name:      s.ProductName,
 		Category:  s.ProductCategory,
 		UnitPrice: s.Price,
+		AsOf:      s.OrderDate,
+		Lineage:   s.Lineage,
+	}
+}
+
+// attrDigest fingerprints the attributes of a customer or product, so
+// workers can spot changes without keeping personal data in memory
+type attrDigest [sha256.Size]byte
+
+func digest(fields ...string) attrDigest {
+	return sha256.Sum256([]byte(strings.Join(fields, "\x00")))
+}
+
+// attrSighting is a digest of attributes and the day they were read on
+type attrSighting struct {
+	digest attrDigest
+	date   time.Time
+}
+
+// sighting returns the sighting of d on the day of t, the precision the
+// history is kept at
+func sighting(d attrDigest, t time.Time) attrSighting {
+	return attrSighting{d, time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)}
+}
+
+// sightings are the attribute sightings already sent to the history per
+// customer or product. Any other sighting is sent, even a repeat of older
+// attributes: the history orders and collapses them by date, a worker
+// cannot tell from its own rows which ones change it.
+type sightings map[string]map[attrSighting]bool
+
+func (s sightings) sent(id string, a attrSighting) bool {
+	return s[id][a]
+}
+
+func (s sightings) add(id string, a attrSighting) {
+	seen, ok := s[id]
+	if !ok {
+		seen = make(map[attrSighting]bool)
+		s[id] = seen
+	}
+	seen[a] = true
+}
+
+func (s Sale) customerDigest() attrDigest {
+	return digest(s.CustomerName, s.CustomerEmail, s.Region, s.CustomerAddress)
+}
+
+func (s Sale) productDigest() attrDigest {
+	return digest(s.ProductName, s.ProductCategory, strconv.FormatFloat(s.Price, 'f', 2, 64))
+}
+
+// ToReturn converts a return or refund row to a Return; the quantity and
+// amounts of the row may be given with either sign
+func (s Sale) ToReturn() models.Return {
+	qty := abs(s.Quantity)
+	return models.Return{
+		OrderID:   s.OrderID,
+		ProductID: s.ProductID,
+		Kind:      s.Kind,
+		Date:      s.OrderDate,
+		Quantity:  qty,
+		Amount:    float64(qty)*math.Abs(s.Price)*(1-s.Discount) + math.Abs(s.Shipping),
+		Currency:  s.Currency,
+		FXRate:    s.FXRate,
+		Lineage:   s.Lineage,
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
 	}
+	return n
 }
 
 // EntityType represents different entity types for batching
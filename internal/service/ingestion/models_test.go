@@ -0,0 +1,61 @@
+package ingestion
+
+import (
+	"testing"
+	"time"
+)
+
+// TestHistorySightings checks which rows of one customer a worker sends to
+// the history: every pair of attributes and day not sent yet, in any order
+func TestHistorySightings(t *testing.T) {
+	date := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02 15:04", s)
+		return d
+	}
+	type row struct {
+		region string
+		date   string
+		sent   bool
+	}
+	tests := []struct {
+		name string
+		rows []row
+	}{
+		{
+			name: "repeats and out of order rows",
+			rows: []row{
+				{"north", "2024-03-01 09:00", true},
+				{"north", "2024-03-01 17:30", false}, // same day
+				{"north", "2024-01-10 09:00", true},  // out of order, moves the start earlier
+				{"south", "2024-02-01 09:00", true},
+				{"south", "2024-02-01 09:00", false},
+				{"north", "2024-04-01 09:00", true},
+			},
+		},
+		{
+			// the history must learn north is back on 03-15, or orders from
+			// then on are credited to south
+			name: "older attributes again after a change",
+			rows: []row{
+				{"south", "2024-03-10 09:00", true},
+				{"north", "2024-03-01 09:00", true},
+				{"north", "2024-03-15 09:00", true},
+				{"south", "2024-03-10 12:00", false},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent := make(sightings)
+			for i, r := range tt.rows {
+				sale := Sale{CustomerName: "Ann", Region: r.region, OrderDate: date(r.date)}
+				seen := sighting(sale.customerDigest(), sale.OrderDate)
+				if got := !sent.sent("C1", seen); got != r.sent {
+					t.Errorf("row %d (%s on %s): sent = %v, want %v", i, r.region, r.date, got, r.sent)
+				}
+				sent.add("C1", seen)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package ingestion
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"sales-analytics/internal/constants"
+	"sales-analytics/internal/models"
+	"sales-analytics/internal/repository"
+
+	"go.uber.org/zap"
+)
+
+// returnBuffer collects the returns of a job. They are applied once every
+// sale of the job is stored, so a return can be checked against its sale
+// wherever both are in the file.
+type returnBuffer struct {
+	mu   sync.Mutex
+	rows []models.Return
+}
+
+func (b *returnBuffer) add(r models.Return) {
+	b.mu.Lock()
+	b.rows = append(b.rows, r)
+	b.mu.Unlock()
+}
+
+// classify sets the kind of a row from the optional type column; rows
+// without one are sales, or returns when their quantity is negative
+func classify(sale *Sale, kind string) error {
+	switch strings.ToLower(strings.TrimSpace(kind)) {
+	case "", "sale":
+		if sale.Quantity < 0 {
+			sale.Kind = constants.ReturnKindReturn
+		}
+		return nil
+	case constants.ReturnKindReturn:
+		sale.Kind = constants.ReturnKindReturn
+	case constants.ReturnKindRefund:
+		sale.Kind = constants.ReturnKindRefund
+	default:
+		return fmt.Errorf("invalid type: %q", kind)
+	}
+
+	if sale.Quantity == 0 {
+		return fmt.Errorf("%s quantity must not be zero", sale.Kind)
+	}
+	return nil
+}
+
+// applyReturns stores the returns of a job in one transaction. A return
+// for an order item that does not exist, or for more units than are left
+// of it, is rejected with a warning and counted as failed. Returns stored
+// without an fx rate are counted as unconverted and reported in a warning.
+func (s *service) applyReturns(
+	ctx context.Context,
+	jobID string,
+	returns []models.Return,
+	stats *jobStats,
+) error {
+	if len(returns) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin returns transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	repo := repository.NewReturnRepo(tx)
+	reject := func(r models.Return, format string, args ...any) {
+		atomic.AddInt64(&stats.failed, 1)
+		err := fmt.Errorf(format, args...)
+		s.log.Warn("return rejected",
+			zap.String("job_id", jobID),
+			zap.Int("line", r.SourceLine),
+			zap.Error(err))
+		s.warn(jobID, r.SourceLine, err)
+	}
+
+	var unconverted int64
+	for _, r := range returns {
+		sold, returned, duplicate, err := repo.Balance(ctx, r)
+		if err != nil {
+			return fmt.Errorf("failed to check return: %w", err)
+		}
+		switch {
+		case duplicate:
+			// already loaded by an earlier job
+			continue
+		case sold < 0:
+			reject(r, "%s for unknown order item %s/%s", r.Kind, r.OrderID, r.ProductID)
+			continue
+		case returned+r.Quantity > sold:
+			reject(r, "%s of %d exceeds the %d units left of order item %s/%s",
+				r.Kind, r.Quantity, sold-returned, r.OrderID, r.ProductID)
+			continue
+		}
+
+		if err := repo.Insert(ctx, r); err != nil {
+			return fmt.Errorf("failed to insert return: %w", err)
+		}
+		atomic.AddInt64(&stats.returns, 1)
+		if r.FXRate == 0 {
+			unconverted++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit returns: %w", err)
+	}
+
+	if unconverted > 0 {
+		atomic.AddInt64(&stats.unconverted, unconverted)
+		s.warn(jobID, 0, fmt.Errorf("%d returns stored without fx rate, left out of returns totals until rates are loaded", unconverted))
+	}
+	return nil
+}
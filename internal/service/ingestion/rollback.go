@@ -0,0 +1,97 @@
+package ingestion
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"sales-analytics/internal/constants"
+	"sales-analytics/internal/models"
+	"sales-analytics/internal/repository"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrJobNotFound       = errors.New("job not found")
+	ErrJobRunning        = errors.New("job is still running")
+	ErrAlreadyRolledBack = errors.New("job already rolled back")
+	// ErrNotReversible is returned for overwrite jobs, the truncated data
+	// is not kept
+	ErrNotReversible = errors.New("overwrite jobs cannot be rolled back")
+	// ErrHistoryBusy is returned when jobs kept the history locked for
+	// longer than a rollback waits
+	ErrHistoryBusy = errors.New("history is being written by another job, try again later")
+)
+
+// historyLocks are the locks of the history tables a rollback reverts
+var historyLocks = []string{"customer_history", "product_history"}
+
+// Rollback reverts the rows a finished append job inserted or updated in a
+// single transaction and marks the job rolled_back
+func (s *service) Rollback(
+	ctx context.Context,
+	jobID string,
+) (models.RollbackResult, error) {
+	result := models.RollbackResult{JobID: jobID}
+
+	// history locks are held by the session, taken in the order workers
+	// take them, so reverting versions never interleaves with resequencing
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return result, fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+	for _, table := range historyLocks {
+		err := repository.Lock(ctx, conn, table, historyLockTimeout)
+		if errors.Is(err, repository.ErrLockTimeout) {
+			return result, ErrHistoryBusy
+		}
+		if err != nil {
+			return result, err
+		}
+		defer repository.Unlock(context.Background(), conn, table)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return result, fmt.Errorf("failed to begin rollback: %w", err)
+	}
+	defer tx.Rollback()
+
+	repo := repository.NewLineageRepo(tx)
+
+	job, err := repo.LockJob(ctx, jobID)
+	if err == sql.ErrNoRows {
+		return result, ErrJobNotFound
+	}
+	if err != nil {
+		return result, fmt.Errorf("failed to lock job: %w", err)
+	}
+
+	switch {
+	case job.Status == constants.StatusRunning:
+		return result, ErrJobRunning
+	case job.Status == constants.StatusRolledBack:
+		return result, ErrAlreadyRolledBack
+	case job.Mode == constants.ModeOverwrite:
+		return result, ErrNotReversible
+	}
+
+	result.Tables, err = repo.Revert(ctx, jobID)
+	if err != nil {
+		return result, err
+	}
+	if err := repo.SetRolledBack(ctx, jobID); err != nil {
+		return result, fmt.Errorf("failed to mark job rolled back: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("failed to commit rollback: %w", err)
+	}
+
+	s.log.Info("job rolled back",
+		zap.String("job_id", jobID),
+		zap.Any("tables", result.Tables))
+	return result, nil
+}
@@ -3,6 +3,7 @@ package ingestion
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"io"
 	"os"
@@ -11,9 +12,13 @@ import (
 	"sync/atomic"
 	"time"
 
+	"sales-analytics/config"
 	"sales-analytics/internal/constants"
 	"sales-analytics/internal/models"
 	"sales-analytics/internal/repository"
+	"sales-analytics/internal/service/fx"
+	"sales-analytics/pkg/pii"
+	"sales-analytics/pkg/s3"
 
 	"go.uber.org/zap"
 )
@@ -23,16 +28,40 @@ const (
 	defaultBatchSize  = 2000  // increased from 500 to 2000
 	defaultBufferSize = 50000 // increased channel buffer for better throughput
 	defaultWorkers    = 0     // 0 means use NumCPU()
-	maxDBConnections  = 30    // increased from 20 to 30
 	minBatchSize      = 100   // minimum batch size for very small datasets
 	maxBatchSize      = 5000  // increased max batch size for better performance
 )
 
+// DB is the connection pool reserved for ingestion. Workers pin their own
+// connections from it, so bulk-load session settings never reach the pool
+// that serves analytics queries.
+type DB struct{ *sql.DB }
+
+// Notifier is told about every job that reaches a final state
+type Notifier interface {
+	Notify(ctx context.Context, r models.JobResult)
+}
+
+// Resolver links the customers a job brought in to persons
+type Resolver interface {
+	// Schedule starts linking in the background
+	Schedule()
+}
+
 type service struct {
-	db      *sql.DB
-	jobRepo repository.JobRepository
-	log     *zap.Logger
-	csvPath string
+	db       *sql.DB
+	jobRepo  repository.JobRepository
+	notifier Notifier
+	resolver Resolver
+	fx       fx.Service
+	keys     *pii.Keyring
+	s3       *s3.Client
+	log      *zap.Logger
+	csvPath  string
+	dates    dateConfig
+
+	// live job events for subscribers
+	events *broker
 
 	// processing options
 	batchSize  int
@@ -41,51 +70,91 @@ type service struct {
 }
 
 func New(
-	db *sql.DB,
+	db DB,
 	jobRepo repository.JobRepository,
+	notifier Notifier,
+	resolver Resolver,
+	fxSvc fx.Service,
+	keys *pii.Keyring,
+	s3Client *s3.Client,
 	log *zap.Logger,
 	csvPath string,
-) Service {
-	db.SetMaxOpenConns(maxDBConnections)
-	db.SetMaxIdleConns(maxDBConnections / 2)
-	db.SetConnMaxLifetime(time.Minute * 5)
+	dates config.Dates,
+) (Service, error) {
+	dc, err := newDateConfig(dates)
+	if err != nil {
+		return nil, err
+	}
 
 	return &service{
-		db:         db,
+		db:         db.DB,
 		jobRepo:    jobRepo,
+		notifier:   notifier,
+		resolver:   resolver,
+		fx:         fxSvc,
+		keys:       keys,
+		s3:         s3Client,
 		log:        log,
 		csvPath:    csvPath,
+		dates:      dc,
+		events:     newBroker(),
 		batchSize:  defaultBatchSize,
 		bufferSize: defaultBufferSize,
 		workers:    defaultWorkers,
-	}
+	}, nil
 }
 
-// ImportFromPath imports a CSV file from the configured path
+// ImportFromPath imports a CSV file from the configured path, which may be
+// a local file or an s3://bucket/key URL
 func (s *service) ImportFromPath(
 	ctx context.Context,
 	jobID, mode string,
+) error {
+	return s.ImportFromSource(ctx, s.csvPath, jobID, mode)
+}
+
+// ImportFromSource imports a CSV from a local path or an s3://bucket/key
+// URL. Objects are streamed into the parser rather than downloaded first.
+func (s *service) ImportFromSource(
+	ctx context.Context,
+	source, jobID, mode string,
 ) error {
 	startTime := time.Now()
 	s.log.Info("starting import from path",
-		zap.String("path", s.csvPath),
+		zap.String("path", source),
 		zap.String("job_id", jobID),
 		zap.String("mode", mode))
 
-	file, err := os.Open(s.csvPath)
+	file, err := s.open(ctx, source)
 	if err != nil {
 		s.log.Error("failed to open csv file", zap.Error(err))
-		s.jobRepo.SetFailed(ctx, jobID, fmt.Sprintf("failed to open csv file: %s", err))
+		s.fail(ctx, jobID, fmt.Sprintf("failed to open csv file: %s", err))
 		return err
 	}
 	defer file.Close()
 
-	s.process(ctx, file, jobID, mode)
+	err = s.process(ctx, file, s.dates.parser(source), jobID, mode)
 
 	s.log.Info("import completed",
 		zap.String("job_id", jobID),
 		zap.Duration("total_duration", time.Since(startTime)))
-	return nil
+	return err
+}
+
+// open resolves a source to a reader
+func (s *service) open(
+	ctx context.Context,
+	source string,
+) (io.ReadCloser, error) {
+	if !s3.IsURL(source) {
+		return os.Open(source)
+	}
+
+	bucket, key, err := s3.ParseURL(source)
+	if err != nil {
+		return nil, err
+	}
+	return s.s3.Open(ctx, bucket, key)
 }
 
 // ImportFile imports a CSV from a reader (typically a multipart file upload)
@@ -99,45 +168,76 @@ func (s *service) ImportFile(
 		zap.String("job_id", jobID),
 		zap.String("mode", mode))
 
-	s.process(ctx, r, jobID, mode)
+	err := s.process(ctx, r, s.dates.parser(""), jobID, mode)
 
 	s.log.Info("import completed",
 		zap.String("job_id", jobID),
 		zap.Duration("total_duration", time.Since(startTime)))
-	return nil
+	return err
 }
 
-// process handles the ingestion workflow
+// progressInterval is how often progress is published to subscribers;
+// the job row is bumped every progressPersistEvery ticks
+const (
+	progressInterval     = 500 * time.Millisecond
+	progressPersistEvery = 4
+)
+
+// jobStats are the counters shared by the reader and workers of a job
+type jobStats struct {
+	rows      int64 // rows read from the csv
+	processed int64 // rows parsed and handed to the batches
+	failed    int64 // rows that could not be parsed
+	customers int64
+	products  int64
+	orders    int64
+	items     int64
+	returns   int64
+	// sale items and returns stored without an fx rate
+	unconverted int64
+	parseTime   int64
+	dbTime      int64
+}
+
+// process handles the ingestion workflow. The returned error is the reason
+// the job did not complete, it has already been recorded on the job.
 func (s *service) process(
 	ctx context.Context,
 	r io.Reader,
+	dates *dateParser,
 	jobID, mode string,
-) {
+) error {
 	start := time.Now()
 	s.log.Info(constants.LogIngestStart, zap.String("job_id", jobID), zap.String("mode", mode))
 
-	if err := s.optimizeDBForBulkLoad(ctx, jobID); err != nil {
-		return
-	}
-	defer s.restoreDBSettings(ctx, jobID)
-
 	if mode == "overwrite" {
+		s.phase(jobID, PhaseTruncating)
 		if err := s.truncateTables(ctx, jobID); err != nil {
-			return
+			return err
 		}
 	}
 
-	var stats struct {
-		rows      int64
-		customers int64
-		products  int64
-		orders    int64
-		items     int64
-		parseTime int64
-		dbTime    int64
+	s.phase(jobID, PhasePreparing)
+
+	rates, err := s.fx.Table(ctx)
+	if err != nil {
+		s.log.Error("failed to load fx rates", zap.String("job_id", jobID), zap.Error(err))
+		s.fail(ctx, jobID, fmt.Sprintf("failed to load fx rates: %s", err))
+		return err
+	}
+
+	erased, err := s.loadErasures(ctx)
+	if err != nil {
+		s.log.Error("failed to load erased customers", zap.String("job_id", jobID), zap.Error(err))
+		s.fail(ctx, jobID, fmt.Sprintf("failed to load erased customers: %s", err))
+		return err
 	}
 
+	var stats jobStats
+	var returns returnBuffer
+
 	// Choose optimal worker count based on cpu cores
+	maxConns := s.db.Stats().MaxOpenConnections
 	workerCount := s.workers
 	if workerCount <= 0 {
 		workerCount = runtime.NumCPU()
@@ -146,11 +246,11 @@ func (s *service) process(
 		if workerCount > 4 {
 			workerCount -= 1
 		}
+	}
 
-		maxWorkers := maxDBConnections / 3
-		if workerCount > maxWorkers {
-			workerCount = maxWorkers
-		}
+	// every worker pins a connection, keep one spare for truncates
+	if maxConns > 1 && workerCount > maxConns-1 {
+		workerCount = maxConns - 1
 	}
 
 	s.log.Info("starting csv ingestion with optimized settings",
@@ -158,26 +258,43 @@ func (s *service) process(
 		zap.Int("batch_size", s.batchSize),
 		zap.Int("buffer_size", s.bufferSize),
 		zap.Int("workers", workerCount),
-		zap.Int("max_db_connections", maxDBConnections))
+		zap.Int("max_db_connections", maxConns))
+
+	// acquire and prepare every worker connection up front so a failure
+	// aborts the job before any rows are read
+	conns := make([]*sql.Conn, 0, workerCount)
+	for i := 0; i < workerCount; i++ {
+		conn, err := s.openBulkConn(ctx, jobID)
+		if err != nil {
+			for _, c := range conns {
+				s.releaseBulkConn(ctx, c, jobID)
+			}
+			return err
+		}
+		conns = append(conns, conn)
+	}
 
-	rawRows := make(chan []string, s.bufferSize)
+	s.phase(jobID, PhaseLoading)
+
+	rawRows := make(chan csvRow, s.bufferSize)
 	done := make(chan struct{})
 
 	var wg sync.WaitGroup
 	wg.Add(workerCount)
 
-	for i := 0; i < workerCount; i++ {
-		go func(workerID int) {
+	for i, conn := range conns {
+		go func(workerID int, conn *sql.Conn) {
 			defer wg.Done()
-			s.worker(ctx, jobID, rawRows, &stats, workerID)
-		}(i + 1)
+			defer s.releaseBulkConn(ctx, conn, jobID)
+			s.worker(ctx, jobID, conn, rawRows, dates, rates, erased, &returns, &stats, workerID)
+		}(i+1, conn)
 	}
 
 	// Start csv reader in a goroutine
+	var readErr error
 	go func() {
 		defer close(rawRows) // signal workers when done
-		rowCount := s.readCSV(ctx, r, rawRows, jobID)
-		atomic.StoreInt64(&stats.rows, int64(rowCount))
+		_, readErr = s.readCSV(ctx, r, rawRows, dates, jobID, &stats)
 	}()
 
 	go func() {
@@ -185,11 +302,12 @@ func (s *service) process(
 		close(done)
 	}()
 
-	ticker := time.NewTicker(2 * time.Second)
+	ticker := time.NewTicker(progressInterval)
 	defer ticker.Stop()
 
 	lastUpdate := start
 	lastRows := int64(0)
+	ticks := 0
 
 	for {
 		select {
@@ -201,16 +319,23 @@ func (s *service) process(
 			rowDelta := currentRows - lastRows
 			rate := float64(rowDelta) / elapsed.Seconds()
 
-			s.jobRepo.Bump(ctx, jobID, int(currentRows))
-			s.log.Info("ingestion progress",
-				zap.String("job_id", jobID),
-				zap.Int64("rows", currentRows),
-				zap.Int64("customers", atomic.LoadInt64(&stats.customers)),
-				zap.Int64("products", atomic.LoadInt64(&stats.products)),
-				zap.Int64("orders", atomic.LoadInt64(&stats.orders)),
-				zap.Int64("items", atomic.LoadInt64(&stats.items)),
-				zap.Float64("rows_per_second", rate),
-				zap.Duration("elapsed", time.Since(start)))
+			progress := s.progress(jobID, &stats, start)
+			progress.RowsPerSecond = rate
+			s.events.publish(jobID, Event{Type: EventProgress, Data: progress})
+
+			ticks++
+			if ticks%progressPersistEvery == 0 {
+				s.jobRepo.Bump(ctx, jobID, int(progress.Processed+progress.Failed))
+				s.log.Info("ingestion progress",
+					zap.String("job_id", jobID),
+					zap.Int64("rows", currentRows),
+					zap.Int64("customers", progress.Customers),
+					zap.Int64("products", progress.Products),
+					zap.Int64("orders", progress.Orders),
+					zap.Int64("items", progress.Items),
+					zap.Float64("rows_per_second", rate),
+					zap.Duration("elapsed", time.Since(start)))
+			}
 
 			lastUpdate = now
 			lastRows = currentRows
@@ -222,64 +347,200 @@ func (s *service) process(
 	}
 
 finish:
-	s.jobRepo.SetCompleted(ctx, jobID, int(atomic.LoadInt64(&stats.rows)))
+	s.phase(jobID, PhaseFinalizing)
+
+	var returnsErr error
+	if ctx.Err() == nil && readErr == nil {
+		returnsErr = s.applyReturns(ctx, jobID, returns.rows, &stats)
+		if returnsErr != nil {
+			s.log.Error("failed to apply returns", zap.String("job_id", jobID), zap.Error(returnsErr))
+		}
+	}
+	if ctx.Err() == nil && readErr == nil && returnsErr == nil {
+		// the data is in, customers are linked to persons in the background
+		s.resolver.Schedule()
+	}
 
 	duration := time.Since(start)
+	result := models.JobResult{
+		JobID:       jobID,
+		Status:      constants.StatusCompleted,
+		Rows:        atomic.LoadInt64(&stats.rows),
+		Failed:      atomic.LoadInt64(&stats.failed),
+		Customers:   atomic.LoadInt64(&stats.customers),
+		Products:    atomic.LoadInt64(&stats.products),
+		Orders:      atomic.LoadInt64(&stats.orders),
+		Items:       atomic.LoadInt64(&stats.items),
+		Returns:     atomic.LoadInt64(&stats.returns),
+		Unconverted: atomic.LoadInt64(&stats.unconverted),
+		DurationMs:  duration.Milliseconds(),
+	}
+	switch {
+	case ctx.Err() != nil:
+		err = ctx.Err()
+		result.Status = constants.StatusCancelled
+		result.Error = err.Error()
+	case readErr != nil:
+		err = readErr
+		result.Status = constants.StatusFailed
+		result.Error = err.Error()
+	case returnsErr != nil:
+		err = returnsErr
+		result.Status = constants.StatusFailed
+		result.Error = err.Error()
+	}
+	s.finish(ctx, result)
+
 	s.log.Info(constants.LogIngestDone,
 		zap.String("job_id", jobID),
-		zap.Int64("rows", stats.rows),
-		zap.Int64("customers", stats.customers),
-		zap.Int64("products", stats.products),
-		zap.Int64("orders", stats.orders),
-		zap.Int64("items", stats.items),
+		zap.String("status", result.Status),
+		zap.Int64("rows", result.Rows),
+		zap.Int64("failed", result.Failed),
+		zap.Int64("customers", result.Customers),
+		zap.Int64("products", result.Products),
+		zap.Int64("orders", result.Orders),
+		zap.Int64("items", result.Items),
+		zap.Int64("returns", result.Returns),
+		zap.Int64("unconverted", result.Unconverted),
 		zap.Duration("duration", duration),
-		zap.Float64("rows_per_sec", float64(stats.rows)/duration.Seconds()),
+		zap.Float64("rows_per_sec", float64(result.Rows)/duration.Seconds()),
 		zap.Duration("parsing_time", time.Duration(atomic.LoadInt64(&stats.parseTime))),
 		zap.Duration("db_time", time.Duration(atomic.LoadInt64(&stats.dbTime))),
 		zap.Float64("db_time_percent", float64(atomic.LoadInt64(&stats.dbTime))/float64(duration.Nanoseconds())*100))
+
+	return err
+}
+
+// progress snapshots the live counters of a job
+func (s *service) progress(jobID string, stats *jobStats, start time.Time) Progress {
+	return Progress{
+		JobID:     jobID,
+		RowsRead:  atomic.LoadInt64(&stats.rows),
+		Processed: atomic.LoadInt64(&stats.processed),
+		Failed:    atomic.LoadInt64(&stats.failed),
+		Customers: atomic.LoadInt64(&stats.customers),
+		Products:  atomic.LoadInt64(&stats.products),
+		Orders:    atomic.LoadInt64(&stats.orders),
+		Items:     atomic.LoadInt64(&stats.items),
+		ElapsedMs: time.Since(start).Milliseconds(),
+	}
 }
 
-// optimizeDBForBulkLoad disables checks to improve bulk load performance
-func (s *service) optimizeDBForBulkLoad(ctx context.Context, jobID string) error {
-	optimizations := []string{
-		"set unique_checks=0",
-		"set foreign_key_checks=0",
+// phase announces that a job entered a new phase
+func (s *service) phase(jobID, phase string) {
+	s.events.publish(jobID, Event{Type: EventPhase, Data: Phase{JobID: jobID, Phase: phase}})
+}
+
+// warn streams a non-fatal problem to subscribers of a job
+func (s *service) warn(jobID string, line int, err error) {
+	s.events.publish(jobID, Event{Type: EventWarning, Data: Warning{JobID: jobID, Line: line, Message: err.Error()}})
+}
+
+// fail marks a job that could not run to completion as failed, or as
+// cancelled when its context was cancelled
+func (s *service) fail(ctx context.Context, jobID, msg string) {
+	status := constants.StatusFailed
+	if ctx.Err() != nil {
+		status = constants.StatusCancelled
+	}
+	s.finish(ctx, models.JobResult{JobID: jobID, Status: status, Error: msg})
+}
+
+// finish persists the final state of a job, publishes it as the last
+// event to subscribers and hands it to the notifier
+func (s *service) finish(ctx context.Context, r models.JobResult) {
+	// the final state must be recorded even for cancelled jobs
+	ctx = context.WithoutCancel(ctx)
+
+	switch r.Status {
+	case constants.StatusCompleted:
+		s.jobRepo.SetCompleted(ctx, r.JobID, int(r.Rows))
+	case constants.StatusCancelled:
+		s.jobRepo.SetCancelled(ctx, r.JobID, r.Error)
+	default:
+		s.jobRepo.SetFailed(ctx, r.JobID, r.Error)
+	}
+	s.events.finish(r.JobID, r)
+
+	if s.notifier != nil {
+		s.notifier.Notify(ctx, r)
+	}
+}
+
+// Subscribe streams the events of a running job until its result is
+// published or cancel is called
+func (s *service) Subscribe(jobID string) (<-chan Event, func()) {
+	return s.events.subscribe(jobID)
+}
+
+// bulkLoadSettings are applied to every worker connection for the
+// duration of a job and reset to the server defaults afterwards
+var (
+	bulkLoadSettings = []string{
+		"set session unique_checks=0",
+		"set session foreign_key_checks=0",
 		"set session transaction_isolation='READ-UNCOMMITTED'",
 	}
+	bulkLoadResets = []string{
+		"set session unique_checks=default",
+		"set session foreign_key_checks=default",
+		"set session transaction_isolation=default",
+	}
+)
 
-	for _, stmt := range optimizations {
-		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+// openBulkConn pins a connection from the ingestion pool and disables
+// checks on it to improve bulk load performance
+func (s *service) openBulkConn(ctx context.Context, jobID string) (*sql.Conn, error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		s.log.Error("failed to acquire DB connection",
+			zap.String("job_id", jobID),
+			zap.Error(err))
+		s.fail(ctx, jobID, fmt.Sprintf("failed to acquire DB connection: %s", err))
+		return nil, err
+	}
+
+	for _, stmt := range bulkLoadSettings {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
 			s.log.Error("failed to set DB optimization",
 				zap.String("job_id", jobID),
 				zap.String("statement", stmt),
 				zap.Error(err))
-			s.jobRepo.SetFailed(ctx, jobID, fmt.Sprintf("failed to optimize DB: %s", err))
-			return err
+			s.fail(ctx, jobID, fmt.Sprintf("failed to optimize DB: %s", err))
+			s.discardConn(conn)
+			return nil, err
 		}
 	}
 
-	s.log.Info("database optimized for bulk loading", zap.String("job_id", jobID))
-	return nil
+	return conn, nil
 }
 
-// restoreDBSettings restores default DB settings after bulk load
-func (s *service) restoreDBSettings(ctx context.Context, jobID string) {
-	restorations := []string{
-		"set unique_checks=1",
-		"set foreign_key_checks=1",
-		"set session transaction_isolation='REPEATABLE-READ'",
-	}
+// releaseBulkConn resets the session settings on a worker connection and
+// hands it back to the pool. A connection whose settings cannot be reset
+// is discarded instead, so it can never be reused with checks disabled.
+func (s *service) releaseBulkConn(ctx context.Context, conn *sql.Conn, jobID string) {
+	// restore even if the job itself was cancelled
+	ctx = context.WithoutCancel(ctx)
 
-	for _, stmt := range restorations {
-		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
-			s.log.Warn("failed to restore DB setting",
+	for _, stmt := range bulkLoadResets {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			s.log.Warn("failed to restore DB setting, discarding connection",
 				zap.String("job_id", jobID),
 				zap.String("statement", stmt),
 				zap.Error(err))
+			s.discardConn(conn)
+			return
 		}
 	}
 
-	s.log.Info("database settings restored", zap.String("job_id", jobID))
+	conn.Close()
+}
+
+// discardConn closes conn and tells the pool not to reuse the underlying
+// driver connection
+func (s *service) discardConn(conn *sql.Conn) {
+	conn.Raw(func(any) error { return driver.ErrBadConn })
+	conn.Close()
 }
 
 // truncateTables clears all tables if in overwrite mode
@@ -290,13 +551,18 @@ func (s *service) truncateTables(
 	s.log.Info("truncating tables for overwrite mode", zap.String("job_id", jobID))
 
 	// clear in reverse dependency order
-	tables := []string{"order_items", "orders", "products", "customers"}
+	tables := []string{
+		"returns", "order_items", "orders", "product_history", "products", "customer_history", "customers",
+		"merge_candidates", "persons",
+		// undo images of earlier jobs refer to rows that are gone
+		"order_item_undo", "order_undo", "product_undo", "customer_undo",
+	}
 	for _, t := range tables {
 		if _, err := s.db.ExecContext(ctx, "truncate table "+t); err != nil {
 			s.log.Error("failed to truncate table",
 				zap.String("table", t),
 				zap.Error(err))
-			s.jobRepo.SetFailed(ctx, jobID, fmt.Sprintf("failed to truncate table %s: %s", t, err))
+			s.fail(ctx, jobID, fmt.Sprintf("failed to truncate table %s: %s", t, err))
 			return err
 		}
 	}
@@ -2,29 +2,32 @@ package ingestion
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"sync/atomic"
 	"time"
 
 	"sales-analytics/internal/models"
 	"sales-analytics/internal/repository"
+	"sales-analytics/internal/service/fx"
 
 	"go.uber.org/zap"
 )
 
+// historyLockTimeout bounds the wait of a worker for the history lock
+const historyLockTimeout = 2 * time.Minute
+
 // worker processes data from the csv reader
 func (s *service) worker(
 	ctx context.Context,
 	jobID string,
-	rows <-chan []string,
-	stats *struct {
-		rows      int64
-		customers int64
-		products  int64
-		orders    int64
-		items     int64
-		parseTime int64
-		dbTime    int64
-	},
+	conn *sql.Conn,
+	rows <-chan csvRow,
+	dates *dateParser,
+	rates *fx.Table,
+	erased *erasures,
+	returns *returnBuffer,
+	stats *jobStats,
 	workerID int,
 ) {
 	// track stats for this worker
@@ -32,39 +35,58 @@ func (s *service) worker(
 	var processed, failed int
 	var parseTime, dbTime time.Duration
 
+	// currencies without a rate, warned about once per worker
+	missingRates := make(map[string]bool)
+
 	// maintain maps for deduplication - preallocate with capacity
 	seenCustomers := make(map[string]bool, s.batchSize*2)
 	seenProducts := make(map[string]bool, s.batchSize*2)
 	seenOrders := make(map[string]bool, s.batchSize*2)
 
+	// attributes sent to the history for each customer and product by date
+	customerAttrs := make(sightings, s.batchSize*2)
+	productAttrs := make(sightings, s.batchSize*2)
+
 	// batch accumulation - preallocate with capacity to reduce allocations
 	customerBatch := make([]models.Customer, 0, s.batchSize)
 	productBatch := make([]models.Product, 0, s.batchSize)
 	orderBatch := make([]Sale, 0, s.batchSize)
+	customerHistory := make([]models.Customer, 0, s.batchSize)
+	productHistory := make([]models.Product, 0, s.batchSize)
 
 	// helper to flush batches when they reach the threshold
 	flushBatches := func() {
 		dbStart := time.Now()
 
 		if len(customerBatch) > 0 {
-			count := s.insertCustomerBatch(ctx, customerBatch, jobID, workerID)
+			count := s.insertCustomerBatch(ctx, conn, customerBatch, jobID, workerID)
 			atomic.AddInt64(&stats.customers, int64(count))
 			customerBatch = customerBatch[:0]
 		}
 
 		if len(productBatch) > 0 {
-			count := s.insertProductBatch(ctx, productBatch, jobID, workerID)
+			count := s.insertProductBatch(ctx, conn, productBatch, jobID, workerID)
 			atomic.AddInt64(&stats.products, int64(count))
 			productBatch = productBatch[:0]
 		}
 
 		if len(orderBatch) > 0 {
-			orders, items := s.insertOrderBatch(ctx, orderBatch, jobID, workerID)
+			orders, items := s.insertOrderBatch(ctx, conn, orderBatch, jobID, workerID)
 			atomic.AddInt64(&stats.orders, int64(orders))
 			atomic.AddInt64(&stats.items, int64(items))
 			orderBatch = orderBatch[:0]
 		}
 
+		if len(customerHistory) > 0 {
+			s.insertCustomerHistory(ctx, conn, customerHistory, jobID, workerID)
+			customerHistory = customerHistory[:0]
+		}
+
+		if len(productHistory) > 0 {
+			s.insertProductHistory(ctx, conn, productHistory, jobID, workerID)
+			productHistory = productHistory[:0]
+		}
+
 		dbDuration := time.Since(dbStart)
 		dbTime += dbDuration
 		atomic.AddInt64(&stats.dbTime, dbDuration.Nanoseconds())
@@ -73,28 +95,78 @@ func (s *service) worker(
 	// process rows received from the channel
 	for record := range rows {
 		parseStart := time.Now()
-		sale, err := parseRow(record)
+		sale, err := parseRow(record.fields, dates)
+		if err == nil {
+			err = classify(&sale, record.kind)
+		}
+		if err == nil {
+			err = s.convert(&sale, record.currency, rates, missingRates, jobID, record.line)
+		}
 		parseTime += time.Since(parseStart)
 
 		if err != nil {
 			s.log.Warn("failed to parse row",
 				zap.String("job_id", jobID),
+				zap.Int("line", record.line),
 				zap.Error(err),
-				zap.Strings("record", record))
+				zap.Strings("record", redact(record.fields)))
 			failed++
+			atomic.AddInt64(&stats.failed, 1)
+			s.warn(jobID, record.line, err)
 			continue
 		}
+		sale.Lineage = models.Lineage{JobID: jobID, SourceLine: record.line}
+
+		// orders of erased customers stay with their replacement, which
+		// must not pick up the personal data again
+		wasErased := erased.replace(&sale)
 
-		// add to batches, handle deduplication
-		if !seenCustomers[sale.CustomerID] {
-			seenCustomers[sale.CustomerID] = true
-			customerBatch = append(customerBatch, sale.ToCustomer())
+		// returns are applied after all sales are stored
+		if sale.Kind != "" {
+			returns.add(sale.ToReturn())
+			processed++
+			atomic.AddInt64(&stats.processed, 1)
+			continue
+		}
 
-			// flush customer batch if it reaches batch size
-			if len(customerBatch) >= s.batchSize {
-				count := s.insertCustomerBatch(ctx, customerBatch, jobID, workerID)
-				atomic.AddInt64(&stats.customers, int64(count))
-				customerBatch = customerBatch[:0]
+		// add to batches, handle deduplication; every sighting of attributes
+		// not sent yet goes to the history, which orders them by date
+		if !wasErased {
+			seen := sighting(sale.customerDigest(), sale.OrderDate)
+			unsent := !customerAttrs.sent(sale.CustomerID, seen)
+			if unsent || !seenCustomers[sale.CustomerID] {
+				customer, err := s.seal(sale.ToCustomer())
+				if err != nil {
+					s.log.Error("failed to encrypt customer",
+						zap.String("job_id", jobID),
+						zap.Int("line", record.line),
+						zap.Error(err))
+					failed++
+					atomic.AddInt64(&stats.failed, 1)
+					s.warn(jobID, record.line, err)
+					continue
+				}
+
+				if !seenCustomers[sale.CustomerID] {
+					seenCustomers[sale.CustomerID] = true
+					customerBatch = append(customerBatch, customer)
+
+					// flush customer batch if it reaches batch size
+					if len(customerBatch) >= s.batchSize {
+						count := s.insertCustomerBatch(ctx, conn, customerBatch, jobID, workerID)
+						atomic.AddInt64(&stats.customers, int64(count))
+						customerBatch = customerBatch[:0]
+					}
+				}
+
+				if unsent {
+					customerAttrs.add(sale.CustomerID, seen)
+					customerHistory = append(customerHistory, customer)
+					if len(customerHistory) >= s.batchSize {
+						s.insertCustomerHistory(ctx, conn, customerHistory, jobID, workerID)
+						customerHistory = customerHistory[:0]
+					}
+				}
 			}
 		}
 
@@ -104,28 +176,42 @@ func (s *service) worker(
 
 			// flush product batch if it reaches batch size
 			if len(productBatch) >= s.batchSize {
-				count := s.insertProductBatch(ctx, productBatch, jobID, workerID)
+				count := s.insertProductBatch(ctx, conn, productBatch, jobID, workerID)
 				atomic.AddInt64(&stats.products, int64(count))
 				productBatch = productBatch[:0]
 			}
 		}
 
+		productSeen := sighting(sale.productDigest(), sale.OrderDate)
+		if !productAttrs.sent(sale.ProductID, productSeen) {
+			productAttrs.add(sale.ProductID, productSeen)
+			productHistory = append(productHistory, sale.ToProduct())
+			if len(productHistory) >= s.batchSize {
+				s.insertProductHistory(ctx, conn, productHistory, jobID, workerID)
+				productHistory = productHistory[:0]
+			}
+		}
+
 		// add to order batch (even if we've seen this order before,
 		// as order items might be different)
 		orderBatch = append(orderBatch, sale)
+		if sale.FXRate == 0 {
+			atomic.AddInt64(&stats.unconverted, 1)
+		}
 		if !seenOrders[sale.OrderID] {
 			seenOrders[sale.OrderID] = true
 		}
 
 		// flush order batch if it reaches batch size
 		if len(orderBatch) >= s.batchSize {
-			orders, items := s.insertOrderBatch(ctx, orderBatch, jobID, workerID)
+			orders, items := s.insertOrderBatch(ctx, conn, orderBatch, jobID, workerID)
 			atomic.AddInt64(&stats.orders, int64(orders))
 			atomic.AddInt64(&stats.items, int64(items))
 			orderBatch = orderBatch[:0]
 		}
 
 		processed++
+		atomic.AddInt64(&stats.processed, 1)
 
 		if processed > 0 && processed%50000 == 0 {
 			s.log.Debug("worker progress",
@@ -157,9 +243,53 @@ func (s *service) worker(
 		zap.Float64("db_time_pct", float64(dbTime)/float64(time.Since(startTime))*100))
 }
 
+// convert sets the currency and base currency rate of a sale. A blank
+// currency is the base currency; a sale without a rate is still loaded and
+// gets its base amounts once rates are loaded for it.
+func (s *service) convert(
+	sale *Sale,
+	currency string,
+	rates *fx.Table,
+	missing map[string]bool,
+	jobID string,
+	line int,
+) error {
+	sale.Currency = rates.Base()
+	if currency != "" {
+		code, ok := fx.NormalizeCurrency(currency)
+		if !ok {
+			return fmt.Errorf("invalid currency: %q", currency)
+		}
+		sale.Currency = code
+	}
+
+	rate, ok := rates.Rate(sale.Currency, sale.OrderDate)
+	if !ok && !missing[sale.Currency] {
+		missing[sale.Currency] = true
+		s.warn(jobID, line, fmt.Errorf("no fx rate for %s on %s, base amounts pending",
+			sale.Currency, sale.OrderDate.Format("2006-01-02")))
+	}
+	sale.FXRate = rate
+	return nil
+}
+
+// seal encrypts the email and address of a customer and sets their blind
+// indexes
+func (s *service) seal(c models.Customer) (models.Customer, error) {
+	var err error
+	if c.Email, c.EmailIndex, err = s.keys.Email(c.Email); err != nil {
+		return c, fmt.Errorf("failed to encrypt email: %w", err)
+	}
+	if c.Address, c.AddressIndex, err = s.keys.Address(c.Address); err != nil {
+		return c, fmt.Errorf("failed to encrypt address: %w", err)
+	}
+	return c, nil
+}
+
 // insertCustomerBatch inserts a batch of customers
 func (s *service) insertCustomerBatch(
 	ctx context.Context,
+	conn *sql.Conn,
 	customers []models.Customer,
 	jobID string,
 	workerID int,
@@ -169,7 +299,7 @@ func (s *service) insertCustomerBatch(
 	}
 
 	// start transaction
-	tx, err := s.db.BeginTx(ctx, nil)
+	tx, err := conn.BeginTx(ctx, nil)
 	if err != nil {
 		s.log.Error("failed to begin transaction",
 			zap.String("job_id", jobID),
@@ -211,6 +341,7 @@ func (s *service) insertCustomerBatch(
 // insertProductBatch inserts a batch of products
 func (s *service) insertProductBatch(
 	ctx context.Context,
+	conn *sql.Conn,
 	products []models.Product,
 	jobID string,
 	workerID int,
@@ -219,7 +350,7 @@ func (s *service) insertProductBatch(
 		return 0
 	}
 
-	tx, err := s.db.BeginTx(ctx, nil)
+	tx, err := conn.BeginTx(ctx, nil)
 	if err != nil {
 		s.log.Error("failed to begin transaction",
 			zap.String("job_id", jobID),
@@ -258,9 +389,79 @@ func (s *service) insertProductBatch(
 	return inserted
 }
 
+// insertCustomerHistory records customer attribute changes in the history
+func (s *service) insertCustomerHistory(
+	ctx context.Context,
+	conn *sql.Conn,
+	customers []models.Customer,
+	jobID string,
+	workerID int,
+) {
+	s.recordHistory(ctx, conn, "customer_history", len(customers), jobID, workerID,
+		func(repos repository.IngestionRepos) error {
+			return repos.Customers.RecordHistory(ctx, customers, jobID)
+		})
+}
+
+// insertProductHistory records product attribute changes in the history
+func (s *service) insertProductHistory(
+	ctx context.Context,
+	conn *sql.Conn,
+	products []models.Product,
+	jobID string,
+	workerID int,
+) {
+	s.recordHistory(ctx, conn, "product_history", len(products), jobID, workerID,
+		func(repos repository.IngestionRepos) error { return repos.Products.RecordHistory(ctx, products, jobID) })
+}
+
+// recordHistory runs write in a transaction holding the named lock. History
+// versions are merged with the stored ones by date, so writers of the same
+// table are serialized across workers and jobs.
+func (s *service) recordHistory(
+	ctx context.Context,
+	conn *sql.Conn,
+	table string,
+	size int,
+	jobID string,
+	workerID int,
+	write func(repos repository.IngestionRepos) error,
+) {
+	fail := func(msg string, err error) {
+		s.log.Error(msg,
+			zap.String("job_id", jobID),
+			zap.Int("worker_id", workerID),
+			zap.String("table", table),
+			zap.Int("batch_size", size),
+			zap.Error(err))
+	}
+
+	if err := repository.Lock(ctx, conn, table, historyLockTimeout); err != nil {
+		fail("failed to lock history", err)
+		return
+	}
+	defer repository.Unlock(context.Background(), conn, table)
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		fail("failed to begin transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := write(repository.NewIngestionRepo(tx)); err != nil {
+		fail("failed to record history", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		fail("failed to commit history transaction", err)
+	}
+}
+
 // insertOrderBatch inserts a batch of orders and their items
 func (s *service) insertOrderBatch(
 	ctx context.Context,
+	conn *sql.Conn,
 	sales []Sale,
 	jobID string,
 	workerID int,
@@ -270,7 +471,7 @@ func (s *service) insertOrderBatch(
 	}
 
 	// start transaction
-	tx, err := s.db.BeginTx(ctx, nil)
+	tx, err := conn.BeginTx(ctx, nil)
 	if err != nil {
 		s.log.Error("failed to begin transaction",
 			zap.String("job_id", jobID),
@@ -295,7 +496,11 @@ func (s *service) insertOrderBatch(
 				ID:          sale.OrderID,
 				CustomerID:  sale.CustomerID,
 				OrderDate:   sale.OrderDate,
+				OrderedAt:   sale.OrderedAt,
 				TotalAmount: sale.OrderTotal,
+				Currency:    sale.Currency,
+				FXRate:      sale.FXRate,
+				Lineage:     sale.Lineage,
 			})
 		}
 
@@ -306,6 +511,9 @@ func (s *service) insertOrderBatch(
 			UnitPrice:    sale.Price,
 			Discount:     sale.Discount,
 			ShippingCost: sale.Shipping,
+			Currency:     sale.Currency,
+			FXRate:       sale.FXRate,
+			Lineage:      sale.Lineage,
 		})
 	}
 
@@ -0,0 +1,128 @@
+package privacy
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"sales-analytics/internal/constants"
+	"sales-analytics/internal/models"
+	"sales-analytics/internal/repository"
+	"sales-analytics/pkg/pii"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrCustomerNotFound = errors.New("customer not found")
+	ErrInvalidMode      = errors.New("invalid erasure mode, expected anonymize or purge")
+	ErrNoIndexKey       = errors.New("pii index_key is not configured, erased customer IDs would be kept as a reversible hash")
+)
+
+// Subject is the blind index a customer ID is remembered by once erased.
+// Erase refuses to run unless the index is keyed.
+func Subject(keys *pii.Keyring, customerID string) string {
+	return keys.BlindIndex("customer:" + customerID)
+}
+
+// Erase removes the personal data of a customer in one transaction. Its
+// orders are kept so revenue stays correct: anonymize moves them to a new
+// pseudonymous customer in the same region, purge to the shared erased
+// customer and drops the customer's history. Either way the customer ID is
+// remembered by its blind index, and ingestion maps rows of it to the
+// replacement without loading their personal data again.
+func (s *service) Erase(
+	ctx context.Context,
+	customerID, mode, reason string,
+) (models.Erasure, error) {
+	if !s.keys.Keyed() {
+		return models.Erasure{}, ErrNoIndexKey
+	}
+
+	e := models.Erasure{
+		SubjectHash: Subject(s.keys, customerID),
+		Mode:        mode,
+		Reason:      reason,
+		ErasedAt:    time.Now().UTC(),
+	}
+	switch mode {
+	case constants.ErasureAnonymize:
+		e.Replacement = pseudonym()
+	case constants.ErasurePurge:
+		e.Replacement = constants.ErasedCustomerID
+	default:
+		return e, ErrInvalidMode
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return e, fmt.Errorf("failed to begin erasure: %w", err)
+	}
+	defer tx.Rollback()
+
+	repo := repository.NewPrivacyRepo(tx)
+
+	region, personID, err := repo.LockErasable(ctx, customerID)
+	if err == sql.ErrNoRows {
+		return e, ErrCustomerNotFound
+	}
+	if err != nil {
+		return e, fmt.Errorf("failed to lock customer: %w", err)
+	}
+
+	// purged customers do not keep their region
+	if mode == constants.ErasurePurge {
+		region = ""
+	}
+	if err := repo.CreateReplacement(ctx, e.Replacement, region); err != nil {
+		return e, fmt.Errorf("failed to create replacement customer: %w", err)
+	}
+
+	if e.Orders, err = repo.ReassignOrders(ctx, customerID, e.Replacement); err != nil {
+		return e, err
+	}
+
+	if mode == constants.ErasureAnonymize {
+		e.History, err = repo.AnonymizeHistory(ctx, customerID, e.Replacement)
+	} else {
+		e.History, err = repo.DeleteHistory(ctx, customerID)
+	}
+	if err != nil {
+		return e, err
+	}
+
+	if err := repo.DeleteCustomer(ctx, customerID); err != nil {
+		return e, fmt.Errorf("failed to delete customer: %w", err)
+	}
+	if personID != 0 {
+		if err := repo.DetachPerson(ctx, personID); err != nil {
+			return e, err
+		}
+	}
+
+	if e.ID, err = repo.RecordErasure(ctx, e, region); err != nil {
+		return e, err
+	}
+	if err := tx.Commit(); err != nil {
+		return e, fmt.Errorf("failed to commit erasure: %w", err)
+	}
+
+	s.log.Info("customer erased",
+		zap.Int64("audit_id", e.ID),
+		zap.String("subject_hash", e.SubjectHash),
+		zap.String("mode", mode),
+		zap.Int64("orders", e.Orders),
+		zap.Int64("history_rows", e.History))
+	return e, nil
+}
+
+// pseudonym is a random customer ID that cannot be traced back
+func pseudonym() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "anon-" + hex.EncodeToString(b)
+}
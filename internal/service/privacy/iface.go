@@ -0,0 +1,16 @@
+package privacy
+
+import (
+	"context"
+
+	"sales-analytics/internal/models"
+)
+
+type Service interface {
+	// RotateKeys re-encrypts personal data not yet encrypted with the active
+	// key, including plaintext from before encryption was enabled, and
+	// recomputes its blind indexes
+	RotateKeys(ctx context.Context) (models.RotationResult, error)
+
+	Erase(ctx context.Context, customerID, mode, reason string) (models.Erasure, error)
+}
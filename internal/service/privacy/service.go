@@ -0,0 +1,115 @@
+package privacy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"sales-analytics/internal/models"
+	"sales-analytics/internal/repository"
+	"sales-analytics/pkg/pii"
+
+	"go.uber.org/zap"
+)
+
+const batchSize = 500
+
+var ErrDisabled = errors.New("pii encryption is not configured")
+
+type service struct {
+	db   *sql.DB
+	repo repository.PrivacyRepository
+	keys *pii.Keyring
+	log  *zap.Logger
+}
+
+func New(
+	db *sql.DB,
+	keys *pii.Keyring,
+	log *zap.Logger,
+) Service {
+	return &service{
+		db:   db,
+		repo: repository.NewPrivacyRepo(db),
+		keys: keys,
+		log:  log,
+	}
+}
+
+func (s *service) RotateKeys(
+	ctx context.Context,
+) (models.RotationResult, error) {
+	result := models.RotationResult{ActiveKey: s.keys.ActiveKey()}
+	if !s.keys.Enabled() {
+		return result, ErrDisabled
+	}
+
+	for _, t := range repository.SealedTables {
+		tr, err := s.rotate(ctx, t)
+		result.Tables = append(result.Tables, tr)
+		if err != nil {
+			return result, fmt.Errorf("failed to rotate %s: %w", t.Name, err)
+		}
+	}
+
+	s.log.Info("pii keys rotated",
+		zap.String("active_key", result.ActiveKey),
+		zap.Any("tables", result.Tables))
+	return result, nil
+}
+
+// rotate re-encrypts the stale rows of one table batch by batch. Rows that
+// cannot be decrypted are counted and skipped.
+func (s *service) rotate(
+	ctx context.Context,
+	t repository.SealedTable,
+) (models.TableRotation, error) {
+	tr := models.TableRotation{Table: t.Name}
+
+	var after []string
+	for {
+		rows, err := s.repo.Stale(ctx, t, s.keys.ActivePrefix(), after, batchSize)
+		if err != nil {
+			return tr, err
+		}
+		if len(rows) == 0 {
+			return tr, nil
+		}
+		after = rows[len(rows)-1].Key
+
+		for _, row := range rows {
+			if err := s.reseal(&row); err != nil {
+				s.log.Warn("failed to decrypt pii",
+					zap.String("table", t.Name),
+					zap.Strings("key", row.Key),
+					zap.Error(err))
+				tr.Failed++
+				continue
+			}
+			if err := s.repo.Reseal(ctx, t, row); err != nil {
+				return tr, err
+			}
+			tr.Rewritten++
+		}
+	}
+}
+
+// reseal decrypts a row with whichever key sealed it and encrypts it with
+// the active key
+func (s *service) reseal(row *models.SealedRow) error {
+	email, err := s.keys.Decrypt(row.Email)
+	if err != nil {
+		return err
+	}
+	address, err := s.keys.Decrypt(row.Address)
+	if err != nil {
+		return err
+	}
+
+	if row.Email, row.EmailIndex, err = s.keys.Email(email); err != nil {
+		return err
+	}
+	row.Address, row.AddressIndex, err = s.keys.Address(address)
+	return err
+}
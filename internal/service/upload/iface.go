@@ -0,0 +1,25 @@
+package upload
+
+import (
+	"context"
+	"io"
+
+	"sales-analytics/internal/models"
+)
+
+type Service interface {
+	// Create opens a session for a file of the given size
+	Create(ctx context.Context, req CreateRequest) (models.UploadSession, error)
+
+	Get(ctx context.Context, id string) (models.UploadSession, error)
+
+	// WriteChunk appends the bytes read from r at offset, which must match
+	// the bytes received so far. A non-negative length must match the bytes
+	// read, checksum is the hex SHA-256 of the chunk.
+	WriteChunk(ctx context.Context, id string, offset, length int64, r io.Reader, checksum string) (models.UploadSession, error)
+
+	// Finalize verifies the assembled file and starts an ingestion job for it
+	Finalize(ctx context.Context, id string) (models.UploadSession, error)
+
+	Abort(ctx context.Context, id string) error
+}
@@ -0,0 +1,438 @@
+package upload
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"sales-analytics/config"
+	"sales-analytics/internal/constants"
+	"sales-analytics/internal/models"
+	"sales-analytics/internal/repository"
+	"sales-analytics/internal/service/ingestion"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMaxChunkSize = 64 << 20 // 64MB per PUT
+	defaultMaxFileSize  = 20 << 30 // 20GB per upload
+	defaultSessionTTL   = 24 * time.Hour
+)
+
+var (
+	ErrNotFound         = errors.New("upload session not found")
+	ErrInvalidRequest   = errors.New("invalid upload request")
+	ErrOffsetMismatch   = errors.New("offset does not match received bytes")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrChunkTooLarge    = errors.New("chunk too large")
+	ErrLengthMismatch   = errors.New("chunk length does not match Content-Range")
+	ErrIncomplete       = errors.New("upload incomplete")
+	ErrFinalized        = errors.New("upload already finalized")
+	ErrBusy             = errors.New("another chunk is being written")
+)
+
+// CreateRequest describes the file a client is about to upload
+type CreateRequest struct {
+	FileName    string `json:"file_name"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	Mode        string `json:"mode"`
+	CallbackURL string `json:"callback_url"`
+}
+
+type service struct {
+	repo      repository.UploadRepository
+	jobs      repository.JobRepository
+	ingestion ingestion.Service
+	log       *zap.Logger
+
+	dir          string
+	maxChunkSize int64
+	maxFileSize  int64
+	sessionTTL   time.Duration
+
+	// one writer per session at a time, entries are removed once the
+	// session is finalized, aborted or expired
+	locks sync.Map
+}
+
+func New(
+	cfg config.Upload,
+	repo repository.UploadRepository,
+	jobs repository.JobRepository,
+	ingestionSvc ingestion.Service,
+	log *zap.Logger,
+) (Service, error) {
+	if cfg.Dir == "" {
+		cfg.Dir = filepath.Join(os.TempDir(), "sales-analytics-uploads")
+	}
+	if cfg.MaxChunkSize <= 0 {
+		cfg.MaxChunkSize = defaultMaxChunkSize
+	}
+	if cfg.MaxFileSize <= 0 {
+		cfg.MaxFileSize = defaultMaxFileSize
+	}
+	if cfg.SessionTTL <= 0 {
+		cfg.SessionTTL = defaultSessionTTL
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+
+	s := &service{
+		repo:         repo,
+		jobs:         jobs,
+		ingestion:    ingestionSvc,
+		log:          log,
+		dir:          cfg.Dir,
+		maxChunkSize: cfg.MaxChunkSize,
+		maxFileSize:  cfg.MaxFileSize,
+		sessionTTL:   cfg.SessionTTL,
+	}
+	go s.sweep()
+
+	return s, nil
+}
+
+func (s *service) Create(
+	ctx context.Context,
+	req CreateRequest,
+) (models.UploadSession, error) {
+	if req.Mode == "" {
+		req.Mode = constants.ModeAppend
+	}
+	req.SHA256 = strings.ToLower(req.SHA256)
+
+	switch {
+	case req.Size <= 0:
+		return models.UploadSession{}, fmt.Errorf("%w: size must be positive", ErrInvalidRequest)
+	case req.Size > s.maxFileSize:
+		return models.UploadSession{}, fmt.Errorf("%w: size exceeds %d bytes", ErrInvalidRequest, s.maxFileSize)
+	case req.Mode != constants.ModeAppend && req.Mode != constants.ModeOverwrite:
+		return models.UploadSession{}, fmt.Errorf("%w: mode must be append or overwrite", ErrInvalidRequest)
+	case req.SHA256 != "" && !isSHA256(req.SHA256):
+		return models.UploadSession{}, fmt.Errorf("%w: sha256 must be 64 hex characters", ErrInvalidRequest)
+	}
+
+	u := models.UploadSession{
+		ID:          uuid.NewString(),
+		FileName:    filepath.Base(req.FileName),
+		TotalSize:   req.Size,
+		SHA256:      req.SHA256,
+		Mode:        req.Mode,
+		CallbackURL: req.CallbackURL,
+		Status:      constants.UploadOpen,
+	}
+
+	f, err := os.OpenFile(s.path(u.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return models.UploadSession{}, fmt.Errorf("failed to create upload file: %w", err)
+	}
+	f.Close()
+
+	if err := s.repo.Create(ctx, u); err != nil {
+		os.Remove(s.path(u.ID))
+		return models.UploadSession{}, err
+	}
+
+	s.log.Info("upload session created",
+		zap.String("upload_id", u.ID),
+		zap.String("file_name", u.FileName),
+		zap.Int64("size", u.TotalSize))
+
+	return s.Get(ctx, u.ID)
+}
+
+func (s *service) Get(
+	ctx context.Context,
+	id string,
+) (models.UploadSession, error) {
+	u, err := s.repo.Get(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, ErrNotFound
+	}
+	if err != nil {
+		return u, fmt.Errorf("failed to load upload session: %w", err)
+	}
+	return u, nil
+}
+
+func (s *service) WriteChunk(
+	ctx context.Context,
+	id string,
+	offset int64,
+	length int64,
+	r io.Reader,
+	checksum string,
+) (models.UploadSession, error) {
+	unlock, ok := s.lock(id)
+	if !ok {
+		return models.UploadSession{}, ErrBusy
+	}
+	defer unlock()
+
+	u, err := s.Get(ctx, id)
+	if err != nil {
+		return u, err
+	}
+	if u.Status != constants.UploadOpen {
+		return u, ErrFinalized
+	}
+	if offset != u.Received {
+		return u, ErrOffsetMismatch
+	}
+	if !isSHA256(strings.ToLower(checksum)) {
+		return u, fmt.Errorf("%w: chunk checksum must be a hex sha256", ErrInvalidRequest)
+	}
+
+	f, err := os.OpenFile(s.path(id), os.O_WRONLY, 0)
+	if err != nil {
+		return u, fmt.Errorf("failed to open upload file: %w", err)
+	}
+	defer f.Close()
+
+	// drop anything past the recorded offset, e.g. a chunk that was being
+	// written when the previous connection dropped
+	if err := f.Truncate(u.Received); err != nil {
+		return u, fmt.Errorf("failed to truncate upload file: %w", err)
+	}
+	if _, err := f.Seek(u.Received, io.SeekStart); err != nil {
+		return u, fmt.Errorf("failed to seek upload file: %w", err)
+	}
+
+	limit := min(s.maxChunkSize, u.TotalSize-u.Received)
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(r, limit+1))
+	rollback := func() { f.Truncate(u.Received) }
+
+	switch {
+	case err != nil:
+		rollback()
+		return u, fmt.Errorf("failed to write chunk: %w", err)
+	case n > limit:
+		rollback()
+		return u, ErrChunkTooLarge
+	case n == 0:
+		return u, fmt.Errorf("%w: empty chunk", ErrInvalidRequest)
+	case length >= 0 && n != length:
+		rollback()
+		return u, ErrLengthMismatch
+	case hex.EncodeToString(h.Sum(nil)) != strings.ToLower(checksum):
+		rollback()
+		return u, ErrChecksumMismatch
+	}
+
+	if err := f.Sync(); err != nil {
+		rollback()
+		return u, fmt.Errorf("failed to sync upload file: %w", err)
+	}
+
+	u.Received += n
+	if err := s.repo.SetReceived(ctx, id, u.Received); err != nil {
+		rollback()
+		return u, err
+	}
+
+	s.log.Debug("upload chunk written",
+		zap.String("upload_id", id),
+		zap.Int64("offset", offset),
+		zap.Int64("bytes", n),
+		zap.Int64("received", u.Received))
+
+	return u, nil
+}
+
+func (s *service) Finalize(
+	ctx context.Context,
+	id string,
+) (models.UploadSession, error) {
+	unlock, ok := s.lock(id)
+	if !ok {
+		return models.UploadSession{}, ErrBusy
+	}
+	defer unlock()
+
+	u, err := s.Get(ctx, id)
+	if err != nil {
+		return u, err
+	}
+	// finalizing twice returns the job of the first call
+	if u.Status == constants.UploadFinalized {
+		return u, nil
+	}
+	if u.Received != u.TotalSize {
+		return u, ErrIncomplete
+	}
+
+	if u.SHA256 != "" {
+		sum, err := fileSHA256(s.path(id))
+		if err != nil {
+			return u, err
+		}
+		if sum != u.SHA256 {
+			return u, ErrChecksumMismatch
+		}
+	}
+
+	jobID := uuid.NewString()
+	s.jobs.Insert(ctx, models.IngestionJob{JobID: jobID, Mode: u.Mode, CallbackURL: u.CallbackURL})
+	if err := s.repo.SetFinalized(ctx, id, jobID); err != nil {
+		s.jobs.SetFailed(ctx, jobID, err.Error())
+		return u, err
+	}
+	u.Status = constants.UploadFinalized
+	u.JobID = jobID
+	s.locks.Delete(id)
+
+	s.log.Info("upload finalized, starting ingestion",
+		zap.String("upload_id", id),
+		zap.String("job_id", jobID),
+		zap.Int64("size", u.TotalSize))
+
+	go s.ingest(u)
+
+	return u, nil
+}
+
+// ingest imports an assembled upload and removes the file afterwards
+func (s *service) ingest(u models.UploadSession) {
+	ctx := context.Background()
+	path := s.path(u.ID)
+	defer os.Remove(path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		s.log.Error("failed to open assembled upload",
+			zap.String("upload_id", u.ID),
+			zap.Error(err))
+		s.jobs.SetFailed(ctx, u.JobID, "failed to open assembled upload: "+err.Error())
+		return
+	}
+	defer f.Close()
+
+	s.ingestion.ImportFile(ctx, f, u.JobID, u.Mode)
+}
+
+func (s *service) Abort(
+	ctx context.Context,
+	id string,
+) error {
+	unlock, ok := s.lock(id)
+	if !ok {
+		return ErrBusy
+	}
+	defer unlock()
+
+	u, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if u.Status == constants.UploadFinalized {
+		return ErrFinalized
+	}
+
+	if err := s.remove(ctx, id); err != nil {
+		return err
+	}
+
+	s.log.Info("upload session aborted", zap.String("upload_id", id))
+	return nil
+}
+
+// remove deletes a session with its part file and lock entry, the caller
+// holds the session lock
+func (s *service) remove(
+	ctx context.Context,
+	id string,
+) error {
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	os.Remove(s.path(id))
+	s.locks.Delete(id)
+	return nil
+}
+
+// sweep periodically removes open sessions idle for longer than the TTL
+func (s *service) sweep() {
+	ticker := time.NewTicker(min(s.sessionTTL, time.Hour))
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.expire(context.Background())
+	}
+}
+
+func (s *service) expire(
+	ctx context.Context,
+) {
+	ids, err := s.repo.Expired(ctx, time.Now().Add(-s.sessionTTL))
+	if err != nil {
+		s.log.Error("failed to list expired upload sessions", zap.Error(err))
+		return
+	}
+
+	for _, id := range ids {
+		unlock, ok := s.lock(id)
+		if !ok {
+			// a chunk is being written, the session is in use
+			continue
+		}
+		err := s.remove(ctx, id)
+		unlock()
+		if err != nil {
+			s.log.Error("failed to remove expired upload session",
+				zap.String("upload_id", id),
+				zap.Error(err))
+			continue
+		}
+		s.log.Info("expired upload session removed", zap.String("upload_id", id))
+	}
+}
+
+func (s *service) path(id string) string {
+	return filepath.Join(s.dir, id+".part")
+}
+
+// lock takes the per-session write lock without waiting
+func (s *service) lock(id string) (func(), bool) {
+	m, _ := s.locks.LoadOrStore(id, &sync.Mutex{})
+	mu := m.(*sync.Mutex)
+	if !mu.TryLock() {
+		return nil, false
+	}
+	return mu.Unlock, true
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open upload file: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash upload file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func isSHA256(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,15 @@
+package webhook
+
+import (
+	"context"
+
+	"sales-analytics/internal/models"
+)
+
+type Service interface {
+	// Notify delivers the result of a finished job to its callback URL and
+	// the globally configured one. Delivery happens in the background.
+	Notify(ctx context.Context, r models.JobResult)
+
+	Deliveries(ctx context.Context, jobID string) ([]models.WebhookDelivery, error)
+}
@@ -0,0 +1,260 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sales-analytics/config"
+	"sales-analytics/internal/constants"
+	"sales-analytics/internal/models"
+	"sales-analytics/internal/repository"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMaxAttempts = 5
+	defaultBackoff     = 2 * time.Second
+	defaultTimeout     = 10 * time.Second
+	maxBackoff         = 5 * time.Minute
+	// maxDrain is the most of a response body read before closing it
+	maxDrain = 64 << 10
+
+	// headers sent with every delivery, the signature covers
+	// "<timestamp>.<body>" so a captured request cannot be replayed later
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// ErrNoSecret is returned when callbacks are configured without a signing
+// secret; receivers could not authenticate unsigned deliveries
+var ErrNoSecret = errors.New("webhook secret is required to send callbacks")
+
+// Payload is the JSON body posted to callback URLs
+type Payload struct {
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurred_at"`
+	models.JobResult
+}
+
+type service struct {
+	jobs   repository.JobRepository
+	repo   repository.WebhookRepository
+	client *http.Client
+	log    *zap.Logger
+
+	url         string
+	secret      []byte
+	maxAttempts int
+	backoff     time.Duration
+}
+
+func New(
+	cfg config.Webhook,
+	jobs repository.JobRepository,
+	repo repository.WebhookRepository,
+	log *zap.Logger,
+) (Service, error) {
+	if cfg.URL != "" && cfg.Secret == "" {
+		return nil, fmt.Errorf("webhook url %s: %w", cfg.URL, ErrNoSecret)
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = defaultBackoff
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.Secret == "" {
+		log.Warn("webhook secret not configured, callback urls are rejected")
+	}
+
+	return &service{
+		jobs:        jobs,
+		repo:        repo,
+		client:      &http.Client{Timeout: cfg.Timeout},
+		log:         log,
+		url:         cfg.URL,
+		secret:      []byte(cfg.Secret),
+		maxAttempts: cfg.MaxAttempts,
+		backoff:     cfg.Backoff,
+	}, nil
+}
+
+// Event maps a job status to the webhook event name
+func Event(status string) string {
+	switch status {
+	case constants.StatusCompleted:
+		return "job.completed"
+	case constants.StatusCancelled:
+		return "job.cancelled"
+	default:
+		return "job.failed"
+	}
+}
+
+func (s *service) Notify(
+	ctx context.Context,
+	r models.JobResult,
+) {
+	ctx = context.WithoutCancel(ctx)
+
+	var urls []string
+	if job, err := s.jobs.Get(ctx, r.JobID); err != nil {
+		s.log.Warn("failed to load job for webhook",
+			zap.String("job_id", r.JobID),
+			zap.Error(err))
+	} else if job.CallbackURL != "" {
+		urls = append(urls, job.CallbackURL)
+	}
+	if s.url != "" && (len(urls) == 0 || urls[0] != s.url) {
+		urls = append(urls, s.url)
+	}
+	if len(urls) == 0 {
+		return
+	}
+	if len(s.secret) == 0 {
+		// callback urls are refused without a secret, this only guards
+		// jobs registered before it was removed
+		s.log.Error("webhook not sent, no secret configured",
+			zap.String("job_id", r.JobID))
+		return
+	}
+
+	p := Payload{Event: Event(r.Status), OccurredAt: time.Now().UTC(), JobResult: r}
+	body, err := json.Marshal(p)
+	if err != nil {
+		s.log.Error("failed to encode webhook payload",
+			zap.String("job_id", r.JobID),
+			zap.Error(err))
+		return
+	}
+
+	for _, url := range urls {
+		go s.deliver(ctx, url, p.Event, r.JobID, body)
+	}
+}
+
+// deliver posts body to url, retrying with exponential backoff on network
+// errors, 429 and 5xx responses until ctx is done. Every attempt is recorded.
+func (s *service) deliver(
+	ctx context.Context,
+	url, event, jobID string,
+	body []byte,
+) {
+	wait := s.backoff
+	for attempt := 1; attempt <= s.maxAttempts; attempt++ {
+		d := models.WebhookDelivery{JobID: jobID, URL: url, Event: event, Attempt: attempt}
+
+		start := time.Now()
+		status, err := s.post(ctx, url, event, body)
+		d.DurationMs = time.Since(start).Milliseconds()
+		d.StatusCode = status
+		if err != nil {
+			d.Error = err.Error()
+		}
+		d.Delivered = err == nil && status >= 200 && status < 300
+		if !d.Delivered && err == nil {
+			d.Error = fmt.Sprintf("unexpected status %d", status)
+		}
+
+		if rerr := s.repo.RecordDelivery(ctx, d); rerr != nil {
+			s.log.Warn("failed to record webhook delivery",
+				zap.String("job_id", jobID),
+				zap.Error(rerr))
+		}
+
+		if d.Delivered {
+			s.log.Info("webhook delivered",
+				zap.String("job_id", jobID),
+				zap.String("url", url),
+				zap.Int("attempt", attempt))
+			return
+		}
+
+		retryable := err != nil || status == http.StatusTooManyRequests || status >= 500
+		if !retryable || attempt == s.maxAttempts {
+			s.log.Error("webhook delivery failed",
+				zap.String("job_id", jobID),
+				zap.String("url", url),
+				zap.Int("attempt", attempt),
+				zap.String("error", d.Error))
+			return
+		}
+
+		// jitter keeps many failed deliveries from retrying in lockstep
+		select {
+		case <-ctx.Done():
+			s.log.Warn("webhook delivery abandoned",
+				zap.String("job_id", jobID),
+				zap.String("url", url),
+				zap.Int("attempt", attempt),
+				zap.Error(ctx.Err()))
+			return
+		case <-time.After(wait/2 + rand.N(wait/2+1)):
+		}
+		wait = min(wait*2, maxBackoff)
+	}
+}
+
+func (s *service) post(
+	ctx context.Context,
+	url, event string,
+	body []byte,
+) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sales-analytics-webhook/1.0")
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderTimestamp, ts)
+	req.Header.Set(HeaderSignature, "sha256="+Sign(s.secret, ts, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	// drained so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrain))
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>", which receivers
+// recompute to verify a delivery
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *service) Deliveries(
+	ctx context.Context,
+	jobID string,
+) ([]models.WebhookDelivery, error) {
+	deliveries, err := s.repo.ListDeliveries(ctx, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,186 @@
+// Package pii encrypts personal data for storage with AES-256-GCM under
+// named keys and derives deterministic HMAC-SHA256 blind indexes, so
+// encrypted values can still be compared and looked up.
+//
+// Ciphertexts are stored as "enc:<key id>:<base64 nonce+sealed>". The key
+// id lets values written under retired keys be read until they are
+// re-encrypted with the active key. Values without the prefix are taken as
+// plaintext from before encryption was enabled.
+package pii
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const prefix = "enc:"
+
+var (
+	ErrUnknownKey = errors.New("pii: unknown key id")
+	ErrCorrupt    = errors.New("pii: malformed ciphertext")
+
+	keyID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+)
+
+type Config struct {
+	// ActiveKey names the key new values are encrypted with
+	ActiveKey string
+	// Keys maps key ids to base64 encoded 32 byte keys. Retired keys stay
+	// listed until nothing is encrypted with them anymore.
+	Keys map[string]string
+	// IndexKey is the base64 encoded HMAC key of the blind indexes.
+	// Changing it invalidates every stored index.
+	IndexKey string
+}
+
+type Keyring struct {
+	active string
+	aeads  map[string]cipher.AEAD
+	index  []byte
+}
+
+// New builds a keyring from cfg. Without keys the keyring is disabled and
+// stores values as given; the blind index is then an unkeyed hash.
+func New(cfg Config) (*Keyring, error) {
+	k := &Keyring{aeads: make(map[string]cipher.AEAD, len(cfg.Keys))}
+
+	for id, encoded := range cfg.Keys {
+		if !keyID.MatchString(id) {
+			return nil, fmt.Errorf("pii: invalid key id %q", id)
+		}
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(raw) != 32 {
+			return nil, fmt.Errorf("pii: key %q must be 32 base64 encoded bytes", id)
+		}
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.aeads[id] = aead
+	}
+
+	if len(k.aeads) > 0 {
+		if _, ok := k.aeads[cfg.ActiveKey]; !ok {
+			return nil, fmt.Errorf("pii: active key %q is not configured", cfg.ActiveKey)
+		}
+		k.active = cfg.ActiveKey
+	}
+
+	if cfg.IndexKey != "" {
+		raw, err := base64.StdEncoding.DecodeString(cfg.IndexKey)
+		if err != nil || len(raw) < 16 {
+			return nil, errors.New("pii: index key must be at least 16 base64 encoded bytes")
+		}
+		k.index = raw
+	} else if k.Enabled() {
+		return nil, errors.New("pii: index key is required when encryption keys are set")
+	}
+	return k, nil
+}
+
+// Enabled reports whether values are encrypted
+func (k *Keyring) Enabled() bool {
+	return k.active != ""
+}
+
+// Keyed reports whether blind indexes are keyed. Unkeyed indexes of
+// guessable values such as emails or IDs can be reversed by brute force.
+func (k *Keyring) Keyed() bool {
+	return len(k.index) > 0
+}
+
+// ActiveKey is the id of the key new values are encrypted with
+func (k *Keyring) ActiveKey() string {
+	return k.active
+}
+
+// ActivePrefix starts every value encrypted with the active key, values
+// without it need re-encryption
+func (k *Keyring) ActivePrefix() string {
+	if !k.Enabled() {
+		return ""
+	}
+	return prefix + k.active + ":"
+}
+
+// Encrypt seals plain with the active key. The empty string stays empty so
+// missing values remain recognisable.
+func (k *Keyring) Encrypt(plain string) (string, error) {
+	if plain == "" || !k.Enabled() {
+		return plain, nil
+	}
+
+	aead := k.aeads[k.active]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plain)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), []byte(k.active))
+	return prefix + k.active + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value sealed by Encrypt under any configured key. Values
+// that were never encrypted are returned as they are.
+func (k *Keyring) Decrypt(value string) (string, error) {
+	if !strings.HasPrefix(value, prefix) {
+		return value, nil
+	}
+
+	id, encoded, ok := strings.Cut(value[len(prefix):], ":")
+	if !ok {
+		return "", ErrCorrupt
+	}
+	aead, ok := k.aeads[id]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrCorrupt
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return "", ErrCorrupt
+	}
+	return string(plain), nil
+}
+
+// BlindIndex is a deterministic, non-reversible digest of an already
+// normalized value; equal values give equal indexes. Empty values have no
+// index.
+func (k *Keyring) BlindIndex(normalized string) string {
+	if normalized == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, k.index)
+	mac.Write([]byte(normalized))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Email encrypts an email and returns it with the blind index of its
+// normalized form, so the same mailbox always gets the same index
+func (k *Keyring) Email(email string) (sealed, index string, err error) {
+	sealed, err = k.Encrypt(email)
+	return sealed, k.BlindIndex(NormalizeEmail(email)), err
+}
+
+// Address encrypts an address and returns it with the blind index of its
+// normalized form
+func (k *Keyring) Address(address string) (sealed, index string, err error) {
+	sealed, err = k.Encrypt(address)
+	return sealed, k.BlindIndex(NormalizeAddress(address)), err
+}
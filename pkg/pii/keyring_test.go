@@ -0,0 +1,164 @@
+package pii
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func key(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(rune(b)), 32)))
+}
+
+var indexKey = base64.StdEncoding.EncodeToString([]byte("index-key-0123456789"))
+
+func newKeyring(t *testing.T, active string, keys map[string]string) *Keyring {
+	t.Helper()
+	k, err := New(Config{ActiveKey: active, Keys: keys, IndexKey: indexKey})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return k
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	k := newKeyring(t, "k1", map[string]string{"k1": key('a')})
+
+	for _, plain := range []string{"jane@example.com", "Straße 1, 10115 Berlin"} {
+		sealed, err := k.Encrypt(plain)
+		if err != nil {
+			t.Fatalf("Encrypt: %v", err)
+		}
+		if !strings.HasPrefix(sealed, "enc:k1:") || strings.Contains(sealed, plain) {
+			t.Errorf("Encrypt(%q) = %q", plain, sealed)
+		}
+		got, err := k.Decrypt(sealed)
+		if err != nil || got != plain {
+			t.Errorf("Decrypt = %q, %v, want %q", got, err, plain)
+		}
+	}
+
+	a, _ := k.Encrypt("same")
+	b, _ := k.Encrypt("same")
+	if a == b {
+		t.Error("equal values encrypted alike, nonces are reused")
+	}
+
+	if sealed, err := k.Encrypt(""); sealed != "" || err != nil {
+		t.Errorf("Encrypt(\"\") = %q, %v", sealed, err)
+	}
+}
+
+func TestDecryptRetiredKey(t *testing.T) {
+	old := newKeyring(t, "k1", map[string]string{"k1": key('a')})
+	sealed, err := old.Encrypt("jane@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := newKeyring(t, "k2", map[string]string{"k1": key('a'), "k2": key('b')})
+	if got, err := rotated.Decrypt(sealed); err != nil || got != "jane@example.com" {
+		t.Errorf("Decrypt under retired key = %q, %v", got, err)
+	}
+	resealed, _ := rotated.Encrypt("jane@example.com")
+	if !strings.HasPrefix(resealed, rotated.ActivePrefix()) || strings.HasPrefix(sealed, rotated.ActivePrefix()) {
+		t.Errorf("active prefix %q: new %q, old %q", rotated.ActivePrefix(), resealed, sealed)
+	}
+
+	dropped := newKeyring(t, "k2", map[string]string{"k2": key('b')})
+	if _, err := dropped.Decrypt(sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt with unknown key id: error = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestDecryptCorrupt(t *testing.T) {
+	// k2 holds the same key bytes, only the associated data differs
+	k := newKeyring(t, "k1", map[string]string{"k1": key('a'), "k2": key('a')})
+	sealed, err := k.Encrypt("jane@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := strings.TrimPrefix(sealed, "enc:k1:")
+	raw, _ := base64.StdEncoding.DecodeString(body)
+	raw[len(raw)-1] ^= 1
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"missing key id separator", "enc:k1"},
+		{"not base64", "enc:k1:!!!"},
+		{"shorter than the nonce", "enc:k1:" + base64.StdEncoding.EncodeToString([]byte("short"))},
+		{"flipped bit", "enc:k1:" + base64.StdEncoding.EncodeToString(raw)},
+		{"key id swapped", "enc:k2:" + body},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := k.Decrypt(tt.value); !errors.Is(err, ErrCorrupt) {
+				t.Errorf("Decrypt(%q) = %q, %v, want ErrCorrupt", tt.value, got, err)
+			}
+		})
+	}
+}
+
+func TestPlaintextPassThrough(t *testing.T) {
+	k := newKeyring(t, "k1", map[string]string{"k1": key('a')})
+	if got, err := k.Decrypt("jane@example.com"); err != nil || got != "jane@example.com" {
+		t.Errorf("Decrypt(plaintext) = %q, %v", got, err)
+	}
+
+	disabled := newKeyring(t, "", nil)
+	if disabled.Enabled() || disabled.ActivePrefix() != "" {
+		t.Error("keyring without keys is enabled")
+	}
+	if got, err := disabled.Encrypt("jane@example.com"); err != nil || got != "jane@example.com" {
+		t.Errorf("disabled Encrypt = %q, %v", got, err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"invalid key id", Config{ActiveKey: "k:1", Keys: map[string]string{"k:1": key('a')}, IndexKey: indexKey}},
+		{"short key", Config{ActiveKey: "k1", Keys: map[string]string{"k1": base64.StdEncoding.EncodeToString([]byte("short"))}, IndexKey: indexKey}},
+		{"active key missing", Config{ActiveKey: "k2", Keys: map[string]string{"k1": key('a')}, IndexKey: indexKey}},
+		{"no index key", Config{ActiveKey: "k1", Keys: map[string]string{"k1": key('a')}}},
+		{"short index key", Config{IndexKey: base64.StdEncoding.EncodeToString([]byte("short"))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.cfg); err == nil {
+				t.Error("New succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestBlindIndex(t *testing.T) {
+	k := newKeyring(t, "k1", map[string]string{"k1": key('a')})
+	other, err := New(Config{IndexKey: base64.StdEncoding.EncodeToString([]byte("another-index-key"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, a, err := k.Email("Jane.Doe+shop@Example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, b, _ := k.Email("jane.doe@example.com")
+	if a != b || len(a) != 64 {
+		t.Errorf("indexes of one mailbox differ: %q, %q", a, b)
+	}
+	if _, c, _ := other.Email("jane.doe@example.com"); c == a {
+		t.Error("index does not depend on the index key")
+	}
+	if _, idx, _ := k.Email("not an email"); idx != "" {
+		t.Errorf("index of a non email = %q", idx)
+	}
+	if !k.Keyed() || (&Keyring{}).Keyed() {
+		t.Error("Keyed does not reflect the index key")
+	}
+}
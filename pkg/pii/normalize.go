@@ -0,0 +1,35 @@
+package pii
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NormalizeEmail lower-cases an email and drops a +tag from the local part,
+// so "Jane.Doe+shop@Example.com" and "jane.doe@example.com" match. Strings
+// that are not an email normalize to "".
+func NormalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndexByte(email, '@')
+	if at <= 0 || at == len(email)-1 {
+		return ""
+	}
+	local, domain := email[:at], email[at+1:]
+	if plus := strings.IndexByte(local, '+'); plus > 0 {
+		local = local[:plus]
+	}
+	return local + "@" + domain
+}
+
+// NormalizeAddress lower-cases an address and collapses punctuation and
+// spacing
+func NormalizeAddress(address string) string {
+	return strings.Join(Tokens(address), " ")
+}
+
+// Tokens splits s into lower-case letter and digit runs
+func Tokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
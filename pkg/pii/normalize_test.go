@@ -0,0 +1,42 @@
+package pii
+
+import "testing"
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"jane.doe@example.com", "jane.doe@example.com"},
+		{"  Jane.Doe+Shop@Example.COM ", "jane.doe@example.com"},
+		{"jane+a+b@example.com", "jane@example.com"},
+		{"+tag@example.com", "+tag@example.com"}, // no local part left to keep
+		{`"a@b"@example.com`, `"a@b"@example.com`},
+		{"jane@", ""},
+		{"@example.com", ""},
+		{"jane.example.com", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeEmail(tt.in); got != tt.want {
+			t.Errorf("NormalizeEmail(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"12 Main St.", "12 main st"},
+		{"  12,  MAIN   st ", "12 main st"},
+		{"Straße 1\n10115 Berlin", "straße 1 10115 berlin"},
+		{"Flat 3/B - 7 O'Neil Rd", "flat 3 b 7 o neil rd"},
+		{" ,.- ", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeAddress(tt.in); got != tt.want {
+			t.Errorf("NormalizeAddress(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
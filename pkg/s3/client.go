@@ -0,0 +1,214 @@
+// Package s3 is a minimal S3-compatible object reader signed with AWS
+// Signature Version 4. It only streams objects, which is all ingestion
+// needs, and works against AWS as well as MinIO-style endpoints.
+package s3
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	scheme          = "s3://"
+	algorithm       = "AWS4-HMAC-SHA256"
+	service         = "s3"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDateFormat   = "20060102T150405Z"
+	dateFormat      = "20060102"
+)
+
+var ErrNotConfigured = errors.New("s3 credentials not configured")
+
+type Config struct {
+	// Endpoint overrides the AWS endpoint, e.g. http://localhost:9000
+	Endpoint     string
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// PathStyle addresses objects as <endpoint>/<bucket>/<key> instead of
+	// <bucket>.<endpoint>/<key>; most S3-compatible servers need it
+	PathStyle bool
+}
+
+type Client struct {
+	cfg  Config
+	http *http.Client
+	now  func() time.Time
+}
+
+func New(cfg Config) *Client {
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+
+	// no overall timeout, objects are streamed for as long as ingestion runs
+	return &Client{cfg: cfg, http: &http.Client{}, now: time.Now}
+}
+
+// IsURL reports whether source is an s3://bucket/key URL
+func IsURL(source string) bool {
+	return strings.HasPrefix(source, scheme)
+}
+
+// ParseURL splits s3://bucket/key into its bucket and key
+func ParseURL(source string) (bucket, key string, err error) {
+	if !IsURL(source) {
+		return "", "", fmt.Errorf("not an s3 url: %q", source)
+	}
+	bucket, key, _ = strings.Cut(strings.TrimPrefix(source, scheme), "/")
+	if bucket == "" || key == "" {
+		return "", "", fmt.Errorf("s3 url must be s3://bucket/key: %q", source)
+	}
+	return bucket, key, nil
+}
+
+// Open streams an object. The caller must close the returned body.
+func (c *Client) Open(
+	ctx context.Context,
+	bucket, key string,
+) (io.ReadCloser, error) {
+	if c == nil || c.cfg.AccessKey == "" || c.cfg.SecretKey == "" {
+		return nil, ErrNotConfigured
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.objectURL(bucket, key), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build s3 request: %w", err)
+	}
+	c.sign(req)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get s3://%s/%s: %w", bucket, key, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return nil, fmt.Errorf("failed to get s3://%s/%s: %s: %s",
+			bucket, key, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return resp.Body, nil
+}
+
+func (c *Client) objectURL(bucket, key string) string {
+	path := "/" + uriEncode(key, false)
+
+	endpoint := c.cfg.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", c.cfg.Region)
+	}
+	if c.cfg.PathStyle {
+		return endpoint + "/" + uriEncode(bucket, true) + path
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return endpoint + "/" + uriEncode(bucket, true) + path
+	}
+	u.Host = bucket + "." + u.Host
+	return u.String() + path
+}
+
+// sign adds the SigV4 Authorization header to req. The payload is left
+// unsigned so bodies never have to be buffered.
+func (c *Client) sign(req *http.Request) {
+	now := c.now().UTC()
+
+	req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	if c.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.cfg.SessionToken)
+	}
+
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if c.cfg.SessionToken != "" {
+		signed = append(signed, "x-amz-security-token")
+	}
+	req.Header.Set("Authorization", authorization(req, c.cfg, now, signed, unsignedPayload))
+}
+
+// authorization returns the SigV4 Authorization header of req signed at now
+// over the signed headers, sorted and lowercase, and the payload hash
+func authorization(
+	req *http.Request,
+	cfg Config,
+	now time.Time,
+	signed []string,
+	payloadHash string,
+) string {
+	amzDate := now.Format(amzDateFormat)
+	date := now.Format(dateFormat)
+
+	var headers strings.Builder
+	for _, h := range signed {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = req.URL.Host
+		}
+		headers.WriteString(h + ":" + strings.TrimSpace(v) + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headers.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, cfg.Region, service, "aws4_request"}, "/")
+	toSign := strings.Join([]string{algorithm, amzDate, scope, hexSHA256(canonical)}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+cfg.SecretKey), date)
+	key = hmacSHA256(key, cfg.Region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	return fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, cfg.AccessKey, scope, signedHeaders, signature)
+}
+
+// uriEncode escapes everything but RFC 3986 unreserved characters, the way
+// SigV4 canonical URIs expect; slashes are kept unless encodeSlash is set
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case 'A' <= ch && ch <= 'Z', 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '~':
+			b.WriteByte(ch)
+		case ch == '/' && !encodeSlash:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hexSHA256(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}